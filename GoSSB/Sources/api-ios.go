@@ -23,16 +23,35 @@ package main
 //     ((void(*)(int64_t, int64_t, int64_t))func)(migrationIndex, migrationsCount, error);
 // }
 //
+// static void callNotifyMigrationOnErrorMessage(void *func, int64_t migrationIndex, int64_t migrationsCount, int64_t error, const char *message)
+// {
+//     ((void(*)(int64_t, int64_t, int64_t, const char *))func)(migrationIndex, migrationsCount, error, message);
+// }
+//
 // static void callNotifyMigrationOnDone(void *func, int64_t migrationsCount)
 // {
 //     ((void(*)(int64_t))func)(migrationsCount);
 // }
+//
+// static void callNotifyMigrationOnProgress(void *func, int64_t migrationIndex, int64_t migrationsCount, int64_t itemsProcessed, int64_t itemsTotal, int64_t bytesProcessed, int64_t bytesTotal)
+// {
+//     ((void(*)(int64_t, int64_t, int64_t, int64_t, int64_t, int64_t))func)(migrationIndex, migrationsCount, itemsProcessed, itemsTotal, bytesProcessed, bytesTotal);
+// }
+//
+// static void callNotifyIndexOnProgress(void *func, int64_t itemsProcessed, int64_t itemsTotal, bool done)
+// {
+//     ((void(*)(int64_t, int64_t, bool))func)(itemsProcessed, itemsTotal, done);
+// }
+//
+// static void callNotifyStateChanged(void *func, int64_t previousState, int64_t currentState, int64_t error)
+// {
+//     ((void(*)(int64_t, int64_t, int64_t))func)(previousState, currentState, error);
+// }
 import "C"
 
 import (
 	"encoding/json"
 	"runtime/debug"
-	"strings"
 	"time"
 	"unsafe"
 	"verseproj/scuttlegobridge/bindings"
@@ -45,6 +64,9 @@ import (
 const (
 	kilobyte = 1000
 	megabyte = 1000 * kilobyte
+
+	kibibyte = 1024
+	mebibyte = 1024 * kibibyte
 )
 
 const (
@@ -64,19 +86,24 @@ func init() {
 	debug.SetMemoryLimit(memoryLimitInBytes)
 }
 
-var (
-	log  logging.Logger
-	node = bindings.NewNode()
-)
+// log is used by functions which don't operate on a particular node and
+// before a node is initialized. Each node gets its own logger in ssbBotInit.
+var log logging.Logger
 
 //export ssbBotStop
-func ssbBotStop() bool {
-	defer logPanic()
+func ssbBotStop(handle int64) bool {
+	defer logPanic(handle)
 
 	var err error
-	defer logError("ssbBotStop", &err)
+	defer logError(handle, "ssbBotStop", &err)
 
-	err = node.Stop()
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the node")
+		return false
+	}
+
+	err = instance.node.Stop()
 	if err != nil {
 		if !errors.Is(err, bindings.ErrNodeIsNotRunning) {
 			err = errors.Wrap(err, "failed to stop the node")
@@ -87,14 +114,235 @@ func ssbBotStop() bool {
 	return true
 }
 
+// ssbCancelMigrations cancels the migrations started by ssbBotInit or by a
+// restart of the service. The migration which is running is interrupted and
+// the node stops, ssbBotInit returns false if it is still running. The state
+// of the interrupted migration is preserved so that it resumes the next time
+// ssbBotInit is called. Returns false if no migrations are running.
+//
+//export ssbCancelMigrations
+func ssbCancelMigrations(handle int64) bool {
+	defer logPanic(handle)
+
+	var err error
+	defer logError(handle, "ssbCancelMigrations", &err)
+
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the node")
+		return false
+	}
+
+	err = instance.node.CancelMigrations()
+	if err != nil {
+		err = errors.Wrap(err, "failed to cancel migrations")
+		return false
+	}
+
+	return true
+}
+
+// ssbBotSuspend closes all peer connections and stops networking, replication
+// and blob downloads without stopping the node. Functions which only read the
+// local storage continue to work while the node is suspended and messages
+// published locally are still indexed and delivered to the subscriptions.
+// Suspending a node which is already suspended has no effect. Returns false if the peers
+// couldn't be disconnected, the node isn't suspended then.
+//
+//export ssbBotSuspend
+func ssbBotSuspend(handle int64) bool {
+	defer logPanic(handle)
+
+	var err error
+	defer logError(handle, "ssbBotSuspend", &err)
+
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the node")
+		return false
+	}
+
+	err = instance.node.Suspend()
+	if err != nil {
+		err = errors.Wrap(err, "failed to suspend the node")
+		return false
+	}
+
+	return true
+}
+
+// ssbBotResume restarts networking of a node suspended with ssbBotSuspend.
+// Resuming a node which isn't suspended has no effect.
+//
+//export ssbBotResume
+func ssbBotResume(handle int64) bool {
+	defer logPanic(handle)
+
+	var err error
+	defer logError(handle, "ssbBotResume", &err)
+
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the node")
+		return false
+	}
+
+	err = instance.node.Resume()
+	if err != nil {
+		err = errors.Wrap(err, "failed to resume the node")
+		return false
+	}
+
+	return true
+}
+
+// ssbNotifyMemoryPressure should be called when the host OS reports a change
+// of memory pressure. The level is one of:
+//
+//  0. Normal, starts the blob downloads deferred by the other levels.
+//  1. Warning, forces a garbage collection and defers blob downloads
+//     requested with ssbBlobsWant.
+//  2. Critical, additionally returns memory to the OS.
+//
+// The level is applied in the background so this function returns
+// immediately and can be called from the main thread. Downloads of blobs
+// which were already wanted and replication concurrency can't be controlled
+// by scuttlego and aren't affected, peers stay connected. The Badger block
+// caches keep the size set by the storage profile as they can only be resized
+// by reopening the storage which isn't done under memory pressure. Returns the memory usage at the time of the call
+// encoded as JSON, see ssbMemoryStats, or NULL on error.
+//
+//export ssbNotifyMemoryPressure
+func ssbNotifyMemoryPressure(handle int64, level int) *C.char {
+	defer logPanic(handle)
+
+	var err error
+	defer logError(handle, "ssbNotifyMemoryPressure", &err)
+
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the node")
+		return nil
+	}
+
+	pressure, err := bindings.NewMemoryPressure(level)
+	if err != nil {
+		err = errors.Wrap(invalidArgument(err), "invalid level")
+		return nil
+	}
+
+	err = instance.node.NotifyMemoryPressure(pressure)
+	if err != nil {
+		err = errors.Wrap(err, "failed to apply the memory pressure level")
+		return nil
+	}
+
+	j, err := json.Marshal(bindings.ReadMemoryStats())
+	if err != nil {
+		err = errors.Wrap(err, "error marshaling the result")
+		return nil
+	}
+
+	return C.CString(string(j))
+}
+
+// ssbBotReconfigure applies a partial config encoded as JSON to a running
+// node. The patch uses the same field names as the config passed to
+// ssbBotInit. Changing hops, listenAddr, preferredPubs, storageProfile or
+// storageOptions rebuilds the service which closes all peer connections, the
+// migrations aren't run again. MaxServiceRestarts is applied immediately.
+// Changes to other fields require stopping and initializing the node again
+// and are not applied. Returns a JSON object
+// listing the names of applied fields under "applied" and the names of fields
+// which require a restart under "requiresRestart" or NULL on error.
+//
+//export ssbBotReconfigure
+func ssbBotReconfigure(handle int64, patch string) *C.char {
+	defer logPanic(handle)
+
+	var err error
+	defer logError(handle, "ssbBotReconfigure", &err)
+
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the node")
+		return nil
+	}
+
+	result, err := instance.node.Reconfigure([]byte(patch))
+	if err != nil {
+		err = errors.Wrap(err, "failed to reconfigure the node")
+		return nil
+	}
+
+	j, err := json.Marshal(result)
+	if err != nil {
+		err = errors.Wrap(err, "error marshaling the result")
+		return nil
+	}
+
+	return C.CString(string(j))
+}
+
+// ssbValidateConfig checks the config which would be passed to ssbBotInit
+// without starting a node. Returns a JSON list of objects describing the
+// problems, each with a "field" containing the JSON name of the affected
+// field and a "problem" describing what is wrong. The list is empty if the
+// config is valid. The config must contain a "schemaVersion" equal to the
+// version supported by the bridge, currently 1. Validation doesn't change
+// anything, the repo directory isn't created and the listen address isn't
+// bound so an address which can't be bound, for example because the port is
+// in use, isn't reported. Host names in the listen address are resolved.
+// The "maxConnections" and "reconnectIntervalSeconds" connection policy
+// settings aren't supported by scuttlego v0.0.4 and are reported as problems
+// unless they are zero. Returns NULL on error.
+//
+//export ssbValidateConfig
+func ssbValidateConfig(config string) *C.char {
+	defer logPanic(noHandle)
+
+	var err error
+	defer logError(noHandle, "ssbValidateConfig", &err)
+
+	problems := bindings.ValidateConfig([]byte(config))
+
+	j, err := json.Marshal(problems)
+	if err != nil {
+		err = errors.Wrap(err, "error marshaling the result")
+		return nil
+	}
+
+	return C.CString(string(j))
+}
+
 //export ssbBotIsRunning
-func ssbBotIsRunning() bool {
-	defer logPanic()
+func ssbBotIsRunning(handle int64) bool {
+	defer logPanic(handle)
+
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		return false
+	}
 
-	return node.IsRunning()
+	return instance.node.IsRunning()
 }
 
-// Three callbacks are used to notify about progress when running migrations:
+// ssbBotState returns the current lifecycle state of the node. See ssbBotInit
+// for the list of states.
+//
+//export ssbBotState
+func ssbBotState(handle int64) int {
+	defer logPanic(handle)
+
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		return int(bindings.NodeStateStopped)
+	}
+
+	return int(instance.node.State())
+}
+
+// Four callbacks are used to notify about progress when running migrations:
 //   - OnRunning is called when a particular migration has to be
 //     executed. If all migrations were already executed this callback will not be
 //     called. If status loading fails for a migration this callback will not
@@ -103,9 +351,24 @@ func ssbBotIsRunning() bool {
 //     callback is triggered it is only triggered once and is the last
 //     callback to be triggered. The error parameter specifies the type of encountered error:
 //     0. Unknown error.
+//     1. The disk is full.
+//     2. The old go-ssb repository is corrupted.
+//     3. Permission denied.
+//     4. The migrations were cancelled, for example because the node was stopped.
+//     5. The data is inconsistent, for example messages don't form a valid feed.
+//     If the optional OnErrorMessage callback is set it is called right
+//     after OnError with the same arguments and the full error text which is
+//     meant for debugging and may change at any time. The text is freed once the
+//     callback returns.
 //   - OnDone is called once there are no more migrations remaining to
 //     be executed. This includes the scenario when there are no more migrations to consider.
 //     If this callback is triggered it is triggered only once and is the last callback to be triggered.
+//   - OnProgress is optional and is called periodically after OnRunning
+//     with the number of items and bytes processed by the running migration
+//     out of the total. It is only called if the migration can estimate its
+//     progress which currently is the case when importing the old go-ssb
+//     repository. It is called from a different thread than the other
+//     callbacks but never after OnError or OnDone.
 //
 // Example valid call sequences:
 //
@@ -137,35 +400,81 @@ func ssbBotIsRunning() bool {
 //
 //   - OnError(index=1, count=3)
 //
+// The optional index progress callback is called periodically while the index
+// used by ssbSearch, ssbBacklinks and ssbGetMessageByKey catches up with the
+// receive log, for example after it was rebuilt using ssbRebuildIndex or
+// after the index format changed. It receives the number of indexed messages
+// out of the total and is called one last time with done set to true once the
+// index caught up. It is called from a background thread.
+//
+// The state change callback is called every time the lifecycle state of the
+// node changes. It receives the previous state, the new state and an error
+// code explaining why the transition happened. The callback is called
+// synchronously and must not call any functions of the bridge other than
+// ssbBotState. The states are:
+//
+//  0. Stopped.
+//  1. Building.
+//  2. Migrating.
+//  3. Running.
+//  4. Stopping.
+//  5. Crashed, the service terminated and the node gave up restarting it.
+//  6. Suspended, see ssbBotSuspend.
+//
+// The error codes are:
+//
+//  0. No error.
+//  1. Unknown error.
+//  2. Invalid config.
+//  3. Building the service failed.
+//  4. Running migrations failed.
+//  5. The service terminated unexpectedly.
+//
+// Transitions to the current state are reported only if they carry an error
+// code, for example when the config passed to ssbBotInit is invalid or when a
+// restart attempt fails.
+//
 //export ssbBotInit
 func ssbBotInit(
+	handle int64,
 	config string,
 	notifyBlobReceivedFn uintptr,
 	notifyMigrationOnRunningFn uintptr,
 	notifyMigrationOnErrorFn uintptr,
 	notifyMigrationOnDoneFn uintptr,
+	notifyStateChangedFn uintptr,
+	notifyMigrationOnErrorMessageFn uintptr,
+	notifyMigrationOnProgressFn uintptr,
+	notifyIndexOnProgressFn uintptr,
 ) bool {
-	defer logPanic()
+	defer logPanic(handle)
 
 	var err error
-	defer logError("ssbBotInit", &err)
+	defer logError(handle, "ssbBotInit", &err)
 
-	var cfg bindings.BotConfig
-	err = json.NewDecoder(strings.NewReader(config)).Decode(&cfg)
+	instance, err := nodes.Get(handle)
 	if err != nil {
-		err = errors.Wrap(err, "failed to decode config")
+		err = errors.Wrap(err, "could not get the node")
+		return false
+	}
+
+	cfg, err := bindings.DecodeBotConfig([]byte(config))
+	if err != nil {
+		err = errors.Wrap(invalidArgument(err), "failed to decode config")
 		return false
 	}
 
 	if err := removeOldLogFiles(cfg); err != nil {
-		log.Error().WithField(logging.ErrorField, err).Message("failed to remove old log files")
+		instance.Logger().Error().WithField(logging.ErrorField, err).Message("failed to remove old log files")
 	}
 
-	err = initLogger(cfg)
+	logger, err := newFileLogger(cfg)
 	if err != nil {
 		err = errors.Wrap(err, "failed to init logger")
 		return false
 	}
+	logger = logger.WithField("handle", handle)
+	instance.SetLogger(logger)
 
 	onBlobDownloadedFn := func(event queries.BlobDownloaded) error {
 		ref := C.CString(event.Id.String())
@@ -183,9 +492,14 @@ func ssbBotInit(
 		}
 	}
 
-	migrationOnErrorFn := func(migrationIndex, migrationsCount, error int) {
+	migrationOnErrorFn := func(migrationIndex, migrationsCount int, code bindings.MigrationErrorCode, migrationErr error) {
 		if notifyMigrationOnErrorFn != 0 {
-			C.callNotifyMigrationOnError(unsafeExternPointer(notifyMigrationOnErrorFn), C.int64_t(migrationIndex), C.int64_t(migrationsCount), C.int64_t(error))
+			C.callNotifyMigrationOnError(unsafeExternPointer(notifyMigrationOnErrorFn), C.int64_t(migrationIndex), C.int64_t(migrationsCount), C.int64_t(code))
+		}
+		if notifyMigrationOnErrorMessageFn != 0 {
+			message := C.CString(migrationErr.Error())
+			C.callNotifyMigrationOnErrorMessage(unsafeExternPointer(notifyMigrationOnErrorMessageFn), C.int64_t(migrationIndex), C.int64_t(migrationsCount), C.int64_t(code), message)
+			C.free(unsafe.Pointer(message))
 		}
 	}
 
@@ -195,7 +509,40 @@ func ssbBotInit(
 		}
 	}
 
-	err = node.Start(cfg, log, onBlobDownloadedFn, migrationOnRunningFn, migrationOnErrorFn, migrationOnDoneFn)
+	var migrationOnProgressFn bindings.MigrationOnProgressFn
+	if notifyMigrationOnProgressFn != 0 {
+		migrationOnProgressFn = func(migrationIndex, migrationsCount int, progress bindings.MigrationProgress) {
+			C.callNotifyMigrationOnProgress(
+				unsafeExternPointer(notifyMigrationOnProgressFn),
+				C.int64_t(migrationIndex),
+				C.int64_t(migrationsCount),
+				C.int64_t(progress.ItemsProcessed),
+				C.int64_t(progress.ItemsTotal),
+				C.int64_t(progress.BytesProcessed),
+				C.int64_t(progress.BytesTotal),
+			)
+		}
+	}
+
+	var indexOnProgressFn bindings.IndexOnProgressFn
+	if notifyIndexOnProgressFn != 0 {
+		indexOnProgressFn = func(progress bindings.IndexProgress) {
+			C.callNotifyIndexOnProgress(
+				unsafeExternPointer(notifyIndexOnProgressFn),
+				C.int64_t(progress.ItemsProcessed),
+				C.int64_t(progress.ItemsTotal),
+				C.bool(progress.Done),
+			)
+		}
+	}
+
+	stateChangedFn := func(previous, current bindings.NodeState, errorCode bindings.NodeErrorCode) {
+		if notifyStateChangedFn != 0 {
+			C.callNotifyStateChanged(unsafeExternPointer(notifyStateChangedFn), C.int64_t(previous), C.int64_t(current), C.int64_t(errorCode))
+		}
+	}
+
+	err = instance.node.Start(cfg, logger, onBlobDownloadedFn, migrationOnRunningFn, migrationOnErrorFn, migrationOnDoneFn, migrationOnProgressFn, indexOnProgressFn, stateChangedFn)
 	if err != nil {
 		err = errors.Wrap(err, "failed to start node")
 		return false
@@ -14,16 +14,16 @@ import (
 // hashes. The hashes are passed as JSON encoded list of hex-encoded strings.
 //
 //export ssbBanListSet
-func ssbBanListSet(hashes string) bool {
-	defer logPanic()
+func ssbBanListSet(handle int64, hashes string) bool {
+	defer logPanic(handle)
 
 	var err error
-	defer logError("ssbBanListSet", &err)
+	defer logError(handle, "ssbBanListSet", &err)
 
 	var unmarshaledHashes []string
 	err = json.Unmarshal([]byte(hashes), &unmarshaledHashes)
 	if err != nil {
-		err = errors.Wrap(err, "json unmarshal error")
+		err = errors.Wrap(invalidArgument(err), "json unmarshal error")
 		return false
 	}
 
@@ -32,21 +32,21 @@ func ssbBanListSet(hashes string) bool {
 		var hashBytes []byte
 		hashBytes, err = hex.DecodeString(unmarshaledHash)
 		if err != nil {
-			err = errors.Wrap(err, "could not decode hash bytes")
+			err = errors.Wrap(invalidArgument(err), "could not decode hash bytes")
 			return false
 		}
 
 		var h bans.Hash
 		h, err = bans.NewHash(hashBytes)
 		if err != nil {
-			err = errors.Wrap(err, "could not create the hash")
+			err = errors.Wrap(invalidArgument(err), "could not create the hash")
 			return false
 		}
 
 		convertedHashes = append(convertedHashes, h)
 	}
 
-	service, err := node.Get()
+	service, err := getService(handle)
 	if err != nil {
 		err = errors.Wrap(err, "could not get the node")
 		return false
@@ -0,0 +1,361 @@
+package bindings
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/boreq/errors"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/planetary-social/scuttlego/service/app/common"
+	"github.com/planetary-social/scuttlego/service/app/queries"
+	"github.com/planetary-social/scuttlego/service/domain/feeds/message"
+	"github.com/planetary-social/scuttlego/service/domain/refs"
+)
+
+// Relations describe where in the content of the linking message the link was
+// found.
+const (
+	BacklinkRelRoot    = "root"
+	BacklinkRelBranch  = "branch"
+	BacklinkRelMention = "mention"
+	BacklinkRelVote    = "vote"
+	BacklinkRelContact = "contact"
+
+	// BacklinkRelLink is used for links found in other fields.
+	BacklinkRelLink = "link"
+)
+
+var indexPrefixBacklinks = []byte("b:")
+
+// Backlink describes the links to a ref from the content of a message.
+type Backlink struct {
+	Source   refs.Message
+	Rels     []string
+	Type     string
+	Sequence common.ReceiveLogSequence
+}
+
+// BacklinkWithMessage is a backlink together with the linking message.
+type BacklinkWithMessage struct {
+	Backlink
+	Message message.Message
+}
+
+// BacklinksFilter selects backlinks. Zero value selects all backlinks.
+type BacklinksFilter struct {
+	// Rels selects backlinks with one of the given relations. Empty selects
+	// all relations.
+	Rels []string `json:"rels"`
+
+	// Types selects backlinks from messages with one of the given content
+	// types. Empty selects all types.
+	Types []string `json:"types"`
+}
+
+func (f BacklinksFilter) matches(backlink Backlink) bool {
+	if len(f.Rels) > 0 && !containsAnyString(f.Rels, backlink.Rels) {
+		return false
+	}
+
+	if len(f.Types) > 0 && !containsAnyString(f.Types, []string{backlink.Type}) {
+		return false
+	}
+
+	return true
+}
+
+// Backlinks returns at most limit messages which link to the given message,
+// feed or blob and have a receive log sequence greater or equal to the given
+// sequence, ordered by the receive log sequence. The returned sequence is the
+// sequence from which the next call should continue. The end was reached if
+// the returned sequence is equal to the given one. Messages which weren't
+// indexed yet aren't returned.
+func (n *Node) Backlinks(target string, filter BacklinksFilter, start common.ReceiveLogSequence, limit int) ([]BacklinkWithMessage, common.ReceiveLogSequence, error) {
+	if limit <= 0 {
+		return nil, common.ReceiveLogSequence{}, errors.New("limit must be positive")
+	}
+
+	canonicalTarget, ok := ParseLinkTarget(target)
+	if !ok {
+		return nil, common.ReceiveLogSequence{}, errors.New("target must be a message, feed or blob ref")
+	}
+
+	service, err := n.Get()
+	if err != nil {
+		return nil, common.ReceiveLogSequence{}, errors.Wrap(err, "error getting the service")
+	}
+
+	index, err := n.getIndex()
+	if err != nil {
+		return nil, common.ReceiveLogSequence{}, errors.Wrap(err, "error getting the index")
+	}
+
+	backlinks, next, err := index.Backlinks(canonicalTarget, filter, start, limit)
+	if err != nil {
+		return nil, common.ReceiveLogSequence{}, errors.Wrap(err, "error querying the index")
+	}
+
+	var result []BacklinkWithMessage
+	for _, backlink := range backlinks {
+		query, err := queries.NewGetMessage(backlink.Source)
+		if err != nil {
+			return nil, common.ReceiveLogSequence{}, errors.Wrap(err, "error creating the query")
+		}
+
+		msg, err := service.App.Queries.GetMessage.Handle(query)
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				continue
+			}
+			return nil, common.ReceiveLogSequence{}, errors.Wrapf(err, "error getting message '%s'", backlink.Source)
+		}
+
+		result = append(result, BacklinkWithMessage{
+			Backlink: backlink,
+			Message:  msg,
+		})
+	}
+
+	return result, next, nil
+}
+
+// Backlinks returns the backlinks in the order of receive log sequences.
+func (i *index) Backlinks(target string, filter BacklinksFilter, start common.ReceiveLogSequence, limit int) ([]Backlink, common.ReceiveLogSequence, error) {
+	var result []Backlink
+	var current *Backlink
+	next := start
+
+	// there is a separate entry for each relation
+	flush := func() error {
+		if current == nil {
+			return nil
+		}
+
+		var err error
+		next, err = common.NewReceiveLogSequence(current.Sequence.Int() + 1)
+		if err != nil {
+			return errors.Wrap(err, "error creating the sequence")
+		}
+
+		if filter.matches(*current) {
+			result = append(result, *current)
+		}
+		current = nil
+		return nil
+	}
+
+	prefix := indexBacklinksPrefix(target)
+
+	if err := i.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{
+			PrefetchValues: false,
+			Prefix:         prefix,
+		})
+		defer it.Close()
+
+		for it.Seek(append(append([]byte(nil), prefix...), encodeIndexInt(start.Int())...)); it.ValidForPrefix(prefix); it.Next() {
+			backlink, err := decodeBacklink(it.Item(), prefix)
+			if err != nil {
+				return errors.Wrap(err, "error decoding the backlink")
+			}
+
+			if current != nil && current.Sequence.Int() == backlink.Sequence.Int() {
+				current.Rels = append(current.Rels, backlink.Rels...)
+				continue
+			}
+
+			if err := flush(); err != nil {
+				return err
+			}
+
+			if len(result) == limit {
+				return nil
+			}
+
+			current = &backlink
+		}
+
+		return flush()
+	}); err != nil {
+		return nil, common.ReceiveLogSequence{}, errors.Wrap(err, "transaction failed")
+	}
+
+	return result, next, nil
+}
+
+func (i *index) addBacklinks(txn *badger.Txn, msg queries.LogMessage) error {
+	content := msg.Message.Content().Raw().Bytes()
+
+	for _, link := range extractLinks(content) {
+		key := indexBacklinkKey(link.Target, msg.Sequence.Int(), link.Rel)
+		value := append(append([]byte(msg.Message.Id().String()), 0), contentType(content)...)
+
+		if err := txn.Set(key, value); err != nil {
+			return errors.Wrap(err, "error setting the backlink")
+		}
+	}
+
+	return nil
+}
+
+// Keys have the following format: prefix, target, 0, sequence, rel. Values
+// have the following format: source, 0, type.
+func indexBacklinksPrefix(target string) []byte {
+	return append(append(append([]byte(nil), indexPrefixBacklinks...), target...), 0)
+}
+
+func indexBacklinkKey(target string, seq int, rel string) []byte {
+	return append(append(indexBacklinksPrefix(target), encodeIndexInt(seq)...), rel...)
+}
+
+func decodeBacklink(item *badger.Item, prefix []byte) (Backlink, error) {
+	key := item.Key()[len(prefix):]
+	if len(key) < 8 {
+		return Backlink{}, errors.New("key too short")
+	}
+
+	seq, err := decodeIndexInt(key[:8])
+	if err != nil {
+		return Backlink{}, errors.Wrap(err, "error decoding the sequence")
+	}
+
+	sequence, err := common.NewReceiveLogSequence(seq)
+	if err != nil {
+		return Backlink{}, errors.Wrap(err, "error creating the sequence")
+	}
+
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return Backlink{}, errors.Wrap(err, "error getting the value")
+	}
+
+	source, typ, ok := bytes.Cut(value, []byte{0})
+	if !ok {
+		return Backlink{}, errors.New("malformed value")
+	}
+
+	sourceRef, err := refs.NewMessage(string(source))
+	if err != nil {
+		return Backlink{}, errors.Wrap(err, "error creating the source ref")
+	}
+
+	return Backlink{
+		Source:   sourceRef,
+		Rels:     []string{string(key[8:])},
+		Type:     string(typ),
+		Sequence: sequence,
+	}, nil
+}
+
+type link struct {
+	Target string
+	Rel    string
+}
+
+// extractLinks returns the links found in the content. Well-known fields are
+// assigned their relations, refs found anywhere else are returned as
+// BacklinkRelLink. Encrypted content has no links.
+func extractLinks(content []byte) []link {
+	var fields map[string]any
+	if err := json.Unmarshal(content, &fields); err != nil {
+		return nil
+	}
+
+	links := make(map[link]struct{})
+
+	for key, value := range fields {
+		rel := BacklinkRelLink
+		switch key {
+		case "root":
+			rel = BacklinkRelRoot
+		case "branch":
+			rel = BacklinkRelBranch
+		case "mentions":
+			rel = BacklinkRelMention
+		case "contact":
+			rel = BacklinkRelContact
+		case "vote":
+			rel = BacklinkRelVote
+		}
+
+		walkLinks(value, func(target string) {
+			links[link{Target: target, Rel: rel}] = struct{}{}
+		})
+	}
+
+	var result []link
+	for l := range links {
+		result = append(result, l)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Target != result[j].Target {
+			return result[i].Target < result[j].Target
+		}
+		return result[i].Rel < result[j].Rel
+	})
+
+	return result
+}
+
+func walkLinks(value any, fn func(target string)) {
+	switch v := value.(type) {
+	case string:
+		if target, ok := ParseLinkTarget(v); ok {
+			fn(target)
+		}
+	case []any:
+		for _, element := range v {
+			walkLinks(element, fn)
+		}
+	case map[string]any:
+		for _, element := range v {
+			walkLinks(element, fn)
+		}
+	}
+}
+
+// ParseLinkTarget returns the canonical form of a message, feed or blob ref
+// which can be used to query backlinks.
+func ParseLinkTarget(s string) (string, bool) {
+	switch {
+	case strings.HasPrefix(s, "%"):
+		if ref, err := refs.NewMessage(s); err == nil {
+			return ref.String(), true
+		}
+	case strings.HasPrefix(s, "@"):
+		if ref, err := refs.NewIdentity(s); err == nil {
+			return ref.String(), true
+		}
+	case strings.HasPrefix(s, "&"):
+		if ref, err := refs.NewBlob(s); err == nil {
+			return ref.String(), true
+		}
+	}
+	return "", false
+}
+
+func contentType(content []byte) string {
+	var v struct {
+		Type string `json:"type"`
+	}
+
+	if err := json.Unmarshal(content, &v); err != nil {
+		return ""
+	}
+
+	return v.Type
+}
+
+func containsAnyString(values []string, candidates []string) bool {
+	for _, v := range values {
+		for _, candidate := range candidates {
+			if v == candidate {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package bindings
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/planetary-social/scuttlego/service/app/common"
+	"github.com/planetary-social/scuttlego/service/app/queries"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testBlobRef = "&uaGieSQDJcHfUp6hjIcIq55GoZh4Ug7tNmgaohoxrpw=.sha256"
+	testFeedRef = "@qFtLJ6P5Eh9vKxnj7Rsh8SkE6B6Z36DVLP7ZOKNeQ/Y=.ed25519"
+)
+
+func TestExtractLinks(t *testing.T) {
+	root := newTestLogMessage(t, 0, `{"type":"post"}`).Message.Id().String()
+
+	content := fmt.Sprintf(`{
+		"type": "post",
+		"root": "%[1]s",
+		"branch": ["%[1]s"],
+		"mentions": [{"link": "%[2]s", "name": "image.png"}, {"link": "%[3]s"}],
+		"text": "not a link %[3]s"
+	}`, root, testBlobRef, testFeedRef)
+
+	require.Equal(t,
+		[]link{
+			{Target: root, Rel: BacklinkRelBranch},
+			{Target: root, Rel: BacklinkRelRoot},
+			{Target: testBlobRef, Rel: BacklinkRelMention},
+			{Target: testFeedRef, Rel: BacklinkRelMention},
+		},
+		extractLinks([]byte(content)),
+	)
+
+	require.Empty(t, extractLinks([]byte(`"c29tZWNpcGhlcnRleHQ=.box"`)))
+}
+
+func TestIndex_Backlinks(t *testing.T) {
+	index := newTestIndex(t)
+
+	root := newTestLogMessage(t, 0, `{"type":"post"}`)
+	target := root.Message.Id().String()
+
+	reply := newTestLogMessage(t, 1, fmt.Sprintf(`{"type":"post","root":"%[1]s","branch":"%[1]s"}`, target))
+	unrelated := newTestLogMessage(t, 2, `{"type":"post"}`)
+	vote := newTestLogMessage(t, 3, fmt.Sprintf(`{"type":"vote","vote":{"link":"%s","value":1}}`, target))
+
+	require.NoError(t, index.Add(common.MustNewReceiveLogSequence(0), []queries.LogMessage{root, reply, unrelated, vote}))
+
+	backlinks, next, err := index.Backlinks(target, BacklinksFilter{}, common.MustNewReceiveLogSequence(0), 1)
+	require.NoError(t, err)
+	require.Len(t, backlinks, 1)
+	require.Equal(t, reply.Message.Id(), backlinks[0].Source)
+	require.Equal(t, []string{BacklinkRelBranch, BacklinkRelRoot}, backlinks[0].Rels)
+	require.Equal(t, "post", backlinks[0].Type)
+	require.Equal(t, 2, next.Int())
+
+	backlinks, next, err = index.Backlinks(target, BacklinksFilter{}, next, 10)
+	require.NoError(t, err)
+	require.Len(t, backlinks, 1)
+	require.Equal(t, vote.Message.Id(), backlinks[0].Source)
+	require.Equal(t, []string{BacklinkRelVote}, backlinks[0].Rels)
+	require.Equal(t, 4, next.Int())
+
+	backlinks, next, err = index.Backlinks(target, BacklinksFilter{Types: []string{"vote"}}, common.MustNewReceiveLogSequence(0), 10)
+	require.NoError(t, err)
+	require.Len(t, backlinks, 1)
+	require.Equal(t, vote.Message.Id(), backlinks[0].Source)
+	require.Equal(t, 4, next.Int())
+
+	backlinks, next, err = index.Backlinks(target, BacklinksFilter{Rels: []string{BacklinkRelRoot}}, common.MustNewReceiveLogSequence(0), 10)
+	require.NoError(t, err)
+	require.Len(t, backlinks, 1)
+	require.Equal(t, reply.Message.Id(), backlinks[0].Source)
+	require.Equal(t, 4, next.Int())
+}
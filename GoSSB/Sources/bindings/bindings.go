@@ -13,22 +13,19 @@ import (
 	bindingslogging "verseproj/scuttlegobridge/logging"
 
 	"github.com/boreq/errors"
-	badgeroptions "github.com/dgraph-io/badger/v3/options"
 	"github.com/planetary-social/scuttlego/service"
-	"github.com/planetary-social/scuttlego/service/adapters/badger"
 	"github.com/planetary-social/scuttlego/service/app"
-	"github.com/planetary-social/scuttlego/service/app/commands"
 	"github.com/planetary-social/scuttlego/service/app/queries"
-	"github.com/planetary-social/scuttlego/service/di"
 	"github.com/planetary-social/scuttlego/service/domain"
-	"github.com/planetary-social/scuttlego/service/domain/feeds/formats"
 	"github.com/planetary-social/scuttlego/service/domain/graph"
 	"github.com/planetary-social/scuttlego/service/domain/identity"
 	"github.com/planetary-social/scuttlego/service/domain/refs"
-	"github.com/planetary-social/scuttlego/service/domain/transport/boxstream"
 )
 
-var ErrNodeIsNotRunning = errors.New("node isn't running")
+var (
+	ErrNodeIsNotRunning = errors.New("node isn't running")
+	ErrNodeIsSuspended  = errors.New("node is suspended")
+)
 
 const (
 	kibibyte = 1024
@@ -40,7 +37,7 @@ const (
 
 type OnBlobDownloadedFn func(downloaded queries.BlobDownloaded) error
 type MigrationOnRunningFn func(migrationIndex, migrationsCount int)
-type MigrationOnErrorFn func(migrationIndex, migrationsCount, error int)
+type MigrationOnErrorFn func(migrationIndex, migrationsCount int, code MigrationErrorCode, err error)
 type MigrationOnDoneFn func(migrationsCount int)
 
 type BotConfig struct {
@@ -56,6 +53,37 @@ type BotConfig struct {
 	OldRepo    string `json:"oldRepo"`
 	ListenAddr string `json:"listenAddr"`
 	Testing    bool   `json:"testing"`
+
+	// SchemaVersion must be equal to BotConfigSchemaVersion.
+	SchemaVersion int `json:"schemaVersion"`
+
+	// MaxServiceRestarts specifies how many times in a row the service will
+	// be restarted if it terminates unexpectedly before the node gives up.
+	// Optional, defaults to 5. Pass a negative value to disable restarts.
+	MaxServiceRestarts int `json:"maxServiceRestarts"`
+
+	// PreferredPubs is a list of multiserver addresses of pubs which the
+	// peer manager will try to remain connected to. Scuttlego reconnects to
+	// them every 15 seconds and doesn't support limiting the number of
+	// connections. Optional.
+	PreferredPubs []string `json:"preferredPubs"`
+
+	// MaxConnections and ReconnectIntervalSeconds would complete the
+	// connection policy but scuttlego v0.0.4 doesn't support them. Its peer
+	// manager doesn't limit the number of connections and reconnects to the
+	// preferred pubs every 15 seconds. Configs which set them to anything
+	// other than zero are rejected.
+	MaxConnections           int `json:"maxConnections"`
+	ReconnectIntervalSeconds int `json:"reconnectIntervalSeconds"`
+
+	// StorageProfile selects the Badger options suited for a particular
+	// kind of device. One of "low-memory", "balanced" or "throughput".
+	// Optional, defaults to "balanced".
+	StorageProfile string `json:"storageProfile"`
+
+	// StorageOptions overrides individual options of the storage profile.
+	// Optional.
+	StorageOptions *StorageOptions `json:"storageOptions"`
 }
 
 type Service struct {
@@ -64,18 +92,57 @@ type Service struct {
 }
 
 type Node struct {
-	mutex sync.Mutex
+	mutex            sync.Mutex
+	reconfigureMutex sync.Mutex
+	blobsMutex       sync.Mutex
+
+	// memoryPressureMutex serializes applying the memory pressure.
+	memoryPressureMutex sync.Mutex
 
 	ctx        context.Context
 	service    *service.Service
 	cancel     context.CancelFunc
-	cleanup    func()
 	repository string
-	wg         *sync.WaitGroup
+	restarts   int
+	done       chan struct{}
+	lifecycle  *lifecycle
+	migrations *migrationCanceller
+	crashes    *crashReporter
+
+	subscriptions *receiveLogSubscriptions
+	receiveLog    *receiveLogNotifier
+	index         *index
+	indexCancel   context.CancelFunc
+	indexDone     chan struct{}
+
+	config  BotConfig
+	builder serviceBuilder
+	log     bindingslogging.Logger
+	reloads chan reloadRequest
+
+	suspended bool
+	resumed   chan struct{}
+	cancelRun context.CancelFunc
+
+	// run identifies the current run of the service and suspendedRun the
+	// last run which was stopped by Suspend. They make it possible to tell
+	// whether a run was suspended even if the node was resumed already.
+	run          int
+	suspendedRun int
+
+	memoryPressure    MemoryPressure
+	deferredBlobWants []refs.Blob
 }
 
 func NewNode() *Node {
-	return &Node{}
+	return &Node{
+		lifecycle:  newLifecycle(),
+		migrations: newMigrationCanceller(),
+		crashes:    newCrashReporter(),
+
+		subscriptions: newReceiveLogSubscriptions(),
+		receiveLog:    newReceiveLogNotifier(),
+	}
 }
 
 func (n *Node) Start(
@@ -85,6 +152,9 @@ func (n *Node) Start(
 	migrationOnRunningFn MigrationOnRunningFn,
 	migrationOnErrorFn MigrationOnErrorFn,
 	migrationOnDoneFn MigrationOnDoneFn,
+	migrationOnProgressFn MigrationOnProgressFn,
+	indexOnProgressFn IndexOnProgressFn,
+	onStateChanged OnStateChangedFn,
 ) error {
 	n.mutex.Lock()
 	defer n.mutex.Unlock()
@@ -93,9 +163,31 @@ func (n *Node) Start(
 		return errors.New("node is already running")
 	}
 
-	privateIdentity, err := n.toIdentity(swiftConfig)
+	n.lifecycle.SetCallback(onStateChanged)
+
+	if err := n.start(swiftConfig, log, onBlobDownloaded, migrationOnRunningFn, migrationOnErrorFn, migrationOnDoneFn, migrationOnProgressFn, indexOnProgressFn); err != nil {
+		n.lifecycle.Set(NodeStateStopped, errorCode(err))
+		return err
+	}
+
+	return nil
+}
+
+func (n *Node) start(
+	swiftConfig BotConfig,
+	log bindingslogging.Logger,
+	onBlobDownloaded OnBlobDownloadedFn,
+	migrationOnRunningFn MigrationOnRunningFn,
+	migrationOnErrorFn MigrationOnErrorFn,
+	migrationOnDoneFn MigrationOnDoneFn,
+	migrationOnProgressFn MigrationOnProgressFn,
+	indexOnProgressFn IndexOnProgressFn,
+) error {
+	n.crashes.SetConfig(swiftConfig)
+
+	privateIdentity, err := toIdentity(swiftConfig)
 	if err != nil {
-		return errors.Wrap(err, "could not create the identity")
+		return newNodeError(NodeErrorInvalidConfig, errors.Wrap(err, "could not create the identity"))
 	}
 
 	publicIdentityRef, err := refs.NewIdentityFromPublic(privateIdentity.Public())
@@ -105,68 +197,116 @@ func (n *Node) Start(
 
 	log.Debug().WithField("identity", publicIdentityRef).Message("building service")
 
+	boxKeyPair, err := newBoxKeyPair(privateIdentity)
+	if err != nil {
+		return errors.Wrap(err, "could not create the private-box key pair")
+	}
+
 	config, err := n.toConfig(swiftConfig, log)
 	if err != nil {
-		return errors.Wrap(err, "could not convert the config")
+		return newNodeError(NodeErrorInvalidConfig, errors.Wrap(err, "could not convert the config"))
 	}
 
 	if err = os.MkdirAll(config.DataDirectory, 0700); err != nil {
 		return errors.Wrap(err, "could not create the data directory")
 	}
 
+	builder := serviceBuilder{
+		privateIdentity:       privateIdentity,
+		config:                config,
+		lifecycle:             n.lifecycle,
+		log:                   log,
+		migrationOnRunningFn:  migrationOnRunningFn,
+		migrationOnErrorFn:    migrationOnErrorFn,
+		migrationOnDoneFn:     migrationOnDoneFn,
+		migrationOnProgressFn: migrationOnProgressFn,
+		migrationCanceller:    n.migrations,
+		crashes:               n.crashes,
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
-	service, cleanup, err := di.BuildService(privateIdentity, config)
+	n.lifecycle.Set(NodeStateBuilding, NodeErrorNone)
+
+	service, cleanup, err := builder.Build(ctx)
 	if err != nil {
 		cancel()
 		return errors.Wrap(err, "error building service")
 	}
 
-	if err := n.runMigrations(ctx, service, migrationOnRunningFn, migrationOnErrorFn, migrationOnDoneFn); err != nil {
-		cancel()
-		cleanup()
-		return errors.Wrap(err, "error running migrations")
-	}
-
 	n.ctx = ctx
 	n.service = &service
 	n.cancel = cancel
-	n.cleanup = cleanup
 	n.repository = config.DataDirectory
-	n.wg = &sync.WaitGroup{}
+	n.restarts = 0
+	n.done = make(chan struct{})
+	n.config = swiftConfig
+	n.builder = builder
+	n.log = log
+	n.reloads = make(chan reloadRequest)
+	n.memoryPressure = MemoryPressureNormal
+	n.deferredBlobWants = nil
 
-	go n.printStats(ctx, log, service)
+	n.openIndex(ctx, swiftConfig, boxKeyPair, log, indexOnProgressFn)
 
-	n.wg.Add(1)
-	go func() {
-		defer n.wg.Done()
+	n.lifecycle.Set(NodeStateRunning, NodeErrorNone)
 
-		for event := range service.App.Queries.BlobDownloadedEvents.Handle(ctx) {
-			logger := log.WithField("blob", event.Id).WithField("size", event.Size.InBytes())
-			if err := onBlobDownloaded(event); err != nil {
-				logger.Error().WithField(bindingslogging.ErrorField, err).Message("error calling onBlobDownloaded")
-			} else {
-				logger.Debug().Message("called onBlobDownloaded")
-			}
-		}
-	}()
+	supervisor := newSupervisor(n, builder, log, onBlobDownloaded, swiftConfig.MaxServiceRestarts, n.reloads)
+	go supervisor.Run(ctx, service, cleanup)
+
+	return nil
+}
 
-	n.wg.Add(1)
-	go func() {
-		defer n.wg.Done()
+// Stop cancels the node's context and waits for the supervisor to end the
+// subscriptions, shut down the service and release its resources. It must
+// not be called from within the callback of a subscription.
+func (n *Node) Stop() error {
+	n.mutex.Lock()
 
-		if err := service.Run(ctx); err != nil {
-			if !errors.Is(err, context.Canceled) {
-				log.Error().WithField(bindingslogging.ErrorField, err).Message("service terminated with an error")
-			}
-			// todo what to do if the service terminates for some reason? should it be restarted or should we just cleanup node?
-		}
-	}()
+	if !n.isRunning() {
+		n.mutex.Unlock()
+		return ErrNodeIsNotRunning
+	}
+
+	n.lifecycle.Set(NodeStateStopping, NodeErrorNone)
+
+	n.cancel()
+	done := n.done
+
+	n.mutex.Unlock()
+
+	<-done
 
 	return nil
 }
 
-func (n *Node) Stop() error {
+// CancelMigrations cancels the migrations which are currently running. The
+// node stops and the cancelled migration resumes the next time the node is
+// started.
+func (n *Node) CancelMigrations() error {
+	return n.migrations.Cancel()
+}
+
+// ReportCrash synchronously writes a crash report to the debug directory of
+// the repository which the node was last started with.
+func (n *Node) ReportCrash(source string, panicValue any, stack []byte) error {
+	return n.crashes.Report(source, panicValue, stack)
+}
+
+// TakeCrashReport returns the last crash report and removes it. It returns
+// nil if there is no crash report. The node has to be started first so that
+// the location of the repository is known.
+func (n *Node) TakeCrashReport() (*CrashReport, error) {
+	return n.crashes.Take()
+}
+
+// Suspend stops networking without tearing down the node. All peer
+// connections are closed, no new connections are established or accepted and
+// replication and blob downloads are paused. The storage remains open so
+// queries continue to work and the index keeps up with local publishes. Suspending a node which is already suspended has
+// no effect. If the peers can't be disconnected the node is resumed again and
+// the error is returned.
+func (n *Node) Suspend() error {
 	n.mutex.Lock()
 	defer n.mutex.Unlock()
 
@@ -174,27 +314,69 @@ func (n *Node) Stop() error {
 		return ErrNodeIsNotRunning
 	}
 
-	n.cancel()
-	n.cleanup()
+	if n.suspended {
+		return nil
+	}
 
-	n.wg.Wait()
+	n.suspended = true
+	n.resumed = make(chan struct{})
 
-	n.ctx = nil
-	n.service = nil
-	n.cancel = nil
-	n.repository = ""
-	n.cleanup = nil
-	n.wg = nil
+	if n.cancelRun != nil {
+		n.cancelRun()
+		n.suspendedRun = n.run
+	}
+
+	n.lifecycle.Set(NodeStateSuspended, NodeErrorNone)
+
+	if err := n.service.App.Commands.DisconnectAll.Handle(); err != nil {
+		n.resume()
+		return errors.Wrap(err, "error disconnecting peers")
+	}
 
 	return nil
 }
 
+// Resume restarts networking of a suspended node. Resuming a node which isn't
+// suspended has no effect.
+func (n *Node) Resume() error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if !n.isRunning() {
+		return ErrNodeIsNotRunning
+	}
+
+	if !n.suspended {
+		return nil
+	}
+
+	n.resume()
+	return nil
+}
+
+// resume lets the supervisor run the service again. It must be called with
+// the node's mutex held.
+func (n *Node) resume() {
+	n.suspended = false
+	close(n.resumed)
+	n.resumed = nil
+
+	n.lifecycle.Set(NodeStateRunning, NodeErrorNone)
+}
+
+func (n *Node) IsSuspended() bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return n.suspended
+}
+
 func (n *Node) Repository() (string, error) {
 	n.mutex.Lock()
 	defer n.mutex.Unlock()
 
 	if !n.isRunning() {
-		return "", errors.New("node isn't running")
+		return "", ErrNodeIsNotRunning
 	}
 
 	return n.repository, nil
@@ -205,7 +387,7 @@ func (n *Node) Get() (*Service, error) {
 	defer n.mutex.Unlock()
 
 	if !n.isRunning() {
-		return nil, errors.New("node isn't running")
+		return nil, ErrNodeIsNotRunning
 	}
 
 	return &Service{
@@ -221,58 +403,137 @@ func (n *Node) IsRunning() bool {
 	return n.isRunning()
 }
 
+// State returns the current lifecycle state of the node. Unlike other methods
+// it can be safely called from the state change callback.
+func (n *Node) State() NodeState {
+	return n.lifecycle.State()
+}
+
+// Restarts returns the number of times the service was restarted by the
+// supervisor since the node was started.
+func (n *Node) Restarts() int {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return n.restarts
+}
+
 func (n *Node) isRunning() bool {
 	return n.service != nil
 }
 
-func (n *Node) runMigrations(
-	ctx context.Context,
-	service service.Service,
-	migrationOnRunningFn MigrationOnRunningFn,
-	migrationOnErrorFn MigrationOnErrorFn,
-	migrationOnDoneFn MigrationOnDoneFn,
-) error {
-	progressCallback, err := NewProgressCallback(migrationOnRunningFn, migrationOnErrorFn, migrationOnDoneFn)
-	if err != nil {
-		return errors.Wrap(err, "error creating the progress callback")
+// replaceService is called by the supervisor after the service was rebuilt
+// either because it terminated unexpectedly or because the node was
+// reconfigured.
+func (n *Node) replaceService(service *service.Service, restarted bool) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.service = service
+	if restarted {
+		n.restarts++
 	}
 
-	migrationsCmd, err := commands.NewRunMigrations(progressCallback)
-	if err != nil {
-		return errors.Wrap(err, "error creating the migration command")
+	if n.suspended {
+		n.lifecycle.Set(NodeStateSuspended, NodeErrorNone)
+	} else {
+		n.lifecycle.Set(NodeStateRunning, NodeErrorNone)
 	}
+}
+
+// beginRun is called by the supervisor before running the service. If the
+// node is suspended the service shouldn't be run and the returned channel is
+// closed once the node is resumed. Otherwise the provided function is used
+// to stop the service when the node is suspended and the returned number
+// identifies the run.
+func (n *Node) beginRun(cancelRun context.CancelFunc) (<-chan struct{}, int, bool) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
 
-	if err := service.App.Commands.RunMigrations.Run(ctx, migrationsCmd); err != nil {
-		return errors.Wrap(err, "error running migrations")
+	if n.suspended {
+		return n.resumed, 0, true
 	}
 
-	return nil
+	n.run++
+	n.cancelRun = cancelRun
+	return nil, n.run, false
+}
+
+// endRun is called by the supervisor after the given run of the service
+// stops. It returns true if the run was stopped because the node was
+// suspended, even if the node was resumed since then.
+func (n *Node) endRun(run int) bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.cancelRun = nil
+	return n.suspendedRun == run
+}
+
+// clear is called by the supervisor once the service was shut down and its
+// resources were released. The node transitions to the given state.
+func (n *Node) clear(state NodeState, errorCode NodeErrorCode) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.cancel()
+	n.lifecycle.Set(state, errorCode)
+
+	if len(n.deferredBlobWants) > 0 {
+		n.log.Debug().WithField("blobs", len(n.deferredBlobWants)).Message("dropping deferred blob downloads")
+	}
+
+	n.ctx = nil
+	n.service = nil
+	n.cancel = nil
+	n.repository = ""
+	n.suspended = false
+	n.resumed = nil
+	n.cancelRun = nil
+	n.run = 0
+	n.suspendedRun = 0
+	n.config = BotConfig{}
+	n.builder = serviceBuilder{}
+	n.log = nil
+	n.reloads = nil
+	n.memoryPressure = MemoryPressureNormal
+	n.deferredBlobWants = nil
+	close(n.done)
+	n.done = nil
 }
 
 func (n *Node) toConfig(swiftConfig BotConfig, bindingsLogger bindingslogging.Logger) (service.Config, error) {
-	networkKeyBytes, err := base64.StdEncoding.DecodeString(swiftConfig.NetworkKey)
+	networkKey, err := decodeNetworkKey(swiftConfig.NetworkKey)
 	if err != nil {
-		return service.Config{}, errors.Wrap(err, "failed to decode network key")
+		return service.Config{}, errors.Wrap(err, "invalid network key")
 	}
 
-	networkKey, err := boxstream.NewNetworkKey(networkKeyBytes)
+	messageHMAC, err := decodeMessageHMAC(swiftConfig.HMACKey)
 	if err != nil {
-		return service.Config{}, errors.Wrap(err, "failed to create network key")
+		return service.Config{}, errors.Wrap(err, "invalid message hmac")
 	}
 
-	messageHMACBytes, err := base64.StdEncoding.DecodeString(swiftConfig.HMACKey)
+	hops, err := graph.NewHops(swiftConfig.Hops)
 	if err != nil {
-		return service.Config{}, errors.Wrap(err, "failed to decode message hmac")
+		return service.Config{}, errors.Wrap(err, "error creating hops")
 	}
 
-	messageHMAC, err := formats.NewMessageHMAC(messageHMACBytes)
+	storage, err := newStorageSettings(swiftConfig)
 	if err != nil {
-		return service.Config{}, errors.Wrap(err, "failed to create message hmac")
+		return service.Config{}, errors.Wrap(err, "error creating storage settings")
 	}
 
-	hops, err := graph.NewHops(swiftConfig.Hops)
+	preferredPubs, err := parsePreferredPubs(swiftConfig.PreferredPubs)
 	if err != nil {
-		return service.Config{}, errors.Wrap(err, "error creating hops")
+		return service.Config{}, errors.Wrap(err, "invalid preferred pubs")
+	}
+
+	if err := validateUnsupportedSetting(swiftConfig.MaxConnections); err != nil {
+		return service.Config{}, errors.Wrap(err, "invalid max connections")
+	}
+
+	if err := validateUnsupportedSetting(swiftConfig.ReconnectIntervalSeconds); err != nil {
+		return service.Config{}, errors.Wrap(err, "invalid reconnect interval")
 	}
 
 	config := service.Config{
@@ -283,18 +544,12 @@ func (n *Node) toConfig(swiftConfig BotConfig, bindingsLogger bindingslogging.Lo
 		MessageHMAC:        messageHMAC,
 		LoggingSystem:      bindingsLogger,
 		PeerManagerConfig: domain.PeerManagerConfig{
-			PreferredPubs: nil,
+			PreferredPubs: preferredPubs,
 		},
 		Hops: &hops,
 		ModifyBadgerOptions: func(options service.BadgerOptions) {
-			options.SetNumGoroutines(2)
-			options.SetNumCompactors(2)
-			options.SetCompression(badgeroptions.ZSTD)
-			options.SetLogger(badger.NewLogger(bindingsLogger, badger.LoggerLevelInfo))
-			options.SetValueLogFileSize(32 * mebibyte)
-			options.SetBlockCacheSize(32 * mebibyte)
-			options.SetIndexCacheSize(0)
-			options.SetSyncWrites(true)
+			storage.Apply(options, bindingsLogger)
+			bindingsLogger.Debug().WithField("options", storage.String()).Message("applied storage options")
 		},
 	}
 
@@ -303,7 +558,7 @@ func (n *Node) toConfig(swiftConfig BotConfig, bindingsLogger bindingslogging.Lo
 	return config, nil
 }
 
-func (n *Node) toIdentity(config BotConfig) (identity.Private, error) {
+func toIdentity(config BotConfig) (identity.Private, error) {
 	var blob identityBlob
 	err := json.Unmarshal([]byte(config.KeyBlob), &blob)
 	if err != nil {
@@ -342,7 +597,8 @@ func (n *Node) printStats(ctx context.Context, logger bindingslogging.Logger, se
 				WithField("messages", stats.NumberOfMessages).
 				WithField("feeds", stats.NumberOfFeeds).
 				WithField("peers", strings.Join(peers, ", ")).
-				WithField("goroutines", runtime.NumGoroutine())
+				WithField("goroutines", runtime.NumGoroutine()).
+				WithField("restarts", n.Restarts())
 
 			if startTimestamp.IsZero() {
 				startTimestamp = time.Now()
@@ -352,11 +608,19 @@ func (n *Node) printStats(ctx context.Context, logger bindingslogging.Logger, se
 				logger = logger.WithField("speed", fmt.Sprintf("%f msgs/min", speed))
 			}
 
-			var m runtime.MemStats
-			runtime.ReadMemStats(&m)
+			m := ReadMemoryStats()
+
+			n.crashes.SetStats(StatsSnapshot{
+				Time:     time.Now(),
+				Messages: stats.NumberOfMessages,
+				Feeds:    stats.NumberOfFeeds,
+				Peers:    len(stats.Peers),
+				Restarts: n.Restarts(),
+				Memory:   m,
+			})
 
-			logger = logger.WithField("mem_alloc", fmt.Sprintf("%v MB", bToMb(m.Alloc)))
-			logger = logger.WithField("mem_sys", fmt.Sprintf("%v MB", bToMb(m.Sys)))
+			logger = logger.WithField("mem_alloc", fmt.Sprintf("%v MB", bToMb(m.AllocBytes)))
+			logger = logger.WithField("mem_sys", fmt.Sprintf("%v MB", bToMb(m.SysBytes)))
 			logger = logger.WithField("mallocs", m.Mallocs)
 			logger = logger.WithField("frees", m.Frees)
 			logger = logger.WithField("gc_cpu_fraction", m.GCCPUFraction)
@@ -0,0 +1,287 @@
+package bindings
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	bindingslogging "verseproj/scuttlegobridge/logging"
+
+	"github.com/boreq/errors"
+	"github.com/planetary-social/scuttlego/service/app/commands"
+	"github.com/planetary-social/scuttlego/service/app/queries"
+	"github.com/planetary-social/scuttlego/service/domain/blobs"
+	"github.com/planetary-social/scuttlego/service/domain/blobs/replication"
+	"github.com/planetary-social/scuttlego/service/domain/refs"
+)
+
+// blobSniffLength is the number of bytes used to detect the type of a blob.
+const blobSniffLength = 512
+
+// ErrBlobTooLarge is returned if an attachment exceeds the maximum blob size.
+var ErrBlobTooLarge = errors.New("blob is too large")
+
+// BlobAttachment is a file attached to a post. Name is optional.
+type BlobAttachment struct {
+	Reader io.ReadSeeker
+	Name   string
+}
+
+type inspectedBlob struct {
+	Ref  refs.Blob
+	Size int64
+	Type string
+}
+
+// PublishPostWithBlobs stores the attachments as blobs and publishes the
+// post mentioning them. The attachments are read once to fill in the
+// mentions and validate the post before anything is stored, a mention which
+// already links to one of the blobs is completed instead of being repeated.
+//
+// Scuttlego doesn't provide a way of removing blobs so if publishing fails
+// the bridge removes the files of the blobs which didn't exist before this
+// call from the blob storage itself. Calls are serialized and a file is only
+// removed if it wasn't replaced since it was stored, for example by
+// replication. Returns the ref of the published message and the mentions of
+// the attachments.
+func (n *Node) PublishPostWithBlobs(post Post, attachments []BlobAttachment) (refs.Message, []Mention, error) {
+	var inspected []inspectedBlob
+	for i, attachment := range attachments {
+		blob, err := inspectBlob(attachment.Reader)
+		if err != nil {
+			return refs.Message{}, nil, errors.Wrapf(err, "error reading attachment %d", i)
+		}
+		inspected = append(inspected, blob)
+	}
+
+	post, mentions := mentionBlobs(post, attachments, inspected)
+
+	content, err := MarshalTypedContent(post)
+	if err != nil {
+		return refs.Message{}, nil, errors.Wrap(err, "invalid content")
+	}
+
+	cmd, err := commands.NewPublishRaw(content)
+	if err != nil {
+		return refs.Message{}, nil, errors.Wrap(err, "error creating the command")
+	}
+
+	n.mutex.Lock()
+	blobDirectory := path.Join(n.config.OldRepo, "blobs")
+	log := n.log
+	n.mutex.Unlock()
+
+	service, err := n.Get()
+	if err != nil {
+		return refs.Message{}, nil, errors.Wrap(err, "error getting the service")
+	}
+
+	// Posts with blobs are published one at a time so that a post which
+	// failed to publish can't remove a blob stored for another one.
+	n.blobsMutex.Lock()
+	defer n.blobsMutex.Unlock()
+
+	created := newCreatedBlobs(blobDirectory)
+	rollback := func() {
+		created.Remove(log)
+	}
+
+	for i, attachment := range attachments {
+		existed, err := hasBlob(service, inspected[i].Ref)
+		if err != nil {
+			rollback()
+			return refs.Message{}, nil, errors.Wrapf(err, "error checking if attachment %d is already stored", i)
+		}
+
+		if _, err := attachment.Reader.Seek(0, io.SeekStart); err != nil {
+			rollback()
+			return refs.Message{}, nil, errors.Wrapf(err, "error rewinding attachment %d", i)
+		}
+
+		ref, err := service.App.Commands.CreateBlob.Handle(commands.CreateBlob{Reader: attachment.Reader})
+		if err != nil {
+			rollback()
+			return refs.Message{}, nil, errors.Wrapf(err, "error storing attachment %d", i)
+		}
+
+		if !existed {
+			if err := created.Add(ref); err != nil {
+				rollback()
+				return refs.Message{}, nil, errors.Wrapf(err, "error recording attachment %d", i)
+			}
+		}
+
+		if !ref.Equal(inspected[i].Ref) {
+			rollback()
+			return refs.Message{}, nil, fmt.Errorf("attachment %d changed while it was being stored", i)
+		}
+	}
+
+	id, err := service.App.Commands.PublishRaw.Handle(cmd)
+	if err != nil {
+		rollback()
+		return refs.Message{}, nil, errors.Wrap(err, "error publishing")
+	}
+
+	n.receiveLog.publish()
+	return id, mentions, nil
+}
+
+func inspectBlob(r io.ReadSeeker) (inspectedBlob, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return inspectedBlob{}, errors.Wrap(err, "error rewinding")
+	}
+
+	h := blobs.NewHasher()
+	sniff := make([]byte, blobSniffLength)
+
+	sniffed, err := io.ReadFull(io.TeeReader(r, h), sniff)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return inspectedBlob{}, errors.Wrap(err, "error reading")
+	}
+
+	rest, err := io.Copy(h, io.LimitReader(r, blobs.MaxBlobSize().InBytes()-int64(sniffed)+1))
+	if err != nil {
+		return inspectedBlob{}, errors.Wrap(err, "error reading")
+	}
+
+	size := int64(sniffed) + rest
+	if size > blobs.MaxBlobSize().InBytes() {
+		return inspectedBlob{}, ErrBlobTooLarge
+	}
+
+	ref, err := h.SumRef()
+	if err != nil {
+		return inspectedBlob{}, errors.Wrap(err, "error calculating the ref")
+	}
+
+	return inspectedBlob{
+		Ref:  ref,
+		Size: size,
+		Type: http.DetectContentType(sniff[:sniffed]),
+	}, nil
+}
+
+// mentionBlobs returns the post with the mentions of the blobs filled in
+// and the mentions themselves in the order of the attachments.
+func mentionBlobs(post Post, attachments []BlobAttachment, inspected []inspectedBlob) (Post, []Mention) {
+	post.Mentions = append([]Mention(nil), post.Mentions...)
+
+	var mentions []Mention
+	for i, blob := range inspected {
+		mention := Mention{
+			Link: blob.Ref.String(),
+			Name: attachments[i].Name,
+			Size: int(blob.Size),
+			Type: blob.Type,
+		}
+
+		j := findMention(post.Mentions, mention.Link)
+		if j < 0 {
+			post.Mentions = append(post.Mentions, mention)
+		} else {
+			if post.Mentions[j].Name == "" {
+				post.Mentions[j].Name = mention.Name
+			}
+			post.Mentions[j].Size = mention.Size
+			post.Mentions[j].Type = mention.Type
+			mention = post.Mentions[j]
+		}
+
+		mentions = append(mentions, mention)
+	}
+
+	return post, mentions
+}
+
+func findMention(mentions []Mention, link string) int {
+	for i, mention := range mentions {
+		if mention.Link == link {
+			return i
+		}
+	}
+	return -1
+}
+
+func hasBlob(service *Service, ref refs.Blob) (bool, error) {
+	maxSize := blobs.MaxBlobSize()
+
+	rc, err := service.App.Queries.GetBlob.Handle(queries.GetBlob{Id: ref, Max: &maxSize})
+	if err != nil {
+		if errors.Is(err, replication.ErrBlobNotFound) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "query failed")
+	}
+
+	return true, rc.Close()
+}
+
+// createdBlobs records the files of the blobs stored by PublishPostWithBlobs
+// so that they can be removed if publishing fails.
+type createdBlobs struct {
+	directory string
+	files     []createdBlob
+}
+
+type createdBlob struct {
+	Ref  refs.Blob
+	Info os.FileInfo
+}
+
+func newCreatedBlobs(directory string) *createdBlobs {
+	return &createdBlobs{directory: directory}
+}
+
+func (c *createdBlobs) Add(ref refs.Blob) error {
+	info, err := os.Stat(blobStoragePath(c.directory, ref))
+	if err != nil {
+		return errors.Wrap(err, "stat failed")
+	}
+
+	c.files = append(c.files, createdBlob{Ref: ref, Info: info})
+	return nil
+}
+
+// Remove removes the recorded files. Scuttlego stores blobs by renaming a
+// temporary file so a file which was stored again since it was recorded is
+// a different file and is left alone.
+func (c *createdBlobs) Remove(log bindingslogging.Logger) {
+	for _, file := range c.files {
+		if err := c.remove(file); err != nil && log != nil {
+			log.Error().WithField(bindingslogging.ErrorField, err).WithField("blob", file.Ref.String()).Message("failed to remove a blob")
+		}
+	}
+	c.files = nil
+}
+
+func (c *createdBlobs) remove(file createdBlob) error {
+	name := blobStoragePath(c.directory, file.Ref)
+
+	info, err := os.Stat(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "stat failed")
+	}
+
+	if !os.SameFile(info, file.Info) || !info.ModTime().Equal(file.Info.ModTime()) {
+		return nil
+	}
+
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "remove failed")
+	}
+
+	return nil
+}
+
+// blobStoragePath mirrors the layout of the filesystem blob storage of
+// scuttlego.
+func blobStoragePath(directory string, ref refs.Blob) string {
+	hexRef := hex.EncodeToString(ref.Bytes())
+	return path.Join(directory, "sha256", hexRef[:2], hexRef[2:])
+}
@@ -0,0 +1,117 @@
+package bindings
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/planetary-social/scuttlego/service/domain/blobs"
+	"github.com/planetary-social/scuttlego/service/domain/refs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectBlob(t *testing.T) {
+	data := []byte("\x89PNG\r\n\x1a\n" + strings.Repeat("a", 1000))
+
+	r := bytes.NewReader(data)
+	_, err := r.Seek(10, 0)
+	require.NoError(t, err)
+
+	blob, err := inspectBlob(r)
+	require.NoError(t, err)
+
+	h := blobs.NewHasher()
+	_, err = h.Write(data)
+	require.NoError(t, err)
+	expectedRef, err := h.SumRef()
+	require.NoError(t, err)
+
+	require.Equal(t, expectedRef, blob.Ref)
+	require.Equal(t, int64(len(data)), blob.Size)
+	require.Equal(t, "image/png", blob.Type)
+}
+
+func TestMentionBlobs(t *testing.T) {
+	existing := refs.MustNewBlob(testBlobRef)
+	other := refs.MustNewBlob("&PfeDW9eBb1dS0C5pUZ/zn5pNRPdLxb9C9L1T7zDQH2I=.sha256")
+
+	post := Post{
+		Text:     "hello",
+		Mentions: []Mention{{Link: testFeedRef, Name: "alice"}, {Link: testBlobRef, Name: "photo"}},
+	}
+
+	attachments := []BlobAttachment{{Name: "photo.jpg"}, {Name: "other.png"}}
+	inspected := []inspectedBlob{
+		{Ref: existing, Size: 10, Type: "image/jpeg"},
+		{Ref: other, Size: 20, Type: "image/png"},
+	}
+
+	result, mentions := mentionBlobs(post, attachments, inspected)
+	require.Equal(t,
+		[]Mention{
+			{Link: testBlobRef, Name: "photo", Size: 10, Type: "image/jpeg"},
+			{Link: other.String(), Name: "other.png", Size: 20, Type: "image/png"},
+		},
+		mentions,
+	)
+	require.Equal(t,
+		[]Mention{
+			{Link: testFeedRef, Name: "alice"},
+			{Link: testBlobRef, Name: "photo", Size: 10, Type: "image/jpeg"},
+			{Link: other.String(), Name: "other.png", Size: 20, Type: "image/png"},
+		},
+		result.Mentions,
+	)
+	require.Equal(t, Mention{Link: testBlobRef, Name: "photo"}, post.Mentions[1], "the original post must not be modified")
+}
+
+func TestBlobStoragePath(t *testing.T) {
+	ref := refs.MustNewBlob(testBlobRef)
+	require.Equal(t,
+		"/repo/blobs/sha256/b9/a1a279240325c1df529ea18c8708ab9e46a19878520eed36681aa21a31ae9c",
+		blobStoragePath("/repo/blobs", ref),
+	)
+}
+
+func TestCreatedBlobsRemovesOnlyUntouchedFiles(t *testing.T) {
+	directory := t.TempDir()
+
+	untouched := newTestBlob(t, directory, "untouched")
+	replaced := newTestBlob(t, directory, "replaced")
+	removed := newTestBlob(t, directory, "removed")
+	existing := newTestBlob(t, directory, "existing")
+
+	created := newCreatedBlobs(directory)
+	require.NoError(t, created.Add(untouched))
+	require.NoError(t, created.Add(replaced))
+	require.NoError(t, created.Add(removed))
+
+	// scuttlego stores blobs by renaming temporary files
+	tmp := path.Join(directory, "tmp")
+	require.NoError(t, os.WriteFile(tmp, []byte("replaced"), 0600))
+	require.NoError(t, os.Rename(tmp, blobStoragePath(directory, replaced)))
+
+	require.NoError(t, os.Remove(blobStoragePath(directory, removed)))
+
+	created.Remove(nil)
+
+	require.NoFileExists(t, blobStoragePath(directory, untouched))
+	require.FileExists(t, blobStoragePath(directory, replaced))
+	require.FileExists(t, blobStoragePath(directory, existing))
+}
+
+func newTestBlob(t *testing.T, directory string, data string) refs.Blob {
+	h := blobs.NewHasher()
+	_, err := h.Write([]byte(data))
+	require.NoError(t, err)
+	ref, err := h.SumRef()
+	require.NoError(t, err)
+
+	name := blobStoragePath(directory, ref)
+	require.NoError(t, os.MkdirAll(path.Dir(name), 0700))
+	require.NoError(t, os.WriteFile(name, []byte(data), 0600))
+
+	return ref
+}
@@ -0,0 +1,237 @@
+package bindings
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/boreq/errors"
+	"github.com/planetary-social/scuttlego/service/domain/feeds/formats"
+	"github.com/planetary-social/scuttlego/service/domain/graph"
+	"github.com/planetary-social/scuttlego/service/domain/transport/boxstream"
+	"golang.org/x/sys/unix"
+)
+
+// BotConfigSchemaVersion is the version of the BotConfig JSON schema. It has
+// to be increased every time fields are removed or change meaning so that a
+// stale config is rejected instead of being misinterpreted. Adding optional
+// fields doesn't require increasing it.
+const BotConfigSchemaVersion = 1
+
+var ErrUnsupportedSchemaVersion = errors.New("unsupported config schema version")
+
+// ErrSettingNotSupported is returned for config settings which scuttlego
+// v0.0.4 doesn't support.
+var ErrSettingNotSupported = errors.New("not supported by scuttlego v0.0.4")
+
+// ConfigProblem describes a single problem found by ValidateConfig. Field is
+// the JSON name of the affected field or an empty string if the problem isn't
+// specific to any field.
+type ConfigProblem struct {
+	Field   string `json:"field"`
+	Problem string `json:"problem"`
+}
+
+// DecodeBotConfig decodes the config rejecting unknown fields and configs
+// with a schema version other than BotConfigSchemaVersion.
+func DecodeBotConfig(data []byte) (BotConfig, error) {
+	var config BotConfig
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return BotConfig{}, errors.Wrap(err, "error decoding the config")
+	}
+
+	if config.SchemaVersion != BotConfigSchemaVersion {
+		return BotConfig{}, errors.Wrapf(ErrUnsupportedSchemaVersion, "got '%d', expected '%d'", config.SchemaVersion, BotConfigSchemaVersion)
+	}
+
+	return config, nil
+}
+
+// ValidateConfig decodes the config and checks all of its fields. Unlike
+// starting the node it doesn't stop at the first problem. Validation has no
+// side effects, in particular the repository isn't created and the listen
+// address isn't bound. An empty slice is returned if the config is valid.
+func ValidateConfig(data []byte) []ConfigProblem {
+	problems := make([]ConfigProblem, 0)
+
+	config, err := DecodeBotConfig(data)
+	if err != nil {
+		return append(problems, decodingProblem(err))
+	}
+
+	check := func(field string, err error) {
+		if err != nil {
+			problems = append(problems, ConfigProblem{Field: field, Problem: err.Error()})
+		}
+	}
+
+	check("networkKey", validateNetworkKey(config.NetworkKey))
+	check("hmacKey", validateMessageHMAC(config.HMACKey))
+	check("keyBlob", validateKeyBlob(config))
+	check("hops", validateHops(config.Hops))
+	check("repo", validateRepo(config.Repo))
+	check("listenAddr", validateListenAddr(config.ListenAddr))
+	check("maxConnections", validateUnsupportedSetting(config.MaxConnections))
+	check("reconnectIntervalSeconds", validateUnsupportedSetting(config.ReconnectIntervalSeconds))
+
+	for _, multiserverAddress := range config.PreferredPubs {
+		if _, _, err := MultiserverAddressToAddressAndRef(multiserverAddress); err != nil {
+			check("preferredPubs", errors.Wrapf(err, "invalid address '%s'", multiserverAddress))
+		}
+	}
+
+	if _, err := storageProfileSettings(config.StorageProfile); err != nil {
+		check("storageProfile", err)
+	} else {
+		_, err := newStorageSettings(config)
+		check("storageOptions", err)
+	}
+
+	return problems
+}
+
+func decodingProblem(err error) ConfigProblem {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return ConfigProblem{Field: typeErr.Field, Problem: err.Error()}
+	}
+
+	if errors.Is(err, ErrUnsupportedSchemaVersion) {
+		return ConfigProblem{Field: "schemaVersion", Problem: err.Error()}
+	}
+
+	// encoding/json doesn't export a type for this error.
+	const unknownFieldPrefix = "json: unknown field "
+	if i := strings.Index(err.Error(), unknownFieldPrefix); i >= 0 {
+		if field, unquoteErr := strconv.Unquote(err.Error()[i+len(unknownFieldPrefix):]); unquoteErr == nil {
+			return ConfigProblem{Field: field, Problem: "unknown field"}
+		}
+	}
+
+	return ConfigProblem{Problem: err.Error()}
+}
+
+func decodeNetworkKey(s string) (boxstream.NetworkKey, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return boxstream.NetworkKey{}, errors.Wrap(err, "failed to decode base64")
+	}
+
+	networkKey, err := boxstream.NewNetworkKey(b)
+	if err != nil {
+		return boxstream.NetworkKey{}, errors.Wrap(err, "failed to create network key")
+	}
+
+	return networkKey, nil
+}
+
+func decodeMessageHMAC(s string) (formats.MessageHMAC, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return formats.MessageHMAC{}, errors.Wrap(err, "failed to decode base64")
+	}
+
+	messageHMAC, err := formats.NewMessageHMAC(b)
+	if err != nil {
+		return formats.MessageHMAC{}, errors.Wrap(err, "failed to create message hmac")
+	}
+
+	return messageHMAC, nil
+}
+
+func validateNetworkKey(s string) error {
+	_, err := decodeNetworkKey(s)
+	return err
+}
+
+func validateMessageHMAC(s string) error {
+	_, err := decodeMessageHMAC(s)
+	return err
+}
+
+func validateKeyBlob(config BotConfig) error {
+	_, err := toIdentity(config)
+	return err
+}
+
+func validateHops(hops int) error {
+	_, err := graph.NewHops(hops)
+	return err
+}
+
+// validateRepo checks that the repository is a directory which can be
+// written to or that it can be created. Nothing is created.
+func validateRepo(repo string) error {
+	if repo == "" {
+		return errors.New("repo is required")
+	}
+
+	directory := filepath.Clean(repo)
+	for {
+		fi, err := os.Stat(directory)
+		if err == nil {
+			if !fi.IsDir() {
+				return fmt.Errorf("'%s' isn't a directory", directory)
+			}
+			break
+		}
+
+		if !os.IsNotExist(err) {
+			return errors.Wrap(err, "stat failed")
+		}
+
+		parent := filepath.Dir(directory)
+		if parent == directory {
+			return errors.New("no parent directory exists")
+		}
+		directory = parent
+	}
+
+	if err := unix.Access(directory, unix.W_OK|unix.X_OK); err != nil {
+		return errors.Wrapf(err, "directory '%s' isn't writable", directory)
+	}
+
+	return nil
+}
+
+func validateUnsupportedSetting(value int) error {
+	if value != 0 {
+		return ErrSettingNotSupported
+	}
+	return nil
+}
+
+// validateListenAddr checks that the host of the listen address can be
+// resolved, so host names such as localhost are accepted, and that the port
+// is a number as scuttlego requires for local advertisements. Whether the
+// address can be bound isn't checked as the port may be used by a node which
+// is already running.
+func validateListenAddr(listenAddr string) error {
+	if listenAddr == "" {
+		return nil
+	}
+
+	if _, err := net.ResolveTCPAddr("tcp", listenAddr); err != nil {
+		return errors.Wrap(err, "invalid address")
+	}
+
+	_, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return errors.Wrap(err, "invalid address")
+	}
+
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return fmt.Errorf("invalid port '%s'", port)
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package bindings
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/planetary-social/scuttlego/service/domain/identity"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeBotConfig(t *testing.T) {
+	testCases := []struct {
+		Name            string
+		Config          string
+		ExpectedFailure bool
+	}{
+		{
+			Name:   "valid",
+			Config: `{"schemaVersion": 1, "hops": 2}`,
+		},
+		{
+			Name:            "missing_schema_version",
+			Config:          `{"hops": 2}`,
+			ExpectedFailure: true,
+		},
+		{
+			Name:            "unsupported_schema_version",
+			Config:          `{"schemaVersion": 2, "hops": 2}`,
+			ExpectedFailure: true,
+		},
+		{
+			Name:            "unknown_field",
+			Config:          `{"schemaVersion": 1, "hop": 2}`,
+			ExpectedFailure: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			_, err := DecodeBotConfig([]byte(testCase.Config))
+			if testCase.ExpectedFailure {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	valid := func(t *testing.T) map[string]any {
+		private, err := identity.NewPrivate()
+		require.NoError(t, err)
+
+		keyBlob, err := json.Marshal(identityBlob{
+			Private: base64.StdEncoding.EncodeToString(private.PrivateKey()) + ".ed25519",
+		})
+		require.NoError(t, err)
+
+		return map[string]any{
+			"schemaVersion": BotConfigSchemaVersion,
+			"networkKey":    base64.StdEncoding.EncodeToString(make([]byte, 32)),
+			"hmacKey":       "",
+			"keyBlob":       string(keyBlob),
+			"repo":          t.TempDir(),
+			"listenAddr":    "127.0.0.1:0",
+			"hops":          2,
+		}
+	}
+
+	testCases := []struct {
+		Name             string
+		Modify           func(config map[string]any)
+		ExpectedProblems []string
+	}{
+		{
+			Name:             "valid",
+			Modify:           func(config map[string]any) {},
+			ExpectedProblems: nil,
+		},
+		{
+			Name: "all_field_problems_are_reported",
+			Modify: func(config map[string]any) {
+				config["networkKey"] = "not base64"
+				config["hmacKey"] = base64.StdEncoding.EncodeToString(make([]byte, 5))
+				config["keyBlob"] = "{}"
+				config["hops"] = -1
+				config["repo"] = ""
+			},
+			ExpectedProblems: []string{"networkKey", "hmacKey", "keyBlob", "hops", "repo"},
+		},
+		{
+			Name: "invalid_listen_addr",
+			Modify: func(config map[string]any) {
+				config["listenAddr"] = "localhost"
+			},
+			ExpectedProblems: []string{"listenAddr"},
+		},
+		{
+			Name: "unsupported_connection_policy",
+			Modify: func(config map[string]any) {
+				config["maxConnections"] = 5
+				config["reconnectIntervalSeconds"] = 30
+			},
+			ExpectedProblems: []string{"maxConnections", "reconnectIntervalSeconds"},
+		},
+		{
+			Name: "schema_version",
+			Modify: func(config map[string]any) {
+				delete(config, "schemaVersion")
+			},
+			ExpectedProblems: []string{"schemaVersion"},
+		},
+		{
+			Name: "unknown_field",
+			Modify: func(config map[string]any) {
+				config["hop"] = 2
+			},
+			ExpectedProblems: []string{"hop"},
+		},
+		{
+			Name: "wrong_type",
+			Modify: func(config map[string]any) {
+				config["hops"] = "2"
+			},
+			ExpectedProblems: []string{"hops"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			config := valid(t)
+			testCase.Modify(config)
+
+			data, err := json.Marshal(config)
+			require.NoError(t, err)
+
+			var fields []string
+			for _, problem := range ValidateConfig(data) {
+				require.NotEmpty(t, problem.Problem)
+				fields = append(fields, problem.Field)
+			}
+
+			require.Equal(t, testCase.ExpectedProblems, fields)
+		})
+	}
+}
+
+func TestValidateConfigHasNoSideEffects(t *testing.T) {
+	repo := filepath.Join(t.TempDir(), "nested", "repo")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	require.NoError(t, validateRepo(repo))
+	require.NoError(t, validateListenAddr(listener.Addr().String()))
+
+	_, err = os.Stat(filepath.Dir(repo))
+	require.True(t, os.IsNotExist(err), "the repository shouldn't be created")
+}
+
+func TestValidateListenAddr(t *testing.T) {
+	for _, listenAddr := range []string{"", ":8008", "127.0.0.1:8008", "[::1]:8008", "localhost:8008"} {
+		require.NoError(t, validateListenAddr(listenAddr), listenAddr)
+	}
+
+	for _, listenAddr := range []string{"localhost", "localhost:http", "127.0.0.1:65536"} {
+		require.Error(t, validateListenAddr(listenAddr), listenAddr)
+	}
+}
+
+func TestValidateRepoRejectsFiles(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0600))
+
+	require.Error(t, validateRepo(file))
+	require.Error(t, validateRepo(filepath.Join(file, "repo")))
+}
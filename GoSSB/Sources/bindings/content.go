@@ -0,0 +1,461 @@
+package bindings
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/boreq/errors"
+	"github.com/planetary-social/scuttlego/service/app/commands"
+	"github.com/planetary-social/scuttlego/service/domain/refs"
+)
+
+const (
+	// MaxMessageSize is the limit enforced by other Scuttlebutt
+	// implementations on the length of a message encoded as JSON indented
+	// with two spaces, counted in UTF-16 code units.
+	MaxMessageSize = 8192
+
+	// messageEnvelopeSize is an upper bound of the size of the fields of a
+	// message other than the content, such as the author and the signature.
+	messageEnvelopeSize = 400
+
+	// MaxContentSize is the limit on the size of the content which ensures
+	// that the message doesn't exceed MaxMessageSize.
+	MaxContentSize = MaxMessageSize - messageEnvelopeSize
+)
+
+// ContentProblem describes a single problem found when validating content.
+// Field is the JSON name of the affected field or an empty string if the
+// problem isn't specific to any field.
+type ContentProblem struct {
+	Field   string `json:"field"`
+	Problem string `json:"problem"`
+}
+
+// ContentValidationError is returned if the content is invalid. It lists all
+// problems instead of stopping at the first one.
+type ContentValidationError struct {
+	Problems []ContentProblem
+}
+
+func (e ContentValidationError) Error() string {
+	var problems []string
+	for _, problem := range e.Problems {
+		if problem.Field == "" {
+			problems = append(problems, problem.Problem)
+		} else {
+			problems = append(problems, fmt.Sprintf("%s: %s", problem.Field, problem.Problem))
+		}
+	}
+	return "invalid content: " + strings.Join(problems, ", ")
+}
+
+// TypedContent is content conforming to one of the well-known schemas which
+// is validated before being published.
+type TypedContent interface {
+	validate(v *contentValidator)
+	marshal() ([]byte, error)
+}
+
+// Post is a message of type post. Root and branch are set for replies. Branch
+// can be decoded from a string or from an array.
+type Post struct {
+	Text     string    `json:"text"`
+	Root     string    `json:"root,omitempty"`
+	Branch   refList   `json:"branch,omitempty"`
+	Mentions []Mention `json:"mentions,omitempty"`
+	Channel  string    `json:"channel,omitempty"`
+}
+
+// Mention links a feed, a message, a blob or a channel from a post.
+type Mention struct {
+	Link string `json:"link"`
+	Name string `json:"name,omitempty"`
+	Size int    `json:"size,omitempty"`
+	Type string `json:"type,omitempty"`
+}
+
+// Contact is a message of type contact. At least one of the fields following
+// and blocking has to be set.
+type Contact struct {
+	Contact   string `json:"contact"`
+	Following *bool  `json:"following,omitempty"`
+	Blocking  *bool  `json:"blocking,omitempty"`
+}
+
+// About is a message of type about describing a feed or a message. At least
+// one of the fields name, description and image has to be set.
+type About struct {
+	About       string  `json:"about"`
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Image       string  `json:"image,omitempty"`
+}
+
+// Vote is a message of type vote. Value is 1 for a like, 0 to remove a like
+// and -1 for a dislike.
+type Vote struct {
+	Link       string  `json:"link"`
+	Value      int     `json:"value"`
+	Expression string  `json:"expression,omitempty"`
+	Root       string  `json:"root,omitempty"`
+	Branch     refList `json:"branch,omitempty"`
+}
+
+// DecodePost decodes a post rejecting unknown fields.
+func DecodePost(data []byte) (Post, error) {
+	var post Post
+	return post, decodeContent(data, &post)
+}
+
+// DecodeContact decodes a contact rejecting unknown fields.
+func DecodeContact(data []byte) (Contact, error) {
+	var contact Contact
+	return contact, decodeContent(data, &contact)
+}
+
+// DecodeAbout decodes an about rejecting unknown fields.
+func DecodeAbout(data []byte) (About, error) {
+	var about About
+	return about, decodeContent(data, &about)
+}
+
+// DecodeVote decodes a vote rejecting unknown fields.
+func DecodeVote(data []byte) (Vote, error) {
+	var vote Vote
+	return vote, decodeContent(data, &vote)
+}
+
+func decodeContent(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		problem := decodingProblem(err)
+		return ContentValidationError{Problems: []ContentProblem{{Field: problem.Field, Problem: problem.Problem}}}
+	}
+	return nil
+}
+
+// MarshalTypedContent validates the content and encodes it. A
+// ContentValidationError is returned if the content is invalid.
+func MarshalTypedContent(content TypedContent) ([]byte, error) {
+	v := newContentValidator()
+	content.validate(v)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	b, err := content.marshal()
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling the content")
+	}
+
+	size, err := contentSize(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "error measuring the content")
+	}
+
+	if size > MaxContentSize {
+		return nil, ContentValidationError{Problems: []ContentProblem{{
+			Problem: fmt.Sprintf("content is too large, %d exceeds the limit of %d", size, MaxContentSize),
+		}}}
+	}
+
+	return b, nil
+}
+
+// PublishTyped validates the content and publishes it. Nothing is signed if
+// the content is invalid.
+func (n *Node) PublishTyped(content TypedContent) (refs.Message, error) {
+	b, err := MarshalTypedContent(content)
+	if err != nil {
+		return refs.Message{}, errors.Wrap(err, "invalid content")
+	}
+
+	return n.PublishRaw(b)
+}
+
+// PublishRaw publishes the content as is and wakes up the subscriptions so
+// that the message is delivered to them without waiting for the next poll.
+func (n *Node) PublishRaw(content []byte) (refs.Message, error) {
+	service, err := n.Get()
+	if err != nil {
+		return refs.Message{}, errors.Wrap(err, "error getting the service")
+	}
+
+	cmd, err := commands.NewPublishRaw(content)
+	if err != nil {
+		return refs.Message{}, errors.Wrap(err, "error creating the command")
+	}
+
+	id, err := service.App.Commands.PublishRaw.Handle(cmd)
+	if err != nil {
+		return refs.Message{}, errors.Wrap(err, "error publishing")
+	}
+
+	n.receiveLog.publish()
+	return id, nil
+}
+
+func (p Post) validate(v *contentValidator) {
+	if strings.TrimSpace(p.Text) == "" {
+		v.Problem("text", "is required")
+	}
+
+	v.Thread(p.Root, p.Branch)
+
+	for i, mention := range p.Mentions {
+		field := fmt.Sprintf("mentions[%d]", i)
+		if !strings.HasPrefix(mention.Link, "#") {
+			v.Ref(field+".link", mention.Link, true, true, true)
+		} else if !isValidChannel(strings.TrimPrefix(mention.Link, "#")) {
+			v.Problem(field+".link", "invalid channel")
+		}
+
+		if mention.Size < 0 {
+			v.Problem(field+".size", "can't be negative")
+		}
+	}
+
+	if p.Channel != "" && !isValidChannel(strings.TrimPrefix(p.Channel, "#")) {
+		v.Problem("channel", "can't contain whitespace")
+	}
+}
+
+func (p Post) marshal() ([]byte, error) {
+	return marshalContent(struct {
+		Type     string    `json:"type"`
+		Text     string    `json:"text"`
+		Root     string    `json:"root,omitempty"`
+		Branch   any       `json:"branch,omitempty"`
+		Mentions []Mention `json:"mentions,omitempty"`
+		Channel  string    `json:"channel,omitempty"`
+	}{
+		Type:     "post",
+		Text:     p.Text,
+		Root:     p.Root,
+		Branch:   p.Branch.content(),
+		Mentions: p.Mentions,
+		Channel:  strings.TrimPrefix(p.Channel, "#"),
+	})
+}
+
+func (c Contact) validate(v *contentValidator) {
+	v.Ref("contact", c.Contact, true, false, false)
+
+	if c.Following == nil && c.Blocking == nil {
+		v.Problem("", "at least one of following and blocking is required")
+	}
+
+	if c.Following != nil && c.Blocking != nil && *c.Following && *c.Blocking {
+		v.Problem("blocking", "can't block a followed feed")
+	}
+}
+
+func (c Contact) marshal() ([]byte, error) {
+	return marshalContent(struct {
+		Type      string `json:"type"`
+		Contact   string `json:"contact"`
+		Following *bool  `json:"following,omitempty"`
+		Blocking  *bool  `json:"blocking,omitempty"`
+	}{
+		Type:      "contact",
+		Contact:   c.Contact,
+		Following: c.Following,
+		Blocking:  c.Blocking,
+	})
+}
+
+func (a About) validate(v *contentValidator) {
+	v.Ref("about", a.About, true, true, false)
+
+	if a.Name == nil && a.Description == nil && a.Image == "" {
+		v.Problem("", "at least one of name, description and image is required")
+	}
+
+	if a.Name != nil && strings.ContainsAny(*a.Name, "\r\n") {
+		v.Problem("name", "can't contain line breaks")
+	}
+
+	if a.Image != "" {
+		v.Ref("image", a.Image, false, false, true)
+	}
+}
+
+func (a About) marshal() ([]byte, error) {
+	return marshalContent(struct {
+		Type        string  `json:"type"`
+		About       string  `json:"about"`
+		Name        *string `json:"name,omitempty"`
+		Description *string `json:"description,omitempty"`
+		Image       string  `json:"image,omitempty"`
+	}{
+		Type:        "about",
+		About:       a.About,
+		Name:        a.Name,
+		Description: a.Description,
+		Image:       a.Image,
+	})
+}
+
+func (vote Vote) validate(v *contentValidator) {
+	v.Ref("link", vote.Link, false, true, false)
+
+	if vote.Value < -1 || vote.Value > 1 {
+		v.Problem("value", "must be -1, 0 or 1")
+	}
+
+	v.Thread(vote.Root, vote.Branch)
+}
+
+func (vote Vote) marshal() ([]byte, error) {
+	type voteValue struct {
+		Link       string `json:"link"`
+		Value      int    `json:"value"`
+		Expression string `json:"expression,omitempty"`
+	}
+
+	return marshalContent(struct {
+		Type   string    `json:"type"`
+		Vote   voteValue `json:"vote"`
+		Root   string    `json:"root,omitempty"`
+		Branch any       `json:"branch,omitempty"`
+	}{
+		Type: "vote",
+		Vote: voteValue{
+			Link:       vote.Link,
+			Value:      vote.Value,
+			Expression: vote.Expression,
+		},
+		Root:   vote.Root,
+		Branch: vote.Branch.content(),
+	})
+}
+
+// refList is a list of refs which can be decoded from a single string.
+type refList []string
+
+func (l *refList) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*l = refList{s}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// content returns a single ref as a string, the same as other Scuttlebutt
+// implementations do.
+func (l refList) content() any {
+	switch len(l) {
+	case 0:
+		return nil
+	case 1:
+		return l[0]
+	default:
+		return []string(l)
+	}
+}
+
+type contentValidator struct {
+	problems []ContentProblem
+}
+
+func newContentValidator() *contentValidator {
+	return &contentValidator{}
+}
+
+func (v *contentValidator) Problem(field, problem string) {
+	v.problems = append(v.problems, ContentProblem{Field: field, Problem: problem})
+}
+
+// Ref checks that the field contains a ref of one of the allowed kinds.
+func (v *contentValidator) Ref(field, ref string, feed, msg, blob bool) {
+	if ref == "" {
+		v.Problem(field, "is required")
+		return
+	}
+
+	var err error
+	switch {
+	case feed && strings.HasPrefix(ref, "@"):
+		_, err = refs.NewIdentity(ref)
+	case msg && strings.HasPrefix(ref, "%"):
+		_, err = refs.NewMessage(ref)
+	case blob && strings.HasPrefix(ref, "&"):
+		_, err = refs.NewBlob(ref)
+	default:
+		var kinds []string
+		if feed {
+			kinds = append(kinds, "feed")
+		}
+		if msg {
+			kinds = append(kinds, "message")
+		}
+		if blob {
+			kinds = append(kinds, "blob")
+		}
+		v.Problem(field, fmt.Sprintf("must be a %s ref", strings.Join(kinds, " or ")))
+		return
+	}
+
+	if err != nil {
+		v.Problem(field, fmt.Sprintf("invalid ref: %s", err))
+	}
+}
+
+// Thread checks the fields which place a message in a thread.
+func (v *contentValidator) Thread(root string, branch refList) {
+	if root != "" {
+		v.Ref("root", root, false, true, false)
+	}
+
+	if len(branch) > 0 && root == "" {
+		v.Problem("branch", "requires root")
+	}
+
+	for i, ref := range branch {
+		v.Ref(fmt.Sprintf("branch[%d]", i), ref, false, true, false)
+	}
+}
+
+func (v *contentValidator) Err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return ContentValidationError{Problems: v.problems}
+}
+
+func isValidChannel(channel string) bool {
+	return channel != "" && strings.IndexFunc(channel, unicode.IsSpace) < 0
+}
+
+func marshalContent(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// contentSize returns the size of the content as it will be counted in the
+// message, that is indented with two spaces and nested one level deep.
+func contentSize(content []byte) (int, error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, content, "  ", "  "); err != nil {
+		return 0, err
+	}
+	return len(utf16.Encode([]rune(buf.String()))), nil
+}
@@ -0,0 +1,129 @@
+package bindings
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testMessageRef = "%LQQ7qdwCTw1gmjMn/jB5E0ogdbgwoxgO4u9cSLNV0ss=.sha256"
+
+func TestMarshalTypedContent(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Content  TypedContent
+		Expected string
+	}{
+		{
+			Name:     "post",
+			Content:  Post{Text: "hello <world>", Root: testMessageRef, Branch: refList{testMessageRef}, Channel: "#scuttlebutt"},
+			Expected: `{"type":"post","text":"hello <world>","root":"` + testMessageRef + `","branch":"` + testMessageRef + `","channel":"scuttlebutt"}`,
+		},
+		{
+			Name:     "contact",
+			Content:  Contact{Contact: testFeedRef, Blocking: boolPtr(false)},
+			Expected: `{"type":"contact","contact":"` + testFeedRef + `","blocking":false}`,
+		},
+		{
+			Name:     "about",
+			Content:  About{About: testFeedRef, Name: stringPtr("name"), Image: testBlobRef},
+			Expected: `{"type":"about","about":"` + testFeedRef + `","name":"name","image":"` + testBlobRef + `"}`,
+		},
+		{
+			Name:     "vote",
+			Content:  Vote{Link: testMessageRef, Value: 1, Expression: "Like"},
+			Expected: `{"type":"vote","vote":{"link":"` + testMessageRef + `","value":1,"expression":"Like"}}`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			b, err := MarshalTypedContent(testCase.Content)
+			require.NoError(t, err)
+			require.Equal(t, testCase.Expected, string(b))
+		})
+	}
+}
+
+func TestMarshalTypedContentReportsAllProblems(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Content  TypedContent
+		Problems []ContentProblem
+	}{
+		{
+			Name:    "post",
+			Content: Post{Branch: refList{"invalid"}, Mentions: []Mention{{Link: testFeedRef, Size: -1}}, Channel: "a b"},
+			Problems: []ContentProblem{
+				{Field: "text", Problem: "is required"},
+				{Field: "branch", Problem: "requires root"},
+				{Field: "branch[0]", Problem: "must be a message ref"},
+				{Field: "mentions[0].size", Problem: "can't be negative"},
+				{Field: "channel", Problem: "can't contain whitespace"},
+			},
+		},
+		{
+			Name:    "contact",
+			Content: Contact{Contact: testMessageRef},
+			Problems: []ContentProblem{
+				{Field: "contact", Problem: "must be a feed ref"},
+				{Field: "", Problem: "at least one of following and blocking is required"},
+			},
+		},
+		{
+			Name:    "about",
+			Content: About{About: testBlobRef, Name: stringPtr("a\nb"), Image: testFeedRef},
+			Problems: []ContentProblem{
+				{Field: "about", Problem: "must be a feed or message ref"},
+				{Field: "name", Problem: "can't contain line breaks"},
+				{Field: "image", Problem: "must be a blob ref"},
+			},
+		},
+		{
+			Name:    "vote",
+			Content: Vote{Value: 2},
+			Problems: []ContentProblem{
+				{Field: "link", Problem: "is required"},
+				{Field: "value", Problem: "must be -1, 0 or 1"},
+			},
+		},
+		{
+			Name:    "too_large",
+			Content: Post{Text: strings.Repeat("a", MaxContentSize)},
+			Problems: []ContentProblem{
+				{Field: "", Problem: "content is too large, 7832 exceeds the limit of 7792"},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			_, err := MarshalTypedContent(testCase.Content)
+
+			var validationErr ContentValidationError
+			require.ErrorAs(t, err, &validationErr)
+			require.Equal(t, testCase.Problems, validationErr.Problems)
+		})
+	}
+}
+
+func TestDecodeContentRejectsUnknownFields(t *testing.T) {
+	_, err := DecodePost([]byte(`{"text":"hello","unknown":true}`))
+
+	var validationErr ContentValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.Equal(t, []ContentProblem{{Field: "unknown", Problem: "unknown field"}}, validationErr.Problems)
+
+	post, err := DecodePost([]byte(`{"text":"hello","root":"` + testMessageRef + `","branch":["` + testMessageRef + `"]}`))
+	require.NoError(t, err)
+	require.Equal(t, refList{testMessageRef}, post.Branch)
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
+
+func stringPtr(v string) *string {
+	return &v
+}
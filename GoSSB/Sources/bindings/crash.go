@@ -0,0 +1,210 @@
+package bindings
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/boreq/errors"
+)
+
+const (
+	crashReportFileName = "crash-report.json"
+
+	initialGoroutineDumpSize = 1 * mebibyte
+	maxGoroutineDumpSize     = 64 * mebibyte
+)
+
+var ErrCrashReportDirectoryUnknown = errors.New("node was never started so the crash report directory is unknown")
+
+// CrashReport describes a panic which occurred in an exported function or in
+// one of the goroutines of a node.
+type CrashReport struct {
+	Time time.Time `json:"time"`
+
+	// Source is the name of the goroutine in which the panic occurred or
+	// "export" if it occurred in an exported function.
+	Source string `json:"source"`
+
+	Panic      string `json:"panic"`
+	Stack      string `json:"stack"`
+	Goroutines string `json:"goroutines"`
+
+	// Stats is the last snapshot recorded before the panic, nil if none was
+	// recorded yet.
+	Stats *StatsSnapshot `json:"stats"`
+
+	// Config is the config of the node with the keys removed.
+	Config BotConfig `json:"config"`
+}
+
+// StatsSnapshot is periodically recorded by a running node.
+type StatsSnapshot struct {
+	Time     time.Time   `json:"time"`
+	Messages int         `json:"messages"`
+	Feeds    int         `json:"feeds"`
+	Peers    int         `json:"peers"`
+	Restarts int         `json:"restarts"`
+	Memory   MemoryStats `json:"memory"`
+}
+
+// DebugDirectory returns the directory in which logs and crash reports are
+// stored.
+func DebugDirectory(config BotConfig) string {
+	return filepath.Join(config.Repo, "debug")
+}
+
+// crashReporter writes crash reports of a node. Unlike most of the node's
+// state it isn't cleared when the node stops so that panics which occur
+// after that can still be reported.
+type crashReporter struct {
+	mutex  sync.Mutex
+	config *BotConfig
+	stats  *StatsSnapshot
+}
+
+func newCrashReporter() *crashReporter {
+	return &crashReporter{}
+}
+
+func (r *crashReporter) SetConfig(config BotConfig) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	config.NetworkKey = ""
+	config.HMACKey = ""
+	config.KeyBlob = ""
+	r.config = &config
+}
+
+func (r *crashReporter) SetStats(stats StatsSnapshot) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.stats = &stats
+}
+
+// Recover writes a crash report and panics again. It has to be deferred
+// directly.
+func (r *crashReporter) Recover(source string) {
+	if p := recover(); p != nil {
+		// There is no way to report the error as the process is about to
+		// crash.
+		_ = r.Report(source, p, debug.Stack())
+		panic(p)
+	}
+}
+
+// Report synchronously writes the crash report to the debug directory,
+// replacing the previous one.
+func (r *crashReporter) Report(source string, panicValue any, stack []byte) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.config == nil {
+		return ErrCrashReportDirectoryUnknown
+	}
+
+	report := CrashReport{
+		Time:       time.Now(),
+		Source:     source,
+		Panic:      fmt.Sprint(panicValue),
+		Stack:      string(stack),
+		Goroutines: string(goroutineDump()),
+		Stats:      r.stats,
+		Config:     *r.config,
+	}
+
+	b, err := json.Marshal(report)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling the report")
+	}
+
+	directory := DebugDirectory(*r.config)
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return errors.Wrap(err, "error creating the directory")
+	}
+
+	if err := writeFileSync(filepath.Join(directory, crashReportFileName), b); err != nil {
+		return errors.Wrap(err, "error writing the report")
+	}
+
+	return nil
+}
+
+// Take returns the crash report and removes it so that it is returned only
+// once. It returns nil if there is no crash report.
+func (r *crashReporter) Take() (*CrashReport, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.config == nil {
+		return nil, ErrCrashReportDirectoryUnknown
+	}
+
+	path := filepath.Join(DebugDirectory(*r.config), crashReportFileName)
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "error reading the report")
+	}
+
+	if err := os.Remove(path); err != nil {
+		return nil, errors.Wrap(err, "error removing the report")
+	}
+
+	var report CrashReport
+	if err := json.Unmarshal(b, &report); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling the report")
+	}
+
+	return &report, nil
+}
+
+// writeFileSync writes the file and flushes it to disk before returning.
+func writeFileSync(path string, data []byte) error {
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrap(err, "error opening the file")
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return errors.Wrap(err, "error writing")
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return errors.Wrap(err, "error syncing")
+	}
+
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "error closing the file")
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return errors.Wrap(err, "error renaming the file")
+	}
+
+	return nil
+}
+
+func goroutineDump() []byte {
+	for size := initialGoroutineDumpSize; ; size *= 2 {
+		buf := make([]byte, size)
+		n := runtime.Stack(buf, true)
+		if n < size || size >= maxGoroutineDumpSize {
+			return buf[:n]
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package bindings
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCrashReporter_ReportIsReturnedOnce(t *testing.T) {
+	reporter := newCrashReporter()
+	reporter.SetConfig(BotConfig{
+		NetworkKey: "networkKey",
+		HMACKey:    "hmacKey",
+		KeyBlob:    "keyBlob",
+		Repo:       t.TempDir(),
+		Hops:       2,
+	})
+	reporter.SetStats(StatsSnapshot{Messages: 10})
+
+	require.NoError(t, reporter.Report("export", "some panic", []byte("stack")))
+
+	report, err := reporter.Take()
+	require.NoError(t, err)
+	require.NotNil(t, report)
+	require.Equal(t, "export", report.Source)
+	require.Equal(t, "some panic", report.Panic)
+	require.Equal(t, "stack", report.Stack)
+	require.NotEmpty(t, report.Goroutines)
+	require.Equal(t, 10, report.Stats.Messages)
+	require.Equal(t, 2, report.Config.Hops)
+	require.Empty(t, report.Config.NetworkKey)
+	require.Empty(t, report.Config.HMACKey)
+	require.Empty(t, report.Config.KeyBlob)
+
+	report, err = reporter.Take()
+	require.NoError(t, err)
+	require.Nil(t, report)
+}
+
+func TestCrashReporter_RequiresConfig(t *testing.T) {
+	reporter := newCrashReporter()
+
+	require.ErrorIs(t, reporter.Report("export", "some panic", nil), ErrCrashReportDirectoryUnknown)
+
+	_, err := reporter.Take()
+	require.ErrorIs(t, err, ErrCrashReportDirectoryUnknown)
+}
@@ -0,0 +1,159 @@
+package bindings
+
+import (
+	"github.com/boreq/errors"
+	"github.com/planetary-social/scuttlego/service/app/common"
+	"github.com/planetary-social/scuttlego/service/app/queries"
+	"github.com/planetary-social/scuttlego/service/domain/feeds/message"
+	"github.com/planetary-social/scuttlego/service/domain/refs"
+)
+
+type getMessageBySequenceFn func(sequence message.Sequence) (message.Message, error)
+
+// FeedMessage is a message of a feed. Sequence is the receive log sequence of
+// the message or nil if the message wasn't indexed yet or the index isn't
+// available.
+type FeedMessage struct {
+	Message  message.Message
+	Sequence *common.ReceiveLogSequence
+}
+
+// StreamFeed returns at most limit messages of the given feed starting with
+// the message with the given sequence. If reverse is true the messages are
+// returned in descending order and passing 0 as the sequence starts with the
+// latest message of the feed, otherwise passing 0 starts with the first
+// message. An empty slice is returned if the feed is unknown.
+func (n *Node) StreamFeed(feed refs.Feed, from int, limit int, reverse bool) ([]FeedMessage, error) {
+	service, err := n.Get()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting the service")
+	}
+
+	msgs, err := streamFeed(func(sequence message.Sequence) (message.Message, error) {
+		query, err := queries.NewGetMessageBySequence(feed, sequence)
+		if err != nil {
+			return message.Message{}, errors.Wrap(err, "error creating the query")
+		}
+		return service.App.Queries.GetMessageBySequence.Handle(query)
+	}, from, limit, reverse)
+	if err != nil {
+		return nil, errors.Wrap(err, "error streaming the feed")
+	}
+
+	result := make([]FeedMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		result = append(result, FeedMessage{Message: msg})
+	}
+
+	index, err := n.getIndex()
+	if err != nil {
+		if errors.Is(err, ErrIndexIsNotAvailable) {
+			return result, nil
+		}
+		return nil, errors.Wrap(err, "error getting the index")
+	}
+
+	if err := index.ReceiveLogSequences(result); err != nil {
+		return nil, errors.Wrap(err, "error getting the receive log sequences")
+	}
+
+	return result, nil
+}
+
+// streamFeed retrieves the messages one by one as scuttlego doesn't provide
+// a query returning a range of messages of a feed.
+func streamFeed(get getMessageBySequenceFn, from int, limit int, reverse bool) ([]message.Message, error) {
+	if limit <= 0 {
+		return nil, errors.New("limit must be positive")
+	}
+
+	if from < 0 {
+		return nil, errors.New("sequence can't be negative")
+	}
+
+	if from == 0 {
+		if !reverse {
+			from = 1
+		} else {
+			latest, err := latestSequence(get)
+			if err != nil {
+				return nil, errors.Wrap(err, "error finding the latest sequence")
+			}
+			from = latest
+		}
+	}
+
+	step := 1
+	if reverse {
+		step = -1
+	}
+
+	var result []message.Message
+	for seq := from; seq > 0 && len(result) < limit; seq += step {
+		sequence, err := message.NewSequence(seq)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating the sequence")
+		}
+
+		msg, err := get(sequence)
+		if err != nil {
+			if errors.Is(err, common.ErrFeedMessageNotFound) {
+				break
+			}
+			return nil, errors.Wrapf(err, "error getting message %d", seq)
+		}
+
+		result = append(result, msg)
+	}
+
+	return result, nil
+}
+
+// latestSequence returns the sequence of the latest message of the feed or 0
+// if the feed is unknown. It relies on the messages of a feed being stored
+// without gaps.
+func latestSequence(get getMessageBySequenceFn) (int, error) {
+	exists := func(seq int) (bool, error) {
+		sequence, err := message.NewSequence(seq)
+		if err != nil {
+			return false, errors.Wrap(err, "error creating the sequence")
+		}
+
+		if _, err := get(sequence); err != nil {
+			if errors.Is(err, common.ErrFeedMessageNotFound) {
+				return false, nil
+			}
+			return false, errors.Wrapf(err, "error getting message %d", seq)
+		}
+		return true, nil
+	}
+
+	// find the bounds so that the message at low exists and the message at
+	// high doesn't
+	low, high := 0, 1
+	for {
+		ok, err := exists(high)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			break
+		}
+		low, high = high, high*2
+	}
+
+	for high-low > 1 {
+		mid := low + (high-low)/2
+		ok, err := exists(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+
+	return low, nil
+}
@@ -0,0 +1,66 @@
+package bindings
+
+import (
+	"testing"
+
+	"github.com/planetary-social/scuttlego/service/app/common"
+	"github.com/planetary-social/scuttlego/service/domain/feeds/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamFeed(t *testing.T) {
+	testCases := []struct {
+		name     string
+		from     int
+		limit    int
+		reverse  bool
+		expected []int
+	}{
+		{name: "forward_from_the_beginning", from: 0, limit: 3, expected: []int{1, 2, 3}},
+		{name: "forward_from_sequence", from: 9, limit: 3, expected: []int{9, 10}},
+		{name: "forward_past_the_end", from: 11, limit: 3, expected: nil},
+		{name: "reverse_from_the_end", from: 0, limit: 3, reverse: true, expected: []int{10, 9, 8}},
+		{name: "reverse_from_sequence", from: 2, limit: 3, reverse: true, expected: []int{2, 1}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			feed := newFakeFeed(10)
+
+			msgs, err := streamFeed(feed.Get, testCase.from, testCase.limit, testCase.reverse)
+			require.NoError(t, err)
+			require.Len(t, msgs, len(testCase.expected))
+
+			// the messages are retrieved after looking for the latest sequence
+			returned := feed.found[len(feed.found)-len(testCase.expected):]
+			for i, seq := range testCase.expected {
+				require.Equal(t, seq, returned[i])
+			}
+		})
+	}
+}
+
+func TestLatestSequence(t *testing.T) {
+	for _, length := range []int{0, 1, 2, 3, 7, 8, 9, 1000} {
+		latest, err := latestSequence(newFakeFeed(length).Get)
+		require.NoError(t, err)
+		require.Equal(t, length, latest)
+	}
+}
+
+type fakeFeed struct {
+	length int
+	found  []int
+}
+
+func newFakeFeed(length int) *fakeFeed {
+	return &fakeFeed{length: length}
+}
+
+func (f *fakeFeed) Get(sequence message.Sequence) (message.Message, error) {
+	if sequence.Int() > f.length {
+		return message.Message{}, common.ErrFeedMessageNotFound
+	}
+	f.found = append(f.found, sequence.Int())
+	return message.Message{}, nil
+}
@@ -0,0 +1,174 @@
+package bindings
+
+import (
+	"encoding/json"
+
+	"github.com/boreq/errors"
+	"github.com/planetary-social/scuttlego/service/app/common"
+	"github.com/planetary-social/scuttlego/service/app/queries"
+	"github.com/planetary-social/scuttlego/service/domain/refs"
+)
+
+const (
+	filteredReceiveLogBatchSize = 1000
+
+	// Limits the time spent in a single call if most messages are filtered
+	// out. The returned cursor lets the caller continue.
+	filteredReceiveLogMaxScanned = 10 * filteredReceiveLogBatchSize
+)
+
+// ReceiveLogFilter selects messages from the receive log. Zero value selects
+// all messages.
+type ReceiveLogFilter struct {
+	// Types selects messages with one of the given content types. Encrypted
+	// messages have no type. Empty selects all types.
+	Types []string `json:"types"`
+
+	// Authors selects messages published by one of the given identities.
+	// Empty selects all authors.
+	Authors []string `json:"authors"`
+
+	ExcludeEncrypted bool `json:"excludeEncrypted"`
+}
+
+func (f ReceiveLogFilter) Validate() error {
+	for _, typ := range f.Types {
+		if typ == "" {
+			return errors.New("type can't be empty")
+		}
+	}
+
+	for _, author := range f.Authors {
+		if _, err := refs.NewIdentity(author); err != nil {
+			return errors.Wrapf(err, "invalid author '%s'", author)
+		}
+	}
+
+	return nil
+}
+
+func (f ReceiveLogFilter) matcher() receiveLogMatcher {
+	m := receiveLogMatcher{
+		excludeEncrypted: f.ExcludeEncrypted,
+	}
+
+	if len(f.Types) > 0 {
+		m.types = make(map[string]struct{})
+		for _, typ := range f.Types {
+			m.types[typ] = struct{}{}
+		}
+	}
+
+	if len(f.Authors) > 0 {
+		m.authors = make(map[string]struct{})
+		for _, author := range f.Authors {
+			m.authors[refs.MustNewIdentity(author).String()] = struct{}{}
+		}
+	}
+
+	return m
+}
+
+type receiveLogMatcher struct {
+	types            map[string]struct{}
+	authors          map[string]struct{}
+	excludeEncrypted bool
+}
+
+func (m receiveLogMatcher) Matches(msg queries.LogMessage) bool {
+	if m.authors != nil {
+		if _, ok := m.authors[msg.Message.Author().String()]; !ok {
+			return false
+		}
+	}
+
+	if m.types == nil && !m.excludeEncrypted {
+		return true
+	}
+
+	var content struct {
+		Type string `json:"type"`
+	}
+
+	// encrypted content is a string
+	if err := json.Unmarshal(msg.Message.Content().Raw().Bytes(), &content); err != nil {
+		return m.types == nil && !m.excludeEncrypted
+	}
+
+	if m.types == nil {
+		return true
+	}
+
+	_, ok := m.types[content.Type]
+	return ok
+}
+
+// FilteredReceiveLog returns at most limit messages matching the filter with
+// a receive log sequence greater or equal to the given sequence. The returned
+// sequence is the sequence from which the next call should continue. Fewer
+// messages than the limit may be returned even if more matching messages
+// exist. The end of the receive log was reached if the returned sequence is
+// equal to the given one.
+func (n *Node) FilteredReceiveLog(start common.ReceiveLogSequence, limit int, filter ReceiveLogFilter) ([]queries.LogMessage, common.ReceiveLogSequence, error) {
+	if limit <= 0 {
+		return nil, common.ReceiveLogSequence{}, errors.New("limit must be positive")
+	}
+
+	if err := filter.Validate(); err != nil {
+		return nil, common.ReceiveLogSequence{}, errors.Wrap(err, "invalid filter")
+	}
+
+	service, err := n.Get()
+	if err != nil {
+		return nil, common.ReceiveLogSequence{}, errors.Wrap(err, "error getting the service")
+	}
+
+	return filterReceiveLog(newReceiveLogFn(service), start, limit, filter.matcher())
+}
+
+type receiveLogFn func(start common.ReceiveLogSequence, limit int) ([]queries.LogMessage, error)
+
+func newReceiveLogFn(service *Service) receiveLogFn {
+	return func(start common.ReceiveLogSequence, limit int) ([]queries.LogMessage, error) {
+		query, err := queries.NewReceiveLog(start, limit)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating the query")
+		}
+		return service.App.Queries.ReceiveLog.Handle(query)
+	}
+}
+
+func filterReceiveLog(receiveLog receiveLogFn, start common.ReceiveLogSequence, limit int, matcher receiveLogMatcher) ([]queries.LogMessage, common.ReceiveLogSequence, error) {
+	var result []queries.LogMessage
+	next := start
+	scanned := 0
+
+	for scanned < filteredReceiveLogMaxScanned {
+		msgs, err := receiveLog(next, filteredReceiveLogBatchSize)
+		if err != nil {
+			return nil, common.ReceiveLogSequence{}, errors.Wrap(err, "error querying the receive log")
+		}
+
+		for _, msg := range msgs {
+			scanned++
+
+			next, err = common.NewReceiveLogSequence(msg.Sequence.Int() + 1)
+			if err != nil {
+				return nil, common.ReceiveLogSequence{}, errors.Wrap(err, "error creating the sequence")
+			}
+
+			if matcher.Matches(msg) {
+				result = append(result, msg)
+				if len(result) == limit {
+					return result, next, nil
+				}
+			}
+		}
+
+		if len(msgs) < filteredReceiveLogBatchSize {
+			break
+		}
+	}
+
+	return result, next, nil
+}
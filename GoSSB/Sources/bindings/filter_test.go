@@ -0,0 +1,101 @@
+package bindings
+
+import (
+	"testing"
+
+	"github.com/planetary-social/scuttlego/service/app/common"
+	"github.com/planetary-social/scuttlego/service/app/queries"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceiveLogFilter(t *testing.T) {
+	post := newTestLogMessage(t, 0, `{"type":"post","text":"hello"}`)
+	vote := newTestLogMessage(t, 1, `{"type":"vote"}`)
+	encrypted := newTestLogMessage(t, 2, `"c29tZWNpcGhlcnRleHQ=.box"`)
+
+	testCases := []struct {
+		name     string
+		filter   ReceiveLogFilter
+		expected []queries.LogMessage
+	}{
+		{
+			name:     "zero_value",
+			filter:   ReceiveLogFilter{},
+			expected: []queries.LogMessage{post, vote, encrypted},
+		},
+		{
+			name:     "types",
+			filter:   ReceiveLogFilter{Types: []string{"vote"}},
+			expected: []queries.LogMessage{vote},
+		},
+		{
+			name:     "authors",
+			filter:   ReceiveLogFilter{Authors: []string{post.Message.Author().String()}},
+			expected: []queries.LogMessage{post},
+		},
+		{
+			name:     "exclude_encrypted",
+			filter:   ReceiveLogFilter{ExcludeEncrypted: true},
+			expected: []queries.LogMessage{post, vote},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.NoError(t, testCase.filter.Validate())
+
+			matcher := testCase.filter.matcher()
+
+			var matching []queries.LogMessage
+			for _, msg := range []queries.LogMessage{post, vote, encrypted} {
+				if matcher.Matches(msg) {
+					matching = append(matching, msg)
+				}
+			}
+			require.Equal(t, testCase.expected, matching)
+		})
+	}
+}
+
+func TestReceiveLogFilter_Validate(t *testing.T) {
+	require.Error(t, ReceiveLogFilter{Types: []string{""}}.Validate())
+	require.Error(t, ReceiveLogFilter{Authors: []string{"invalid"}}.Validate())
+}
+
+func TestFilterReceiveLog_CursorMovesForwardWhenEverythingIsFilteredOut(t *testing.T) {
+	var log []queries.LogMessage
+	for i := 0; i < filteredReceiveLogMaxScanned+10; i++ {
+		log = append(log, newTestLogMessage(t, i, `{"type":"post"}`))
+	}
+	vote := newTestLogMessage(t, len(log), `{"type":"vote"}`)
+	log = append(log, vote)
+
+	receiveLog := func(start common.ReceiveLogSequence, limit int) ([]queries.LogMessage, error) {
+		from := start.Int()
+		if from > len(log) {
+			from = len(log)
+		}
+		to := from + limit
+		if to > len(log) {
+			to = len(log)
+		}
+		return log[from:to], nil
+	}
+
+	matcher := ReceiveLogFilter{Types: []string{"vote"}}.matcher()
+
+	msgs, next, err := filterReceiveLog(receiveLog, common.MustNewReceiveLogSequence(0), 10, matcher)
+	require.NoError(t, err)
+	require.Empty(t, msgs)
+	require.Equal(t, filteredReceiveLogMaxScanned, next.Int())
+
+	msgs, next, err = filterReceiveLog(receiveLog, next, 10, matcher)
+	require.NoError(t, err)
+	require.Equal(t, []queries.LogMessage{vote}, msgs)
+	require.Equal(t, len(log), next.Int())
+
+	msgs, end, err := filterReceiveLog(receiveLog, next, 10, matcher)
+	require.NoError(t, err)
+	require.Empty(t, msgs)
+	require.Equal(t, next, end)
+}
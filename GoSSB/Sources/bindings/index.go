@@ -0,0 +1,582 @@
+package bindings
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	bindingslogging "verseproj/scuttlegobridge/logging"
+
+	"github.com/boreq/errors"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/planetary-social/scuttlego/service"
+	"github.com/planetary-social/scuttlego/service/app/common"
+	"github.com/planetary-social/scuttlego/service/app/queries"
+	"github.com/planetary-social/scuttlego/service/domain/refs"
+)
+
+const (
+	indexPollInterval     = 1 * time.Second
+	indexBatchSize        = 1000
+	indexProgressInterval = migrationProgressInterval
+
+	// indexVersion has to be incremented every time the format of the index
+	// changes so that it is rebuilt.
+	indexVersion = 6
+
+	// The index is much smaller than the main database so it doesn't need
+	// Badger's default 64 MiB memtables. The value threshold has to be lowered
+	// accordingly.
+	indexMemTableSize   = 4 * mebibyte
+	indexNumMemtables   = 2
+	indexValueThreshold = 1 * kibibyte
+)
+
+var (
+	ErrIndexIsNotAvailable = errors.New("index isn't available")
+
+	errIndexWasReset = errors.New("index was reset")
+
+	indexKeyVersion         = []byte("version")
+	indexKeyNext            = []byte("next")
+	indexPrefixMessageToSeq = []byte("m:")
+)
+
+// IndexProgress describes the progress of building the index. It is reported
+// only while the index is catching up with the receive log, for example after
+// it was rebuilt, and not for every new message.
+type IndexProgress struct {
+	ItemsProcessed int64
+	ItemsTotal     int64
+	Done           bool
+}
+
+type IndexOnProgressFn func(progress IndexProgress)
+
+// IndexDirectory returns the directory of the database storing the indexes
+// maintained by the bindings.
+func IndexDirectory(config BotConfig) string {
+	return filepath.Join(config.Repo, "index")
+}
+
+// index is a database maintained next to the main database for queries which
+// scuttlego doesn't support. It is built by tailing the receive log and
+// therefore lags behind it.
+type index struct {
+	// mutex prevents batches queried before the index was reset from being
+	// added to it.
+	mutex   sync.Mutex
+	db      *badger.DB
+	keyPair boxKeyPair
+	log     bindingslogging.Logger
+}
+
+func openIndex(directory string, storage storageSettings, keyPair boxKeyPair, log bindingslogging.Logger) (*index, error) {
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, errors.Wrap(err, "error creating the directory")
+	}
+
+	options := badger.DefaultOptions(directory)
+	storage.Apply(service.NewBadgerOptionsAdapter(&options), log)
+	options = options.
+		WithMemTableSize(indexMemTableSize).
+		WithNumMemtables(indexNumMemtables).
+		WithValueThreshold(indexValueThreshold)
+
+	db, err := badger.Open(options)
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening the database")
+	}
+
+	i := &index{db: db, keyPair: keyPair, log: log}
+
+	if err := i.migrate(log); err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "error migrating the index")
+	}
+
+	return i, nil
+}
+
+// migrate drops the index if it was built using a different version.
+func (i *index) migrate(log bindingslogging.Logger) error {
+	var version int
+	if err := i.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(indexKeyVersion)
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return nil
+			}
+			return errors.Wrap(err, "error getting the item")
+		}
+
+		return item.Value(func(val []byte) error {
+			version, err = decodeIndexInt(val)
+			return err
+		})
+	}); err != nil {
+		return errors.Wrap(err, "error reading the version")
+	}
+
+	if version == indexVersion {
+		return nil
+	}
+
+	log.Debug().WithField("from", version).WithField("to", indexVersion).Message("rebuilding the index")
+
+	return i.drop()
+}
+
+// Reset removes all entries so that the index is rebuilt from the beginning
+// of the receive log.
+func (i *index) Reset() error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	return i.drop()
+}
+
+func (i *index) drop() error {
+	if err := i.db.DropAll(); err != nil {
+		return errors.Wrap(err, "error dropping the index")
+	}
+
+	return i.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(indexKeyVersion, encodeIndexInt(indexVersion))
+	})
+}
+
+func (i *index) Close() error {
+	return i.db.Close()
+}
+
+// Next returns the receive log sequence of the first message which wasn't
+// indexed yet.
+func (i *index) Next() (common.ReceiveLogSequence, error) {
+	var next int
+	if err := i.db.View(func(txn *badger.Txn) error {
+		var err error
+		next, err = i.next(txn)
+		return err
+	}); err != nil {
+		return common.ReceiveLogSequence{}, errors.Wrap(err, "transaction failed")
+	}
+
+	return common.NewReceiveLogSequence(next)
+}
+
+func (i *index) next(txn *badger.Txn) (int, error) {
+	item, err := txn.Get(indexKeyNext)
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return 0, nil
+		}
+		return 0, errors.Wrap(err, "error getting the item")
+	}
+
+	var next int
+	if err := item.Value(func(val []byte) error {
+		next, err = decodeIndexInt(val)
+		return err
+	}); err != nil {
+		return 0, errors.Wrap(err, "error reading the value")
+	}
+
+	return next, nil
+}
+
+// Add indexes consecutive messages from the receive log which were queried
+// starting with the given sequence. The sequence has to be equal to the one
+// returned by Next.
+func (i *index) Add(start common.ReceiveLogSequence, msgs []queries.LogMessage) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	return i.add(start, msgs)
+}
+
+func (i *index) add(start common.ReceiveLogSequence, msgs []queries.LogMessage) error {
+	err := i.db.Update(func(txn *badger.Txn) error {
+		next, err := i.next(txn)
+		if err != nil {
+			return errors.Wrap(err, "error getting the next sequence")
+		}
+
+		if next != start.Int() {
+			return errIndexWasReset
+		}
+
+		for _, msg := range msgs {
+			if err := i.addMessage(txn, msg); err != nil {
+				return errors.Wrapf(err, "error indexing message '%s'", msg.Message.Id())
+			}
+		}
+
+		next = msgs[len(msgs)-1].Sequence.Int() + 1
+		return txn.Set(indexKeyNext, encodeIndexInt(next))
+	})
+
+	// Indexing is idempotent so the batch can be split up.
+	if errors.Is(err, badger.ErrTxnTooBig) && len(msgs) > 1 {
+		half := msgs[:len(msgs)/2]
+		if err := i.add(start, half); err != nil {
+			return err
+		}
+
+		start, err = common.NewReceiveLogSequence(half[len(half)-1].Sequence.Int() + 1)
+		if err != nil {
+			return errors.Wrap(err, "error creating the sequence")
+		}
+
+		return i.add(start, msgs[len(msgs)/2:])
+	}
+
+	return err
+}
+
+func (i *index) addMessage(txn *badger.Txn, msg queries.LogMessage) error {
+	previous, err := i.receiveLogSequence(txn, msg.Message.Id())
+	if err != nil {
+		return errors.Wrap(err, "error getting the previous sequence")
+	}
+
+	if err := i.addFeedReceiveLog(txn, msg, previous); err != nil {
+		return errors.Wrap(err, "error adding the feed receive log")
+	}
+
+	// If a message was received multiple times the highest sequence is
+	// stored, the same as in the published log.
+	if previous == nil || *previous < msg.Sequence.Int() {
+		if err := txn.Set(indexMessageKey(msg.Message.Id()), encodeIndexInt(msg.Sequence.Int())); err != nil {
+			return errors.Wrap(err, "error setting the sequence")
+		}
+	}
+
+	if err := i.addBacklinks(txn, msg); err != nil {
+		return errors.Wrap(err, "error adding the backlinks")
+	}
+
+	if err := i.addSearchTerms(txn, msg); err != nil {
+		return errors.Wrap(err, "error adding the search terms")
+	}
+
+	if err := i.addFeedSequence(txn, msg); err != nil {
+		return errors.Wrap(err, "error adding the feed sequence")
+	}
+
+	if err := i.addPrivateMessage(txn, msg); err != nil {
+		return errors.Wrap(err, "error adding the private message")
+	}
+
+	return nil
+}
+
+// ReceiveLogSequence returns false if the message wasn't indexed yet.
+func (i *index) ReceiveLogSequence(id refs.Message) (common.ReceiveLogSequence, bool, error) {
+	var seq *int
+
+	if err := i.db.View(func(txn *badger.Txn) error {
+		var err error
+		seq, err = i.receiveLogSequence(txn, id)
+		return err
+	}); err != nil {
+		return common.ReceiveLogSequence{}, false, errors.Wrap(err, "transaction failed")
+	}
+
+	if seq == nil {
+		return common.ReceiveLogSequence{}, false, nil
+	}
+
+	sequence, err := common.NewReceiveLogSequence(*seq)
+	if err != nil {
+		return common.ReceiveLogSequence{}, false, errors.Wrap(err, "error creating the sequence")
+	}
+
+	return sequence, true, nil
+}
+
+// ReceiveLogSequences sets the receive log sequences of the messages which
+// were already indexed.
+func (i *index) ReceiveLogSequences(msgs []FeedMessage) error {
+	return i.db.View(func(txn *badger.Txn) error {
+		for j := range msgs {
+			seq, err := i.receiveLogSequence(txn, msgs[j].Message.Id())
+			if err != nil {
+				return errors.Wrapf(err, "error getting the sequence of message '%s'", msgs[j].Message.Id())
+			}
+
+			if seq == nil {
+				continue
+			}
+
+			sequence, err := common.NewReceiveLogSequence(*seq)
+			if err != nil {
+				return errors.Wrap(err, "error creating the sequence")
+			}
+			msgs[j].Sequence = &sequence
+		}
+		return nil
+	})
+}
+
+// receiveLogSequence returns nil if the message wasn't indexed yet.
+func (i *index) receiveLogSequence(txn *badger.Txn, id refs.Message) (*int, error) {
+	item, err := txn.Get(indexMessageKey(id))
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "error getting the item")
+	}
+
+	var seq int
+	if err := item.Value(func(val []byte) error {
+		seq, err = decodeIndexInt(val)
+		return err
+	}); err != nil {
+		return nil, errors.Wrap(err, "error reading the value")
+	}
+
+	return &seq, nil
+}
+
+func indexMessageKey(id refs.Message) []byte {
+	return append(append([]byte(nil), indexPrefixMessageToSeq...), id.String()...)
+}
+
+func encodeIndexInt(v int) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(v))
+	return b
+}
+
+func decodeIndexInt(b []byte) (int, error) {
+	if len(b) != 8 {
+		return 0, errors.New("invalid length")
+	}
+	return int(binary.BigEndian.Uint64(b)), nil
+}
+
+// openIndex opens the index and starts updating it. Failing to open the index
+// doesn't prevent the node from running, only the queries relying on it are
+// unavailable and the subscriptions are woken up periodically instead.
+func (n *Node) openIndex(ctx context.Context, config BotConfig, keyPair boxKeyPair, log bindingslogging.Logger, onProgress IndexOnProgressFn) {
+	index, err := n.openIndexStorage(config, keyPair, log)
+	if err != nil {
+		log.Error().WithField(bindingslogging.ErrorField, err).Message("error opening the index")
+		n.startIndexing(ctx, nil, func(ctx context.Context) {
+			n.pollReceiveLog(ctx)
+		})
+		return
+	}
+
+	n.startIndexing(ctx, index, func(ctx context.Context) {
+		n.updateIndex(ctx, log.WithField("component", "index"), index, onProgress)
+	})
+}
+
+func (n *Node) openIndexStorage(config BotConfig, keyPair boxKeyPair, log bindingslogging.Logger) (*index, error) {
+	storage, err := newStorageSettings(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid storage settings")
+	}
+
+	return openIndex(IndexDirectory(config), storage, keyPair, log)
+}
+
+func (n *Node) startIndexing(ctx context.Context, index *index, fn func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	n.index = index
+	n.indexCancel = cancel
+	n.indexDone = done
+
+	go func() {
+		defer close(done)
+		defer n.crashes.Recover("index")
+
+		fn(ctx)
+	}()
+}
+
+// closeIndex stops updating the index and closes it. It must be called
+// without holding the node's mutex.
+func (n *Node) closeIndex() {
+	n.mutex.Lock()
+	index, cancel, done := n.index, n.indexCancel, n.indexDone
+	n.index, n.indexCancel, n.indexDone = nil, nil, nil
+	log := n.log
+	n.mutex.Unlock()
+
+	if cancel == nil {
+		return
+	}
+
+	cancel()
+	<-done
+
+	if index == nil {
+		return
+	}
+
+	if err := index.Close(); err != nil && log != nil {
+		log.Error().WithField(bindingslogging.ErrorField, err).Message("error closing the index")
+	}
+}
+
+func (n *Node) getIndex() (*index, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if !n.isRunning() {
+		return nil, ErrNodeIsNotRunning
+	}
+
+	if n.index == nil {
+		return nil, ErrIndexIsNotAvailable
+	}
+
+	return n.index, nil
+}
+
+// RebuildIndex removes all entries from the index so that it is rebuilt in the
+// background. The progress is reported using the callback passed to Start.
+func (n *Node) RebuildIndex() error {
+	index, err := n.getIndex()
+	if err != nil {
+		return errors.Wrap(err, "error getting the index")
+	}
+
+	return index.Reset()
+}
+
+// updateIndex keeps indexing the receive log while the node is suspended so
+// that messages published locally reach the subscriptions and the queries
+// relying on the index.
+func (n *Node) updateIndex(ctx context.Context, log bindingslogging.Logger, index *index, onProgress IndexOnProgressFn) {
+	var lastReport time.Time
+	catchingUp := false
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		full, next, err := n.indexReceiveLog(index)
+		if err != nil {
+			log.Debug().WithField(bindingslogging.ErrorField, err).Message("error updating the index")
+		}
+
+		if err == nil && onProgress != nil {
+			switch {
+			case full && time.Since(lastReport) >= indexProgressInterval:
+				n.reportIndexProgress(log, next, onProgress)
+				lastReport = time.Now()
+				catchingUp = true
+			case !full && catchingUp:
+				onProgress(IndexProgress{
+					ItemsProcessed: int64(next.Int()),
+					ItemsTotal:     int64(next.Int()),
+					Done:           true,
+				})
+				catchingUp = false
+			}
+		}
+
+		if full {
+			continue
+		}
+
+		select {
+		case <-time.After(indexPollInterval):
+		case <-n.receiveLog.publishes():
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// pollReceiveLog wakes up the subscriptions periodically if the index, which
+// normally notifies them about new messages, isn't available.
+func (n *Node) pollReceiveLog(ctx context.Context) {
+	for {
+		select {
+		case <-time.After(indexPollInterval):
+		case <-n.receiveLog.publishes():
+		case <-ctx.Done():
+			return
+		}
+
+		n.receiveLog.notify()
+	}
+}
+
+func (n *Node) reportIndexProgress(log bindingslogging.Logger, next common.ReceiveLogSequence, onProgress IndexOnProgressFn) {
+	service, err := n.Get()
+	if err != nil {
+		log.Debug().WithField(bindingslogging.ErrorField, err).Message("error getting the service")
+		return
+	}
+
+	status, err := service.App.Queries.Status.Handle()
+	if err != nil {
+		log.Debug().WithField(bindingslogging.ErrorField, err).Message("error getting the status")
+		return
+	}
+
+	onProgress(IndexProgress{
+		ItemsProcessed: int64(next.Int()),
+		ItemsTotal:     int64(status.NumberOfMessages),
+	})
+}
+
+// indexReceiveLog indexes one batch of messages. The returned bool is true if
+// the batch was full and therefore there may be more messages waiting. The
+// returned sequence is the sequence of the first message which wasn't indexed
+// yet.
+func (n *Node) indexReceiveLog(index *index) (bool, common.ReceiveLogSequence, error) {
+	service, err := n.Get()
+	if err != nil {
+		return false, common.ReceiveLogSequence{}, errors.Wrap(err, "error getting the service")
+	}
+
+	next, err := index.Next()
+	if err != nil {
+		return false, common.ReceiveLogSequence{}, errors.Wrap(err, "error getting the next sequence")
+	}
+
+	query, err := queries.NewReceiveLog(next, indexBatchSize)
+	if err != nil {
+		return false, common.ReceiveLogSequence{}, errors.Wrap(err, "error creating the query")
+	}
+
+	msgs, err := service.App.Queries.ReceiveLog.Handle(query)
+	if err != nil {
+		return false, common.ReceiveLogSequence{}, errors.Wrap(err, "error querying the receive log")
+	}
+
+	if err := index.Add(next, msgs); err != nil {
+		if errors.Is(err, errIndexWasReset) {
+			return true, common.ReceiveLogSequence{}, nil
+		}
+		return false, common.ReceiveLogSequence{}, errors.Wrap(err, "error adding the messages")
+	}
+
+	if len(msgs) > 0 {
+		n.receiveLog.notify()
+
+		next, err = common.NewReceiveLogSequence(msgs[len(msgs)-1].Sequence.Int() + 1)
+		if err != nil {
+			return false, common.ReceiveLogSequence{}, errors.Wrap(err, "error creating the sequence")
+		}
+	}
+
+	return len(msgs) == indexBatchSize, next, nil
+}
@@ -0,0 +1,169 @@
+package bindings
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+	bindingslogging "verseproj/scuttlegobridge/logging"
+
+	"github.com/planetary-social/scuttlego/service"
+	"github.com/planetary-social/scuttlego/service/app"
+	"github.com/planetary-social/scuttlego/service/app/common"
+	"github.com/planetary-social/scuttlego/service/app/queries"
+	"github.com/planetary-social/scuttlego/service/domain/feeds/message"
+	"github.com/planetary-social/scuttlego/service/domain/identity"
+	"github.com/planetary-social/scuttlego/service/domain/refs"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndex_MessagesCanBeFoundAfterBeingIndexed(t *testing.T) {
+	index := newTestIndex(t)
+
+	next, err := index.Next()
+	require.NoError(t, err)
+	require.Equal(t, 0, next.Int())
+
+	msg1 := newTestLogMessage(t, 0, `{"type":"post"}`)
+	msg2 := newTestLogMessage(t, 5, `{"type":"post"}`)
+	require.NoError(t, index.Add(common.MustNewReceiveLogSequence(0), []queries.LogMessage{msg1, msg2}))
+
+	next, err = index.Next()
+	require.NoError(t, err)
+	require.Equal(t, 6, next.Int())
+
+	sequence, ok, err := index.ReceiveLogSequence(msg2.Message.Id())
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 5, sequence.Int())
+
+	_, ok, err = index.ReceiveLogSequence(newTestLogMessage(t, 6, `{"type":"post"}`).Message.Id())
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestNode_GetMessageByKeyRequiresRunningNode(t *testing.T) {
+	node := NewNode()
+
+	_, _, err := node.GetMessageByKey(newTestLogMessage(t, 0, `{"type":"post"}`).Message.Id(), refs.Feed{})
+	require.Error(t, err)
+}
+
+func TestNode_LocalMessagesAreIndexedWhileSuspended(t *testing.T) {
+	receiveLog := newFakeReceiveLog()
+	index := newTestIndex(t)
+
+	node := newTestNode(t, service.Service{
+		App: app.Application{
+			Queries: app.Queries{
+				ReceiveLog: queries.NewReceiveLogHandler(receiveLog),
+			},
+		},
+	})
+	node.suspended = true
+
+	changed := node.receiveLog.wait()
+	node.startIndexing(node.ctx, index, func(ctx context.Context) {
+		node.updateIndex(ctx, node.log, index, nil)
+	})
+	t.Cleanup(func() {
+		node.indexCancel()
+		<-node.indexDone
+	})
+
+	msg := newTestLogMessage(t, 0, `{"type":"post"}`)
+	receiveLog.Append(msg)
+	node.receiveLog.publish()
+
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscriptions weren't notified")
+	}
+
+	sequence, ok, err := index.ReceiveLogSequence(msg.Message.Id())
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 0, sequence.Int())
+}
+
+func newTestIndex(t *testing.T) *index {
+	private, err := identity.NewPrivate()
+	require.NoError(t, err)
+
+	keyPair, err := newBoxKeyPair(private)
+	require.NoError(t, err)
+
+	return newTestIndexWithKeyPair(t, keyPair)
+}
+
+func newTestIndexWithKeyPair(t *testing.T, keyPair boxKeyPair) *index {
+	storage, err := storageProfileSettings(StorageProfileLowMemory)
+	require.NoError(t, err)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	index, err := openIndex(t.TempDir(), storage, keyPair, bindingslogging.NewLogrusLogger(logger))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, index.Close())
+	})
+
+	return index
+}
+
+func newTestLogMessage(t *testing.T, receiveLogSequence int, content string) queries.LogMessage {
+	private, err := identity.NewPrivate()
+	require.NoError(t, err)
+
+	author, err := refs.NewIdentityFromPublic(private.Public())
+	require.NoError(t, err)
+
+	idBytes := make([]byte, 32)
+	_, err = rand.Read(idBytes)
+	require.NoError(t, err)
+
+	id, err := refs.NewMessage(fmt.Sprintf("%%%s.sha256", base64.StdEncoding.EncodeToString(idBytes)))
+	require.NoError(t, err)
+
+	raw := fmt.Sprintf(`{"previous":null,"author":"%s","sequence":1,"timestamp":0,"hash":"sha256","content":%s,"signature":"sig"}`, author, content)
+
+	msg, err := message.NewMessage(
+		id,
+		nil,
+		message.NewFirstSequence(),
+		author,
+		author.MainFeed(),
+		time.Now(),
+		message.MustNewContent(message.MustNewRawContent([]byte(content)), nil, nil),
+		message.MustNewRawMessage([]byte(raw)),
+	)
+	require.NoError(t, err)
+
+	return queries.LogMessage{
+		Message:  msg,
+		Sequence: common.MustNewReceiveLogSequence(receiveLogSequence),
+	}
+}
+
+func TestIndex_ReceiveLogSequencesAreSetForIndexedMessages(t *testing.T) {
+	index := newTestIndex(t)
+
+	indexed := newTestLogMessage(t, 0, `{"type":"post"}`)
+	require.NoError(t, index.Add(common.MustNewReceiveLogSequence(0), []queries.LogMessage{indexed}))
+
+	msgs := []FeedMessage{
+		{Message: indexed.Message},
+		{Message: newTestLogMessage(t, 1, `{"type":"post"}`).Message},
+	}
+	require.NoError(t, index.ReceiveLogSequences(msgs))
+
+	require.NotNil(t, msgs[0].Sequence)
+	require.Equal(t, 0, msgs[0].Sequence.Int())
+	require.Nil(t, msgs[1].Sequence)
+}
@@ -0,0 +1,185 @@
+package bindings
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	bindingslogging "verseproj/scuttlegobridge/logging"
+
+	"github.com/boreq/errors"
+	"github.com/planetary-social/scuttlego/service"
+	"github.com/planetary-social/scuttlego/service/app/commands"
+	"github.com/planetary-social/scuttlego/service/domain/refs"
+)
+
+// MemoryPressure is reported by the host OS. The numeric values are passed
+// by the caller and therefore must not change.
+type MemoryPressure int
+
+const (
+	MemoryPressureNormal   MemoryPressure = 0
+	MemoryPressureWarning  MemoryPressure = 1
+	MemoryPressureCritical MemoryPressure = 2
+)
+
+func NewMemoryPressure(level int) (MemoryPressure, error) {
+	switch v := MemoryPressure(level); v {
+	case MemoryPressureNormal, MemoryPressureWarning, MemoryPressureCritical:
+		return v, nil
+	default:
+		return 0, fmt.Errorf("unknown memory pressure level '%d'", level)
+	}
+}
+
+// BlobWant describes what happened to a blob requested using WantBlob. The
+// numeric values are returned to the caller and therefore must not change.
+type BlobWant int
+
+const (
+	BlobWantStarted  BlobWant = 1
+	BlobWantDeferred BlobWant = 2
+)
+
+// MemoryStats describes the memory usage of the whole process.
+type MemoryStats struct {
+	AllocBytes        uint64  `json:"allocBytes"`
+	SysBytes          uint64  `json:"sysBytes"`
+	HeapIdleBytes     uint64  `json:"heapIdleBytes"`
+	HeapReleasedBytes uint64  `json:"heapReleasedBytes"`
+	Mallocs           uint64  `json:"mallocs"`
+	Frees             uint64  `json:"frees"`
+	NumGC             uint32  `json:"numGC"`
+	GCCPUFraction     float64 `json:"gcCPUFraction"`
+	Goroutines        int     `json:"goroutines"`
+	MemoryLimitBytes  int64   `json:"memoryLimitBytes"`
+}
+
+func ReadMemoryStats() MemoryStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	return MemoryStats{
+		AllocBytes:        m.Alloc,
+		SysBytes:          m.Sys,
+		HeapIdleBytes:     m.HeapIdle,
+		HeapReleasedBytes: m.HeapReleased,
+		Mallocs:           m.Mallocs,
+		Frees:             m.Frees,
+		NumGC:             m.NumGC,
+		GCCPUFraction:     m.GCCPUFraction,
+		Goroutines:        runtime.NumGoroutine(),
+		MemoryLimitBytes:  debug.SetMemoryLimit(-1),
+	}
+}
+
+// NotifyMemoryPressure records the memory pressure reported by the host OS
+// and returns immediately. The pressure is applied in the background:
+//
+//   - Warning: a garbage collection is forced and new blob downloads
+//     requested using WantBlob are deferred.
+//   - Critical: additionally memory is returned to the OS.
+//   - Normal: the deferred blob downloads are started.
+//
+// Scuttlego doesn't make it possible to pause the blob downloads it already
+// started or to lower the number of feeds replicated concurrently so those
+// aren't affected and peers stay connected. Badger's block caches are sized
+// when the storage is opened and aren't shrunk either, the service is never
+// rebuilt as reopening the storage would allocate even more memory. Use a
+// storage profile with smaller caches on devices with little memory.
+func (n *Node) NotifyMemoryPressure(pressure MemoryPressure) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if !n.isRunning() {
+		return ErrNodeIsNotRunning
+	}
+
+	n.memoryPressure = pressure
+	n.log.Debug().WithField("pressure", pressure).Message("memory pressure changed")
+
+	ctx := n.ctx
+	go func() {
+		defer n.crashes.Recover("memory pressure")
+
+		n.applyMemoryPressure(ctx)
+	}()
+
+	return nil
+}
+
+// applyMemoryPressure applies the current memory pressure. Calls are
+// serialized so if the pressure changes quickly the later calls apply the
+// latest pressure again instead of racing with each other.
+func (n *Node) applyMemoryPressure(ctx context.Context) {
+	n.memoryPressureMutex.Lock()
+	defer n.memoryPressureMutex.Unlock()
+
+	n.mutex.Lock()
+	if ctx.Err() != nil {
+		n.mutex.Unlock()
+		return
+	}
+	pressure := n.memoryPressure
+	service := n.service
+	log := n.log
+	var deferred []refs.Blob
+	if pressure == MemoryPressureNormal {
+		deferred = n.deferredBlobWants
+		n.deferredBlobWants = nil
+	}
+	n.mutex.Unlock()
+
+	switch pressure {
+	case MemoryPressureWarning:
+		runtime.GC()
+	case MemoryPressureCritical:
+		debug.FreeOSMemory()
+	}
+
+	for _, id := range deferred {
+		if err := downloadBlob(service, id); err != nil {
+			log.Error().WithField(bindingslogging.ErrorField, err).WithField("blob", id.String()).Message("error starting a deferred blob download")
+		}
+	}
+}
+
+// WantBlob starts downloading the blob from peers. If the node is under
+// memory pressure the download is deferred until the pressure returns to
+// normal and BlobWantDeferred is returned. Deferred downloads are dropped if
+// the node is stopped before that.
+func (n *Node) WantBlob(id refs.Blob) (BlobWant, error) {
+	n.mutex.Lock()
+
+	if !n.isRunning() {
+		n.mutex.Unlock()
+		return 0, ErrNodeIsNotRunning
+	}
+
+	if n.memoryPressure != MemoryPressureNormal {
+		n.deferredBlobWants = append(n.deferredBlobWants, id)
+		n.mutex.Unlock()
+		return BlobWantDeferred, nil
+	}
+
+	service := n.service
+	n.mutex.Unlock()
+
+	if err := downloadBlob(service, id); err != nil {
+		return 0, err
+	}
+
+	return BlobWantStarted, nil
+}
+
+func downloadBlob(service *service.Service, id refs.Blob) error {
+	cmd := commands.DownloadBlob{
+		Id: id,
+	}
+
+	if err := service.App.Commands.DownloadBlob.Handle(cmd); err != nil {
+		return errors.Wrap(err, "command failed")
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package bindings
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/planetary-social/scuttlego/service"
+	"github.com/planetary-social/scuttlego/service/app"
+	"github.com/planetary-social/scuttlego/service/app/commands"
+	"github.com/planetary-social/scuttlego/service/domain/refs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMemoryPressure(t *testing.T) {
+	for _, level := range []int{0, 1, 2} {
+		pressure, err := NewMemoryPressure(level)
+		require.NoError(t, err)
+		require.Equal(t, MemoryPressure(level), pressure)
+	}
+
+	for _, level := range []int{-1, 3} {
+		_, err := NewMemoryPressure(level)
+		require.Error(t, err)
+	}
+}
+
+func TestNode_WantBlobIsDeferredUnderMemoryPressure(t *testing.T) {
+	wantList := newFakeBlobWantList()
+	node := newTestNode(t, service.Service{
+		App: app.Application{
+			Commands: app.Commands{
+				DownloadBlob: commands.NewDownloadBlobHandler(wantList, wantList),
+			},
+		},
+	})
+
+	id1 := newTestBlobRef(t)
+	want, err := node.WantBlob(id1)
+	require.NoError(t, err)
+	require.Equal(t, BlobWantStarted, want)
+	require.Equal(t, []refs.Blob{id1}, wantList.Wanted())
+
+	require.NoError(t, node.NotifyMemoryPressure(MemoryPressureWarning))
+
+	id2 := newTestBlobRef(t)
+	want, err = node.WantBlob(id2)
+	require.NoError(t, err)
+	require.Equal(t, BlobWantDeferred, want)
+	require.Equal(t, []refs.Blob{id1}, wantList.Wanted())
+
+	require.NoError(t, node.NotifyMemoryPressure(MemoryPressureNormal))
+
+	require.Eventually(t, func() bool {
+		return len(wantList.Wanted()) == 2
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, []refs.Blob{id1, id2}, wantList.Wanted())
+}
+
+func TestNode_NotifyMemoryPressureRequiresRunningNode(t *testing.T) {
+	node := NewNode()
+
+	require.ErrorIs(t, node.NotifyMemoryPressure(MemoryPressureCritical), ErrNodeIsNotRunning)
+}
+
+func newTestBlobRef(t *testing.T) refs.Blob {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	require.NoError(t, err)
+
+	id, err := refs.NewBlob(fmt.Sprintf("&%s.sha256", base64.StdEncoding.EncodeToString(b)))
+	require.NoError(t, err)
+	return id
+}
+
+type fakeBlobWantList struct {
+	mutex  sync.Mutex
+	wanted []refs.Blob
+}
+
+func newFakeBlobWantList() *fakeBlobWantList {
+	return &fakeBlobWantList{}
+}
+
+func (f *fakeBlobWantList) Transact(fn func(adapters commands.Adapters) error) error {
+	return fn(commands.Adapters{BlobWantList: f})
+}
+
+func (f *fakeBlobWantList) Get() time.Time {
+	return time.Now()
+}
+
+func (f *fakeBlobWantList) Add(id refs.Blob, until time.Time) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.wanted = append(f.wanted, id)
+	return nil
+}
+
+func (f *fakeBlobWantList) Wanted() []refs.Blob {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return append([]refs.Blob(nil), f.wanted...)
+}
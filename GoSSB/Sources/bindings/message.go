@@ -0,0 +1,73 @@
+package bindings
+
+import (
+	"github.com/boreq/errors"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/planetary-social/scuttlego/service/app/commands"
+	"github.com/planetary-social/scuttlego/service/app/common"
+	"github.com/planetary-social/scuttlego/service/app/queries"
+	"github.com/planetary-social/scuttlego/service/domain/feeds/message"
+	"github.com/planetary-social/scuttlego/service/domain/refs"
+)
+
+var ErrMessageNotFound = errors.New("message not found")
+
+// GetMessageByKey returns the message with the given key. The receive log
+// sequence is nil if the message wasn't indexed yet. ErrMessageNotFound is
+// returned if the message isn't stored locally. In that case, if the author
+// isn't zero, the author's feed is requested from peers. Scuttlego can't
+// request individual messages so the whole feed is replicated.
+func (n *Node) GetMessageByKey(id refs.Message, author refs.Feed) (message.Message, *common.ReceiveLogSequence, error) {
+	service, err := n.Get()
+	if err != nil {
+		return message.Message{}, nil, errors.Wrap(err, "error getting the service")
+	}
+
+	query, err := queries.NewGetMessage(id)
+	if err != nil {
+		return message.Message{}, nil, errors.Wrap(err, "error creating the query")
+	}
+
+	msg, err := service.App.Queries.GetMessage.Handle(query)
+	if err != nil {
+		if !errors.Is(err, badger.ErrKeyNotFound) {
+			return message.Message{}, nil, errors.Wrap(err, "query failed")
+		}
+
+		if !author.IsZero() {
+			if err := requestFeed(service, author); err != nil {
+				return message.Message{}, nil, errors.Wrap(err, "error requesting the feed")
+			}
+		}
+
+		return message.Message{}, nil, ErrMessageNotFound
+	}
+
+	index, err := n.getIndex()
+	if err != nil {
+		if errors.Is(err, ErrIndexIsNotAvailable) {
+			return msg, nil, nil
+		}
+		return message.Message{}, nil, errors.Wrap(err, "error getting the index")
+	}
+
+	sequence, ok, err := index.ReceiveLogSequence(id)
+	if err != nil {
+		return message.Message{}, nil, errors.Wrap(err, "error getting the receive log sequence")
+	}
+
+	if !ok {
+		return msg, nil, nil
+	}
+
+	return msg, &sequence, nil
+}
+
+func requestFeed(service *Service, feed refs.Feed) error {
+	cmd, err := commands.NewDownloadFeed(feed)
+	if err != nil {
+		return errors.Wrap(err, "error creating the command")
+	}
+
+	return service.App.Commands.DownloadFeed.Handle(cmd)
+}
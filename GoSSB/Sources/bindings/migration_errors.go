@@ -0,0 +1,101 @@
+package bindings
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"syscall"
+
+	"github.com/boreq/errors"
+	"github.com/planetary-social/scuttlego/service/app/common"
+)
+
+// MigrationErrorCode describes why a migration failed. The numeric values are
+// passed to the OnError callback and therefore must not change.
+type MigrationErrorCode int
+
+const (
+	MigrationErrorUnknown                MigrationErrorCode = 0
+	MigrationErrorDiskFull               MigrationErrorCode = 1
+	MigrationErrorCorruptedOldRepository MigrationErrorCode = 2
+	MigrationErrorPermissionDenied       MigrationErrorCode = 3
+	MigrationErrorCancelled              MigrationErrorCode = 4
+	MigrationErrorDataInconsistency      MigrationErrorCode = 5
+)
+
+// goSSBMigrations are the names of the scuttlego migrations which read the
+// repository created by go-ssb.
+var goSSBMigrations = []string{
+	"delete_gossb_repository_in_old_format",
+	"import_data_from_gossb",
+}
+
+// Scuttlego doesn't export sentinel errors for the failures below so they
+// can only be recognized by the messages it wraps them with.
+var (
+	goSSBRepositoryReadErrors = []string{
+		"error making a bot",
+		"error opening log",
+		"error querying receive log",
+		"error getting next message",
+	}
+
+	dataInconsistencyErrors = []string{
+		"incorrect feed",
+		"convert message error",
+		"error determining sequences to drop",
+	}
+)
+
+// ClassifyMigrationError maps an error returned by scuttlego when running the
+// migrations to a MigrationErrorCode.
+func ClassifyMigrationError(err error) MigrationErrorCode {
+	if err == nil {
+		return MigrationErrorUnknown
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return MigrationErrorCancelled
+	case errors.Is(err, syscall.ENOSPC), errors.Is(err, syscall.EDQUOT):
+		return MigrationErrorDiskFull
+	case errors.Is(err, fs.ErrPermission), errors.Is(err, syscall.EROFS):
+		return MigrationErrorPermissionDenied
+	case errors.Is(err, common.ErrFeedMessageNotFound), containsAny(err, dataInconsistencyErrors):
+		return MigrationErrorDataInconsistency
+	case failedInGoSSBMigration(err) && (isDecodingError(err) || containsAny(err, goSSBRepositoryReadErrors)):
+		return MigrationErrorCorruptedOldRepository
+	default:
+		return MigrationErrorUnknown
+	}
+}
+
+func failedInGoSSBMigration(err error) bool {
+	for _, name := range goSSBMigrations {
+		if strings.Contains(err.Error(), fmt.Sprintf("error running migration '%s'", name)) {
+			return true
+		}
+	}
+	return false
+}
+
+func isDecodingError(err error) bool {
+	var syntaxErr *json.SyntaxError
+	var unmarshalTypeErr *json.UnmarshalTypeError
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &syntaxErr) ||
+		errors.As(err, &unmarshalTypeErr)
+}
+
+func containsAny(err error, messages []string) bool {
+	s := err.Error()
+	for _, message := range messages {
+		if strings.Contains(s, message) {
+			return true
+		}
+	}
+	return false
+}
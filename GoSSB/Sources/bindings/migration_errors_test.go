@@ -0,0 +1,79 @@
+package bindings
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/boreq/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyMigrationError(t *testing.T) {
+	testCases := []struct {
+		Name         string
+		Err          error
+		ExpectedCode MigrationErrorCode
+	}{
+		{
+			Name:         "nil",
+			Err:          nil,
+			ExpectedCode: MigrationErrorUnknown,
+		},
+		{
+			Name:         "unknown",
+			Err:          errors.New("some error"),
+			ExpectedCode: MigrationErrorUnknown,
+		},
+		{
+			Name:         "cancelled",
+			Err:          migrationError("import_data_from_gossb", context.Canceled),
+			ExpectedCode: MigrationErrorCancelled,
+		},
+		{
+			Name:         "disk_full",
+			Err:          migrationError("import_data_from_gossb", &os.PathError{Op: "write", Path: "/repo", Err: syscall.ENOSPC}),
+			ExpectedCode: MigrationErrorDiskFull,
+		},
+		{
+			Name:         "permission_denied",
+			Err:          migrationError("delete_gossb_repository_in_old_format", &os.PathError{Op: "remove", Path: "/repo", Err: syscall.EACCES}),
+			ExpectedCode: MigrationErrorPermissionDenied,
+		},
+		{
+			Name:         "corrupted_old_repository",
+			Err:          migrationError("import_data_from_gossb", errors.Wrap(io.ErrUnexpectedEOF, "margaret returned an error")),
+			ExpectedCode: MigrationErrorCorruptedOldRepository,
+		},
+		{
+			Name:         "old_repository_read_error",
+			Err:          migrationError("import_data_from_gossb", errors.Wrap(errors.New("some error"), "error getting next message")),
+			ExpectedCode: MigrationErrorCorruptedOldRepository,
+		},
+		{
+			Name:         "decoding_errors_in_other_migrations_are_unknown",
+			Err:          migrationError("other", io.ErrUnexpectedEOF),
+			ExpectedCode: MigrationErrorUnknown,
+		},
+		{
+			Name:         "data_inconsistency",
+			Err:          migrationError("import_data_from_gossb", errors.Wrap(errors.New("incorrect feed"), "error saving messages")),
+			ExpectedCode: MigrationErrorDataInconsistency,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			require.Equal(t, testCase.ExpectedCode, ClassifyMigrationError(testCase.Err))
+		})
+	}
+}
+
+// migrationError wraps the error the same way the scuttlego migration runner
+// does.
+func migrationError(name string, err error) error {
+	return errors.Wrap(errors.Wrap(err, fmt.Sprintf("error running migration '%s'", name)), "error running migrations")
+}
@@ -0,0 +1,252 @@
+package bindings
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	bindingslogging "verseproj/scuttlegobridge/logging"
+
+	"github.com/boreq/errors"
+	"github.com/planetary-social/scuttlego/migrations"
+)
+
+const migrationProgressInterval = time.Second
+
+// offset2 stores the offset of every message in the receive log of go-ssb
+// as a 64-bit integer.
+const goSSBOffsetSize = 8
+
+var (
+	ErrMigrationsCancelled     = errors.New("migrations were cancelled")
+	ErrMigrationsAreNotRunning = errors.New("migrations are not running")
+)
+
+// MigrationProgress describes the progress within a single migration. It is
+// estimated by comparing the number of messages in the receive log of the old
+// go-ssb repository with the number of messages which are already stored by
+// scuttlego so it is only meaningful when importing the old repository.
+type MigrationProgress struct {
+	ItemsProcessed int64
+	ItemsTotal     int64
+	BytesProcessed int64
+	BytesTotal     int64
+}
+
+type MigrationOnProgressFn func(migrationIndex, migrationsCount int, progress MigrationProgress)
+
+// migrationCanceller allows the migrations to be cancelled from outside of
+// the goroutine which runs them. Scuttlego saves the state of a migration as
+// it progresses so a cancelled migration resumes when it is run again.
+type migrationCanceller struct {
+	mutex     sync.Mutex
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+func newMigrationCanceller() *migrationCanceller {
+	return &migrationCanceller{}
+}
+
+// start returns the context which has to be passed to the migrations. The
+// returned function must be called once they finish and reports whether they
+// were cancelled.
+func (c *migrationCanceller) start(ctx context.Context) (context.Context, func() bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	c.cancel = cancel
+	c.cancelled = false
+
+	return ctx, func() bool {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		cancel()
+		c.cancel = nil
+		return c.cancelled
+	}
+}
+
+func (c *migrationCanceller) Cancel() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.cancel == nil {
+		return ErrMigrationsAreNotRunning
+	}
+
+	c.cancel()
+	c.cancelled = true
+	return nil
+}
+
+// goSSBImportEstimator estimates the progress of importing the old go-ssb
+// repository.
+type goSSBImportEstimator struct {
+	directory     string
+	countMessages func() (int, error)
+}
+
+func newGoSSBImportEstimator(directory string, countMessages func() (int, error)) goSSBImportEstimator {
+	return goSSBImportEstimator{
+		directory:     directory,
+		countMessages: countMessages,
+	}
+}
+
+// Estimate returns false if the progress can't be estimated, for example
+// because there is no old repository.
+func (e goSSBImportEstimator) Estimate() (MigrationProgress, bool, error) {
+	if e.directory == "" {
+		return MigrationProgress{}, false, nil
+	}
+
+	offsets, err := os.Stat(filepath.Join(e.directory, "log", "ofst"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return MigrationProgress{}, false, nil
+		}
+		return MigrationProgress{}, false, errors.Wrap(err, "error checking the offsets file")
+	}
+
+	data, err := os.Stat(filepath.Join(e.directory, "log", "data"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return MigrationProgress{}, false, nil
+		}
+		return MigrationProgress{}, false, errors.Wrap(err, "error checking the data file")
+	}
+
+	itemsTotal := offsets.Size() / goSSBOffsetSize
+	if itemsTotal == 0 {
+		return MigrationProgress{}, false, nil
+	}
+
+	count, err := e.countMessages()
+	if err != nil {
+		return MigrationProgress{}, false, errors.Wrap(err, "error counting messages")
+	}
+
+	// Forked feeds are dropped during the import so fewer messages may be
+	// stored than there are in the old repository.
+	itemsProcessed := int64(count)
+	if itemsProcessed > itemsTotal {
+		itemsProcessed = itemsTotal
+	}
+
+	return MigrationProgress{
+		ItemsProcessed: itemsProcessed,
+		ItemsTotal:     itemsTotal,
+		BytesProcessed: data.Size() * itemsProcessed / itemsTotal,
+		BytesTotal:     data.Size(),
+	}, true, nil
+}
+
+type migrationProgressEstimator interface {
+	Estimate() (MigrationProgress, bool, error)
+}
+
+// progressReportingCallback periodically reports the progress of the
+// running migration. No progress is reported after OnError or OnDone.
+type progressReportingCallback struct {
+	migrations.ProgressCallback
+
+	estimator  migrationProgressEstimator
+	onProgress MigrationOnProgressFn
+	log        bindingslogging.Logger
+	crashes    *crashReporter
+
+	mutex sync.Mutex
+	stop  func()
+}
+
+func newProgressReportingCallback(
+	callback migrations.ProgressCallback,
+	estimator migrationProgressEstimator,
+	onProgress MigrationOnProgressFn,
+	log bindingslogging.Logger,
+	crashes *crashReporter,
+) *progressReportingCallback {
+	return &progressReportingCallback{
+		ProgressCallback: callback,
+		estimator:        estimator,
+		onProgress:       onProgress,
+		log:              log,
+		crashes:          crashes,
+	}
+}
+
+func (c *progressReportingCallback) OnRunning(migrationIndex int, migrationsCount int) {
+	c.stopReporting()
+	c.ProgressCallback.OnRunning(migrationIndex, migrationsCount)
+
+	if c.onProgress == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer c.crashes.Recover("migration progress")
+		c.report(ctx, migrationIndex, migrationsCount)
+	}()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.stop = func() {
+		cancel()
+		<-done
+	}
+}
+
+func (c *progressReportingCallback) OnError(migrationIndex int, migrationsCount int, err error) {
+	c.stopReporting()
+	c.ProgressCallback.OnError(migrationIndex, migrationsCount, err)
+}
+
+func (c *progressReportingCallback) OnDone(migrationsCount int) {
+	c.stopReporting()
+	c.ProgressCallback.OnDone(migrationsCount)
+}
+
+func (c *progressReportingCallback) report(ctx context.Context, migrationIndex, migrationsCount int) {
+	var previous MigrationProgress
+
+	for {
+		select {
+		case <-time.After(migrationProgressInterval):
+		case <-ctx.Done():
+			return
+		}
+
+		progress, ok, err := c.estimator.Estimate()
+		if err != nil {
+			c.log.Debug().WithField(bindingslogging.ErrorField, err).Message("error estimating the migration progress")
+			continue
+		}
+
+		if !ok || progress == previous {
+			continue
+		}
+
+		previous = progress
+		c.onProgress(migrationIndex, migrationsCount, progress)
+	}
+}
+
+func (c *progressReportingCallback) stopReporting() {
+	c.mutex.Lock()
+	stop := c.stop
+	c.stop = nil
+	c.mutex.Unlock()
+
+	if stop != nil {
+		stop()
+	}
+}
@@ -0,0 +1,94 @@
+package bindings
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoSSBImportEstimator(t *testing.T) {
+	directory := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(directory, "log"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(directory, "log", "ofst"), make([]byte, 4*goSSBOffsetSize), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(directory, "log", "data"), make([]byte, 1000), 0600))
+
+	testCases := []struct {
+		Name             string
+		Count            int
+		ExpectedProgress MigrationProgress
+	}{
+		{
+			Name:  "nothing_imported",
+			Count: 0,
+			ExpectedProgress: MigrationProgress{
+				ItemsProcessed: 0,
+				ItemsTotal:     4,
+				BytesProcessed: 0,
+				BytesTotal:     1000,
+			},
+		},
+		{
+			Name:  "partially_imported",
+			Count: 1,
+			ExpectedProgress: MigrationProgress{
+				ItemsProcessed: 1,
+				ItemsTotal:     4,
+				BytesProcessed: 250,
+				BytesTotal:     1000,
+			},
+		},
+		{
+			Name:  "more_messages_than_in_old_repository",
+			Count: 10,
+			ExpectedProgress: MigrationProgress{
+				ItemsProcessed: 4,
+				ItemsTotal:     4,
+				BytesProcessed: 1000,
+				BytesTotal:     1000,
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			estimator := newGoSSBImportEstimator(directory, func() (int, error) {
+				return testCase.Count, nil
+			})
+
+			progress, ok, err := estimator.Estimate()
+			require.NoError(t, err)
+			require.True(t, ok)
+			require.Equal(t, testCase.ExpectedProgress, progress)
+		})
+	}
+}
+
+func TestGoSSBImportEstimator_NoOldRepository(t *testing.T) {
+	estimator := newGoSSBImportEstimator(t.TempDir(), func() (int, error) {
+		return 0, nil
+	})
+
+	_, ok, err := estimator.Estimate()
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestMigrationCanceller(t *testing.T) {
+	canceller := newMigrationCanceller()
+
+	require.ErrorIs(t, canceller.Cancel(), ErrMigrationsAreNotRunning)
+
+	ctx, finish := canceller.start(context.Background())
+	require.NoError(t, canceller.Cancel())
+	require.Error(t, ctx.Err())
+	require.True(t, finish())
+
+	ctx, finish = canceller.start(context.Background())
+	require.NoError(t, ctx.Err())
+	require.False(t, finish())
+
+	require.ErrorIs(t, canceller.Cancel(), ErrMigrationsAreNotRunning)
+}
@@ -0,0 +1,24 @@
+package bindings
+
+import (
+	"github.com/boreq/errors"
+	"github.com/planetary-social/scuttlego/service/domain/network"
+	"github.com/planetary-social/scuttlego/service/domain/refs"
+	multiserver "github.com/ssbc/go-ssb-multiserver"
+)
+
+func MultiserverAddressToAddressAndRef(multiserverAddress string) (network.Address, refs.Identity, error) {
+	netAddress, err := multiserver.ParseNetAddress([]byte(multiserverAddress))
+	if err != nil {
+		return network.Address{}, refs.Identity{}, errors.Wrap(err, "could not parse the address")
+	}
+
+	addr := network.NewAddress(netAddress.Addr.String())
+
+	identity, err := refs.NewIdentity(netAddress.Ref.String())
+	if err != nil {
+		return network.Address{}, refs.Identity{}, errors.Wrap(err, "error creating an identity ref")
+	}
+
+	return addr, identity, nil
+}
@@ -0,0 +1,24 @@
+package bindings
+
+import (
+	"github.com/boreq/errors"
+	"github.com/planetary-social/scuttlego/service/domain"
+)
+
+// parsePreferredPubs converts the multiserver addresses of the preferred pubs
+// to the format used by the peer manager of scuttlego.
+func parsePreferredPubs(multiserverAddresses []string) ([]domain.Pub, error) {
+	var preferredPubs []domain.Pub
+	for _, multiserverAddress := range multiserverAddresses {
+		addr, ref, err := MultiserverAddressToAddressAndRef(multiserverAddress)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing the address '%s'", multiserverAddress)
+		}
+
+		preferredPubs = append(preferredPubs, domain.Pub{
+			Identity: ref.Identity(),
+			Address:  addr,
+		})
+	}
+	return preferredPubs, nil
+}
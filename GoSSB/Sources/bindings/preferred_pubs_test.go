@@ -0,0 +1,45 @@
+package bindings
+
+import (
+	"encoding/base64"
+	"io"
+	"testing"
+	bindingslogging "verseproj/scuttlegobridge/logging"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePreferredPubs(t *testing.T) {
+	const pub = "net:159.223.109.68:8008~shs:fs26fDL6HzqnHoc2Ekq40AD0ETdf/D3Ze5oAIiEn8sM="
+
+	pubs, err := parsePreferredPubs(nil)
+	require.NoError(t, err)
+	require.Empty(t, pubs)
+
+	pubs, err = parsePreferredPubs([]string{pub})
+	require.NoError(t, err)
+	require.Len(t, pubs, 1)
+	require.Equal(t, "159.223.109.68:8008", pubs[0].Address.String())
+	require.Equal(t, "fs26fDL6HzqnHoc2Ekq40AD0ETdf/D3Ze5oAIiEn8sM=", pubs[0].Identity.String())
+
+	_, err = parsePreferredPubs([]string{pub, "invalid"})
+	require.Error(t, err)
+}
+
+func TestToConfigPassesPreferredPubsToPeerManager(t *testing.T) {
+	const pub = "net:159.223.109.68:8008~shs:fs26fDL6HzqnHoc2Ekq40AD0ETdf/D3Ze5oAIiEn8sM="
+
+	config := BotConfig{
+		NetworkKey:    base64.StdEncoding.EncodeToString(make([]byte, 32)),
+		Hops:          2,
+		PreferredPubs: []string{pub},
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	serviceConfig, err := NewNode().toConfig(config, bindingslogging.NewLogrusLogger(logger))
+	require.NoError(t, err)
+	require.Len(t, serviceConfig.PeerManagerConfig.PreferredPubs, 1)
+}
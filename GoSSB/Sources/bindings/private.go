@@ -0,0 +1,311 @@
+package bindings
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	bindingslogging "verseproj/scuttlegobridge/logging"
+
+	"github.com/boreq/errors"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/planetary-social/scuttlego/service/app/common"
+	"github.com/planetary-social/scuttlego/service/app/queries"
+	"github.com/planetary-social/scuttlego/service/domain/identity"
+	"github.com/planetary-social/scuttlego/service/domain/refs"
+	ssbrefs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/private/box"
+)
+
+const (
+	// MaxPrivateMessageRecipients is the limit used by other Scuttlebutt
+	// implementations for private-box messages.
+	MaxPrivateMessageRecipients = 7
+
+	boxedContentSuffix = ".box"
+)
+
+var indexPrefixPrivate = []byte("p:")
+
+// ErrInvalidPrivateMessage is returned if the content or the recipients of a
+// private message are invalid.
+var ErrInvalidPrivateMessage = errors.New("invalid private message")
+
+// PrivateMessage is a message which was encrypted for the local identity.
+// Value is the message with the content replaced by the decrypted content.
+type PrivateMessage struct {
+	Key      refs.Message
+	Value    []byte
+	Sequence common.ReceiveLogSequence
+}
+
+// PublishPrivate encrypts the content for the given recipients using
+// private-box and publishes it. The local identity has to be one of the
+// recipients for the message to appear in the private log.
+func (n *Node) PublishPrivate(content []byte, recipients []refs.Identity) (refs.Message, error) {
+	boxed, err := BoxPrivateMessage(content, recipients)
+	if err != nil {
+		return refs.Message{}, errors.Wrap(err, "error boxing the message")
+	}
+
+	return n.PublishRaw(boxed)
+}
+
+// PrivateLog returns the messages which were encrypted for the local identity
+// and have a receive log sequence greater or equal to the given sequence. The
+// messages are decrypted when they are indexed so messages which weren't
+// indexed yet aren't returned.
+func (n *Node) PrivateLog(start common.ReceiveLogSequence, limit int) ([]PrivateMessage, error) {
+	if limit <= 0 {
+		return nil, errors.New("limit must be positive")
+	}
+
+	index, err := n.getIndex()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting the index")
+	}
+
+	return index.PrivateLog(start, limit)
+}
+
+// BoxPrivateMessage validates the content and the recipients of a private
+// message and encrypts the content for the recipients using private-box. The
+// result can be published as the content of a message.
+func BoxPrivateMessage(content []byte, recipients []refs.Identity) ([]byte, error) {
+	if err := validatePrivateMessage(content, recipients); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPrivateMessage, err)
+	}
+
+	boxed, err := boxContent(content, recipients)
+	if err != nil {
+		return nil, errors.Wrap(err, "error encrypting the content")
+	}
+
+	return boxed, nil
+}
+
+func validatePrivateMessage(content []byte, recipients []refs.Identity) error {
+	var v struct {
+		Type string `json:"type"`
+	}
+
+	if err := json.Unmarshal(content, &v); err != nil {
+		return errors.Wrap(err, "content must be a JSON object")
+	}
+
+	if v.Type == "" {
+		return errors.New("content type is required")
+	}
+
+	if len(recipients) == 0 {
+		return errors.New("at least one recipient is required")
+	}
+
+	if len(recipients) > MaxPrivateMessageRecipients {
+		return fmt.Errorf("at most %d recipients are allowed", MaxPrivateMessageRecipients)
+	}
+
+	return nil
+}
+
+// boxContent encrypts the content and encodes it as a JSON string in the
+// format used by other Scuttlebutt implementations.
+func boxContent(content []byte, recipients []refs.Identity) ([]byte, error) {
+	seen := make(map[string]struct{})
+	var feedRefs []ssbrefs.FeedRef
+
+	for _, recipient := range recipients {
+		if _, ok := seen[recipient.String()]; ok {
+			continue
+		}
+		seen[recipient.String()] = struct{}{}
+
+		feedRef, err := ssbrefs.NewFeedRefFromBytes(recipient.Identity().PublicKey(), ssbrefs.RefAlgoFeedSSB1)
+		if err != nil {
+			return nil, errors.Wrap(err, "error converting the recipient")
+		}
+		feedRefs = append(feedRefs, feedRef)
+	}
+
+	ciphertext, err := box.NewBoxer(nil).Encrypt(content, feedRefs...)
+	if err != nil {
+		return nil, errors.Wrap(err, "error encrypting")
+	}
+
+	return json.Marshal(base64.StdEncoding.EncodeToString(ciphertext) + boxedContentSuffix)
+}
+
+// unboxContent returns false if the content isn't encrypted or if it wasn't
+// encrypted for the given identity.
+func unboxContent(content []byte, keyPair boxKeyPair) ([]byte, bool) {
+	if !bytes.HasSuffix(content, []byte(boxedContentSuffix+`"`)) {
+		return nil, false
+	}
+
+	var s string
+	if err := json.Unmarshal(content, &s); err != nil {
+		return nil, false
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(s, boxedContentSuffix))
+	if err != nil {
+		return nil, false
+	}
+
+	plaintext, err := box.NewBoxer(nil).Decrypt(keyPair, ciphertext)
+	if err != nil {
+		return nil, false
+	}
+
+	return plaintext, true
+}
+
+// boxKeyPair implements the interface required by private-box.
+type boxKeyPair struct {
+	id     ssbrefs.FeedRef
+	secret ed25519.PrivateKey
+}
+
+func newBoxKeyPair(private identity.Private) (boxKeyPair, error) {
+	id, err := ssbrefs.NewFeedRefFromBytes(private.Public().PublicKey(), ssbrefs.RefAlgoFeedSSB1)
+	if err != nil {
+		return boxKeyPair{}, errors.Wrap(err, "error creating the feed ref")
+	}
+
+	return boxKeyPair{
+		id:     id,
+		secret: private.PrivateKey(),
+	}, nil
+}
+
+func (k boxKeyPair) ID() ssbrefs.FeedRef {
+	return k.id
+}
+
+func (k boxKeyPair) Secret() ed25519.PrivateKey {
+	return k.secret
+}
+
+// storedPrivateMessage is the value of the index entries of private messages
+// which are keyed by their receive log sequences.
+type storedPrivateMessage struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// PrivateLog returns at most limit private messages with receive log sequences
+// greater or equal to the given sequence.
+func (i *index) PrivateLog(start common.ReceiveLogSequence, limit int) ([]PrivateMessage, error) {
+	var result []PrivateMessage
+
+	if err := i.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{
+			PrefetchValues: true,
+			PrefetchSize:   limit,
+			Prefix:         indexPrefixPrivate,
+		})
+		defer it.Close()
+
+		for it.Seek(indexPrivateKey(start.Int())); it.ValidForPrefix(indexPrefixPrivate) && len(result) < limit; it.Next() {
+			seq, err := decodeIndexInt(it.Item().Key()[len(indexPrefixPrivate):])
+			if err != nil {
+				return errors.Wrap(err, "error decoding the sequence")
+			}
+
+			sequence, err := common.NewReceiveLogSequence(seq)
+			if err != nil {
+				return errors.Wrap(err, "error creating the sequence")
+			}
+
+			var stored storedPrivateMessage
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &stored)
+			}); err != nil {
+				return errors.Wrap(err, "error reading the value")
+			}
+
+			key, err := refs.NewMessage(stored.Key)
+			if err != nil {
+				return errors.Wrap(err, "error creating the message ref")
+			}
+
+			result = append(result, PrivateMessage{
+				Key:      key,
+				Value:    stored.Value,
+				Sequence: sequence,
+			})
+		}
+
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "transaction failed")
+	}
+
+	return result, nil
+}
+
+// addPrivateMessage stores the decrypted message if it was encrypted for the
+// local identity. Messages which can be decrypted but whose content isn't
+// valid JSON are skipped so that they don't prevent the rest of the receive
+// log from being indexed.
+func (i *index) addPrivateMessage(txn *badger.Txn, msg queries.LogMessage) error {
+	content, ok := unboxContent(msg.Message.Content().Raw().Bytes(), i.keyPair)
+	if !ok {
+		return nil
+	}
+
+	value, err := replaceContent(msg.Message.Raw().Bytes(), content)
+	if err != nil {
+		i.log.Error().
+			WithField(bindingslogging.ErrorField, err).
+			WithField("message", msg.Message.Id().String()).
+			Message("skipping a private message which can't be decoded")
+		return nil
+	}
+
+	stored, err := json.Marshal(storedPrivateMessage{
+		Key:   msg.Message.Id().String(),
+		Value: value,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error marshaling the message")
+	}
+
+	if err := txn.Set(indexPrivateKey(msg.Sequence.Int()), stored); err != nil {
+		return errors.Wrap(err, "error setting the message")
+	}
+
+	return nil
+}
+
+func indexPrivateKey(seq int) []byte {
+	return append(append([]byte(nil), indexPrefixPrivate...), encodeIndexInt(seq)...)
+}
+
+// replaceContent replaces the content of the raw message keeping the order
+// of the remaining fields.
+func replaceContent(raw []byte, content []byte) ([]byte, error) {
+	var msg struct {
+		Previous  json.RawMessage `json:"previous"`
+		Author    json.RawMessage `json:"author"`
+		Sequence  json.RawMessage `json:"sequence"`
+		Timestamp json.RawMessage `json:"timestamp"`
+		Hash      json.RawMessage `json:"hash"`
+		Content   json.RawMessage `json:"content"`
+		Signature json.RawMessage `json:"signature"`
+	}
+
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling the message")
+	}
+
+	if !json.Valid(content) {
+		return nil, errors.New("decrypted content isn't valid JSON")
+	}
+
+	msg.Content = content
+
+	return json.Marshal(msg)
+}
@@ -0,0 +1,112 @@
+package bindings
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/planetary-social/scuttlego/service/app/common"
+	"github.com/planetary-social/scuttlego/service/app/queries"
+	"github.com/planetary-social/scuttlego/service/domain/identity"
+	"github.com/planetary-social/scuttlego/service/domain/refs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoxContent_CanBeUnboxedOnlyByRecipients(t *testing.T) {
+	recipient, recipientKeyPair := newTestBoxIdentity(t)
+	_, otherKeyPair := newTestBoxIdentity(t)
+
+	content := []byte(`{"type":"post","text":"hello"}`)
+
+	boxed, err := boxContent(content, []refs.Identity{recipient, recipient})
+	require.NoError(t, err)
+
+	var s string
+	require.NoError(t, json.Unmarshal(boxed, &s))
+
+	unboxed, ok := unboxContent(boxed, recipientKeyPair)
+	require.True(t, ok)
+	require.Equal(t, content, unboxed)
+
+	_, ok = unboxContent(boxed, otherKeyPair)
+	require.False(t, ok)
+
+	_, ok = unboxContent(content, recipientKeyPair)
+	require.False(t, ok)
+}
+
+func TestValidatePrivateMessage(t *testing.T) {
+	recipient, _ := newTestBoxIdentity(t)
+
+	tooManyRecipients := make([]refs.Identity, MaxPrivateMessageRecipients+1)
+	for i := range tooManyRecipients {
+		tooManyRecipients[i] = recipient
+	}
+
+	require.NoError(t, validatePrivateMessage([]byte(`{"type":"post"}`), []refs.Identity{recipient}))
+	require.Error(t, validatePrivateMessage([]byte(`{"text":"hello"}`), []refs.Identity{recipient}))
+	require.Error(t, validatePrivateMessage([]byte(`"hello"`), []refs.Identity{recipient}))
+	require.Error(t, validatePrivateMessage([]byte(`{"type":"post"}`), nil))
+	require.Error(t, validatePrivateMessage([]byte(`{"type":"post"}`), tooManyRecipients))
+}
+
+func TestReplaceContent(t *testing.T) {
+	raw := []byte(`{"previous":null,"author":"@a","sequence":1,"timestamp":2,"hash":"sha256","content":"abc.box","signature":"sig"}`)
+
+	value, err := replaceContent(raw, []byte(`{"type":"post"}`))
+	require.NoError(t, err)
+	require.Equal(t, `{"previous":null,"author":"@a","sequence":1,"timestamp":2,"hash":"sha256","content":{"type":"post"},"signature":"sig"}`, string(value))
+}
+
+func TestIndex_PrivateLogSkipsMessagesWhichCanNotBeDecoded(t *testing.T) {
+	local, localKeyPair := newTestBoxIdentity(t)
+	other, _ := newTestBoxIdentity(t)
+
+	index := newTestIndexWithKeyPair(t, localKeyPair)
+
+	boxed := func(content string, recipient refs.Identity) string {
+		b, err := boxContent([]byte(content), []refs.Identity{recipient})
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	public := newTestLogMessage(t, 0, `{"type":"post","text":"public"}`)
+	first := newTestLogMessage(t, 1, boxed(`{"type":"post","text":"first"}`, local))
+	poison := newTestLogMessage(t, 2, boxed(`not json`, local))
+	notForUs := newTestLogMessage(t, 3, boxed(`{"type":"post","text":"other"}`, other))
+	second := newTestLogMessage(t, 4, boxed(`{"type":"post","text":"second"}`, local))
+
+	require.NoError(t, index.Add(common.MustNewReceiveLogSequence(0), []queries.LogMessage{public, first, poison, notForUs, second}))
+
+	next, err := index.Next()
+	require.NoError(t, err)
+	require.Equal(t, 5, next.Int(), "the poison message must not stop indexing")
+
+	msgs, err := index.PrivateLog(common.MustNewReceiveLogSequence(0), 10)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+
+	require.Equal(t, first.Message.Id(), msgs[0].Key)
+	require.Equal(t, 1, msgs[0].Sequence.Int())
+	require.Contains(t, string(msgs[0].Value), `"content":{"type":"post","text":"first"}`)
+
+	require.Equal(t, second.Message.Id(), msgs[1].Key)
+	require.Equal(t, 4, msgs[1].Sequence.Int())
+
+	msgs, err = index.PrivateLog(common.MustNewReceiveLogSequence(2), 1)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	require.Equal(t, second.Message.Id(), msgs[0].Key)
+}
+
+func newTestBoxIdentity(t *testing.T) (refs.Identity, boxKeyPair) {
+	private, err := identity.NewPrivate()
+	require.NoError(t, err)
+
+	ref, err := refs.NewIdentityFromPublic(private.Public())
+	require.NoError(t, err)
+
+	keyPair, err := newBoxKeyPair(private)
+	require.NoError(t, err)
+
+	return ref, keyPair
+}
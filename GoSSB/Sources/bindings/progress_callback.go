@@ -37,7 +37,7 @@ func (l ProgressCallback) OnRunning(migrationIndex int, migrationsCount int) {
 }
 
 func (l ProgressCallback) OnError(migrationIndex int, migrationsCount int, err error) {
-	l.migrationOnErrorFn(migrationIndex, migrationsCount, 0)
+	l.migrationOnErrorFn(migrationIndex, migrationsCount, ClassifyMigrationError(err), err)
 }
 
 func (l ProgressCallback) OnDone(migrationsCount int) {
@@ -0,0 +1,267 @@
+package bindings
+
+import (
+	"github.com/boreq/errors"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/planetary-social/scuttlego/service/app/common"
+	"github.com/planetary-social/scuttlego/service/app/queries"
+	"github.com/planetary-social/scuttlego/service/domain/feeds/message"
+	"github.com/planetary-social/scuttlego/service/domain/refs"
+)
+
+var indexPrefixFeedReceiveLog = []byte("r:")
+
+type getMessageByIdFn func(id refs.Message) (message.Message, error)
+
+// PublishedLog returns at most limit messages published by the current
+// identity with receive log sequences greater or equal to the given sequence.
+// If a message has several receive log sequences the highest one is used, the
+// same as in scuttlego's published log.
+//
+// The messages are located using the index so that only the requested page
+// is read instead of the whole feed. Messages which weren't indexed yet are
+// found by reading the tail of the receive log. If the index isn't available
+// or lags too far behind, for example while it is being rebuilt, the whole
+// published log is queried instead.
+func (n *Node) PublishedLog(start common.ReceiveLogSequence, limit int) ([]queries.LogMessage, error) {
+	if limit <= 0 {
+		return nil, errors.New("limit must be positive")
+	}
+
+	n.mutex.Lock()
+	config := n.config
+	n.mutex.Unlock()
+
+	service, err := n.Get()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting the service")
+	}
+
+	private, err := toIdentity(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting the identity")
+	}
+
+	identityRef, err := refs.NewIdentityFromPublic(private.Public())
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating the identity ref")
+	}
+
+	index, err := n.getIndex()
+	if err != nil {
+		if errors.Is(err, ErrIndexIsNotAvailable) {
+			return queryPublishedLog(service, start, limit)
+		}
+		return nil, errors.Wrap(err, "error getting the index")
+	}
+
+	msgs, ok, err := publishedLog(index, newGetMessageByIdFn(service), newReceiveLogFn(service), identityRef.MainFeed(), start, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading the published log")
+	}
+
+	if !ok {
+		return queryPublishedLog(service, start, limit)
+	}
+
+	return msgs, nil
+}
+
+// publishedLog returns false if the index lags too far behind the receive
+// log.
+func publishedLog(index *index, get getMessageByIdFn, receiveLog receiveLogFn, feed refs.Feed, start common.ReceiveLogSequence, limit int) ([]queries.LogMessage, bool, error) {
+	entries, next, err := index.FeedReceiveLog(feed, start, limit)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "error reading the index")
+	}
+
+	var result []queries.LogMessage
+	for _, entry := range entries {
+		msg, err := get(entry.Id)
+		if err != nil {
+			return nil, false, errors.Wrapf(err, "error getting message '%s'", entry.Id)
+		}
+
+		result = append(result, queries.LogMessage{
+			Message:  msg,
+			Sequence: entry.Sequence,
+		})
+	}
+
+	if len(result) == limit {
+		return result, true, nil
+	}
+
+	tailStart := next
+	if start.Int() > tailStart.Int() {
+		tailStart = start
+	}
+
+	// The tail of the receive log is normally short as the index is updated
+	// continuously. A full batch means that the index is catching up.
+	tail, err := receiveLog(tailStart, indexBatchSize)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "error reading the receive log")
+	}
+
+	if len(tail) == indexBatchSize {
+		return nil, false, nil
+	}
+
+	var own []queries.LogMessage
+	received := make(map[string]struct{})
+	for _, msg := range tail {
+		if msg.Message.Feed().Equal(feed) {
+			own = append(own, msg)
+			received[msg.Message.Id().String()] = struct{}{}
+		}
+	}
+
+	// Messages received again are reported with the higher sequence.
+	filtered := result[:0]
+	for _, msg := range result {
+		if _, ok := received[msg.Message.Id().String()]; !ok {
+			filtered = append(filtered, msg)
+		}
+	}
+	result = append(filtered, own...)
+
+	if len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result, true, nil
+}
+
+type feedReceiveLogEntry struct {
+	Sequence common.ReceiveLogSequence
+	Id       refs.Message
+}
+
+// FeedReceiveLog returns at most limit messages of the given feed ordered by
+// their receive log sequences starting with the given sequence. The returned
+// sequence is the sequence of the first message of the receive log which
+// wasn't indexed yet.
+func (i *index) FeedReceiveLog(feed refs.Feed, start common.ReceiveLogSequence, limit int) ([]feedReceiveLogEntry, common.ReceiveLogSequence, error) {
+	var result []feedReceiveLogEntry
+	var next int
+
+	if err := i.db.View(func(txn *badger.Txn) error {
+		var err error
+		next, err = i.next(txn)
+		if err != nil {
+			return errors.Wrap(err, "error getting the next sequence")
+		}
+
+		prefix := indexFeedReceiveLogPrefix(feed)
+
+		it := txn.NewIterator(badger.IteratorOptions{
+			PrefetchValues: true,
+			PrefetchSize:   limit,
+			Prefix:         prefix,
+		})
+		defer it.Close()
+
+		for it.Seek(append(prefix, encodeIndexInt(start.Int())...)); it.ValidForPrefix(prefix) && len(result) < limit; it.Next() {
+			seq, err := decodeIndexInt(it.Item().Key()[len(prefix):])
+			if err != nil {
+				return errors.Wrap(err, "error decoding the sequence")
+			}
+
+			sequence, err := common.NewReceiveLogSequence(seq)
+			if err != nil {
+				return errors.Wrap(err, "error creating the sequence")
+			}
+
+			var id refs.Message
+			if err := it.Item().Value(func(val []byte) error {
+				id, err = refs.NewMessage(string(val))
+				return err
+			}); err != nil {
+				return errors.Wrap(err, "error reading the message ref")
+			}
+
+			result = append(result, feedReceiveLogEntry{Sequence: sequence, Id: id})
+		}
+
+		return nil
+	}); err != nil {
+		return nil, common.ReceiveLogSequence{}, errors.Wrap(err, "transaction failed")
+	}
+
+	sequence, err := common.NewReceiveLogSequence(next)
+	if err != nil {
+		return nil, common.ReceiveLogSequence{}, errors.Wrap(err, "error creating the sequence")
+	}
+
+	return result, sequence, nil
+}
+
+// addFeedReceiveLog keeps only the highest receive log sequence of each
+// message. The previous sequence is the one stored before the message was
+// indexed again or nil.
+func (i *index) addFeedReceiveLog(txn *badger.Txn, msg queries.LogMessage, previous *int) error {
+	feed := msg.Message.Feed()
+
+	if previous != nil {
+		if *previous > msg.Sequence.Int() {
+			return nil
+		}
+
+		if err := txn.Delete(indexFeedReceiveLogKey(feed, *previous)); err != nil {
+			return errors.Wrap(err, "error removing the previous sequence")
+		}
+	}
+
+	if err := txn.Set(indexFeedReceiveLogKey(feed, msg.Sequence.Int()), []byte(msg.Message.Id().String())); err != nil {
+		return errors.Wrap(err, "error setting the sequence")
+	}
+
+	return nil
+}
+
+// Keys have the following format: prefix, feed, 0, receive log sequence. The
+// values are message refs.
+func indexFeedReceiveLogPrefix(feed refs.Feed) []byte {
+	return append(append(append([]byte(nil), indexPrefixFeedReceiveLog...), feed.String()...), 0)
+}
+
+func indexFeedReceiveLogKey(feed refs.Feed, seq int) []byte {
+	return append(indexFeedReceiveLogPrefix(feed), encodeIndexInt(seq)...)
+}
+
+func newGetMessageByIdFn(service *Service) getMessageByIdFn {
+	return func(id refs.Message) (message.Message, error) {
+		query, err := queries.NewGetMessage(id)
+		if err != nil {
+			return message.Message{}, errors.Wrap(err, "error creating the query")
+		}
+		return service.App.Queries.GetMessage.Handle(query)
+	}
+}
+
+// queryPublishedLog reads the whole published log as scuttlego doesn't support
+// limiting it.
+func queryPublishedLog(service *Service, start common.ReceiveLogSequence, limit int) ([]queries.LogMessage, error) {
+	query := queries.PublishedLog{}
+
+	// the query is exclusive of the given sequence
+	if start.Int() > 0 {
+		lastSeq, err := common.NewReceiveLogSequence(start.Int() - 1)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating the sequence")
+		}
+		query.LastSeq = &lastSeq
+	}
+
+	msgs, err := service.App.Queries.PublishedLog.Handle(query)
+	if err != nil {
+		return nil, errors.Wrap(err, "query failed")
+	}
+
+	if len(msgs) > limit {
+		msgs = msgs[:limit]
+	}
+
+	return msgs, nil
+}
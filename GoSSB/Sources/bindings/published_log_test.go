@@ -0,0 +1,89 @@
+package bindings
+
+import (
+	"testing"
+
+	"github.com/planetary-social/scuttlego/service/app/common"
+	"github.com/planetary-social/scuttlego/service/app/queries"
+	"github.com/planetary-social/scuttlego/service/domain/feeds/formats"
+	"github.com/planetary-social/scuttlego/service/domain/feeds/message"
+	"github.com/planetary-social/scuttlego/service/domain/identity"
+	"github.com/planetary-social/scuttlego/service/domain/refs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishedLog(t *testing.T) {
+	index := newTestIndex(t)
+
+	private, err := identity.NewPrivate()
+	require.NoError(t, err)
+
+	own := newSignedFeed(t, private, formats.NewDefaultMessageHMAC(), "a", 5)
+	feed := own[0].Feed()
+
+	indexed := []queries.LogMessage{
+		{Message: own[0], Sequence: common.MustNewReceiveLogSequence(0)},
+		newTestLogMessage(t, 1, `{"type":"post"}`),
+		{Message: own[1], Sequence: common.MustNewReceiveLogSequence(2)},
+		{Message: own[2], Sequence: common.MustNewReceiveLogSequence(3)},
+		{Message: own[0], Sequence: common.MustNewReceiveLogSequence(4)},
+	}
+	require.NoError(t, index.Add(common.MustNewReceiveLogSequence(0), indexed))
+
+	tail := []queries.LogMessage{
+		newTestLogMessage(t, 5, `{"type":"post"}`),
+		{Message: own[3], Sequence: common.MustNewReceiveLogSequence(6)},
+		{Message: own[1], Sequence: common.MustNewReceiveLogSequence(7)},
+	}
+
+	get := func(id refs.Message) (message.Message, error) {
+		for _, msg := range own {
+			if msg.Id().Equal(id) {
+				return msg, nil
+			}
+		}
+		return message.Message{}, common.ErrFeedMessageNotFound
+	}
+
+	receiveLogReads := 0
+	receiveLog := func(start common.ReceiveLogSequence, limit int) ([]queries.LogMessage, error) {
+		receiveLogReads++
+		require.Equal(t, 5, start.Int())
+		return tail, nil
+	}
+
+	sequences := func(msgs []queries.LogMessage) []int {
+		var result []int
+		for _, msg := range msgs {
+			result = append(result, msg.Sequence.Int())
+		}
+		return result
+	}
+
+	t.Run("page_from_index", func(t *testing.T) {
+		receiveLogReads = 0
+
+		msgs, ok, err := publishedLog(index, get, receiveLog, feed, common.MustNewReceiveLogSequence(1), 2)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, []int{2, 3}, sequences(msgs))
+		require.Equal(t, 0, receiveLogReads, "a full page shouldn't read the receive log")
+	})
+
+	t.Run("messages_received_again_use_the_highest_sequence", func(t *testing.T) {
+		msgs, ok, err := publishedLog(index, get, receiveLog, feed, common.MustNewReceiveLogSequence(0), 10)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, []int{3, 4, 6, 7}, sequences(msgs))
+		require.Equal(t, own[0].Id(), msgs[1].Message.Id())
+	})
+
+	t.Run("index_lags_behind", func(t *testing.T) {
+		full := make([]queries.LogMessage, indexBatchSize)
+		_, ok, err := publishedLog(index, get, func(common.ReceiveLogSequence, int) ([]queries.LogMessage, error) {
+			return full, nil
+		}, feed, common.MustNewReceiveLogSequence(0), 10)
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+}
@@ -0,0 +1,219 @@
+package bindings
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/boreq/errors"
+)
+
+// reconfigureKind describes how a change of a particular config field is
+// applied to a running node.
+type reconfigureKind int
+
+const (
+	// reconfigureRequiresRestart means that the field can only be changed by
+	// stopping the node and initializing it again.
+	reconfigureRequiresRestart reconfigureKind = iota
+
+	// reconfigureLive means that the field is applied without rebuilding the
+	// running service.
+	reconfigureLive
+
+	// reconfigureReload means that the field is applied by rebuilding the
+	// service. Peer connections are closed but the node keeps running.
+	reconfigureReload
+)
+
+// reconfigurableFields maps the JSON names of the config fields which can be
+// changed while the node is running to the way they are applied. Fields which
+// aren't listed here require a restart.
+var reconfigurableFields = map[string]reconfigureKind{
+	"hops":               reconfigureReload,
+	"listenAddr":         reconfigureReload,
+	"preferredPubs":      reconfigureReload,
+	"storageProfile":     reconfigureReload,
+	"storageOptions":     reconfigureReload,
+	"maxServiceRestarts": reconfigureLive,
+}
+
+// ReconfigureResult lists the JSON names of the config fields which were
+// changed by a reconfiguration request. Fields which can't be changed while
+// the node is running are not applied.
+type ReconfigureResult struct {
+	Applied         []string `json:"applied"`
+	RequiresRestart []string `json:"requiresRestart"`
+}
+
+// reloadRequest is sent by the node to the supervisor. If builder is set the
+// service has to be rebuilt with it. The outcome is sent to result which
+// must be buffered.
+type reloadRequest struct {
+	builder     *serviceBuilder
+	maxRestarts int
+	result      chan error
+}
+
+func newReloadRequest(builder *serviceBuilder, maxRestarts int) reloadRequest {
+	return reloadRequest{
+		builder:     builder,
+		maxRestarts: maxRestarts,
+		result:      make(chan error, 1),
+	}
+}
+
+// Reconfigure applies a partial BotConfig encoded as JSON to the running
+// node. Fields which can't be changed without restarting the node are
+// reported in the result and left unchanged. If the new config can't be
+// applied the node keeps running with the previous config.
+func (n *Node) Reconfigure(patch []byte) (ReconfigureResult, error) {
+	n.reconfigureMutex.Lock()
+	defer n.reconfigureMutex.Unlock()
+
+	n.mutex.Lock()
+	if !n.isRunning() {
+		n.mutex.Unlock()
+		return ReconfigureResult{}, ErrNodeIsNotRunning
+	}
+	current := n.config
+	builder := n.builder
+	log := n.log
+	ctx := n.ctx
+	reloads := n.reloads
+	n.mutex.Unlock()
+
+	config, result, reload, err := applyConfigPatch(current, patch)
+	if err != nil {
+		return ReconfigureResult{}, newNodeError(NodeErrorInvalidConfig, errors.Wrap(err, "could not apply the patch"))
+	}
+
+	if len(result.Applied) == 0 {
+		return result, nil
+	}
+
+	var newBuilder *serviceBuilder
+	if reload {
+		serviceConfig, err := n.toConfig(config, log)
+		if err != nil {
+			return ReconfigureResult{}, newNodeError(NodeErrorInvalidConfig, errors.Wrap(err, "could not convert the config"))
+		}
+
+		builder.config = serviceConfig
+		newBuilder = &builder
+	}
+
+	req := newReloadRequest(newBuilder, config.MaxServiceRestarts)
+
+	select {
+	case reloads <- req:
+	case <-ctx.Done():
+		return ReconfigureResult{}, ErrNodeIsNotRunning
+	}
+
+	select {
+	case err := <-req.result:
+		if err != nil {
+			return ReconfigureResult{}, errors.Wrap(err, "error applying the new config")
+		}
+	case <-ctx.Done():
+		return ReconfigureResult{}, ErrNodeIsNotRunning
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.ctx == ctx {
+		n.config = config
+		n.builder = builder
+	}
+
+	n.crashes.SetConfig(config)
+
+	log.Debug().
+		WithField("applied", strings.Join(result.Applied, ",")).
+		WithField("requiresRestart", strings.Join(result.RequiresRestart, ",")).
+		Message("reconfigured the node")
+
+	return result, nil
+}
+
+// applyConfigPatch decodes the patch on top of the current config and
+// returns the config with the changes which can be applied to a running node.
+// The returned bool is true if applying them requires rebuilding the service.
+func applyConfigPatch(current BotConfig, patch []byte) (BotConfig, ReconfigureResult, bool, error) {
+	// Decoding into a shallow copy would overwrite the slices of the current
+	// config.
+	patched, err := copyConfig(current)
+	if err != nil {
+		return BotConfig{}, ReconfigureResult{}, false, errors.Wrap(err, "error copying the config")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(patch))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patched); err != nil {
+		return BotConfig{}, ReconfigureResult{}, false, errors.Wrap(err, "error decoding the patch")
+	}
+
+	result := ReconfigureResult{
+		Applied:         []string{},
+		RequiresRestart: []string{},
+	}
+
+	var reload bool
+
+	config := current
+	configValue := reflect.ValueOf(&config).Elem()
+	currentValue := reflect.ValueOf(current)
+	patchedValue := reflect.ValueOf(patched)
+
+	for i := 0; i < currentValue.NumField(); i++ {
+		if reflect.DeepEqual(currentValue.Field(i).Interface(), patchedValue.Field(i).Interface()) {
+			continue
+		}
+
+		name := jsonFieldName(currentValue.Type().Field(i))
+
+		kind, ok := reconfigurableFields[name]
+		if !ok {
+			result.RequiresRestart = append(result.RequiresRestart, name)
+			continue
+		}
+
+		if kind == reconfigureReload {
+			reload = true
+		}
+
+		configValue.Field(i).Set(patchedValue.Field(i))
+		result.Applied = append(result.Applied, name)
+	}
+
+	sort.Strings(result.Applied)
+	sort.Strings(result.RequiresRestart)
+
+	return config, result, reload, nil
+}
+
+func copyConfig(config BotConfig) (BotConfig, error) {
+	b, err := json.Marshal(config)
+	if err != nil {
+		return BotConfig{}, errors.Wrap(err, "error marshaling")
+	}
+
+	var result BotConfig
+	if err := json.Unmarshal(b, &result); err != nil {
+		return BotConfig{}, errors.Wrap(err, "error unmarshaling")
+	}
+
+	return result, nil
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
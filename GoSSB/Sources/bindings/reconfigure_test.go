@@ -0,0 +1,271 @@
+package bindings
+
+import (
+	"context"
+	"encoding/base64"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/planetary-social/scuttlego/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNode_ReconfiguringHopsRebuildsTheServiceInsteadOfModifyingIt(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := newTestSupervisor(t, newFakeServices(nil), 3)
+	node := s.node
+
+	config := BotConfig{
+		NetworkKey: base64.StdEncoding.EncodeToString(make([]byte, 32)),
+		Hops:       1,
+	}
+
+	serviceConfig, err := node.toConfig(config, s.log)
+	require.NoError(t, err)
+
+	var (
+		mutex    sync.Mutex
+		hops     = serviceConfig.Hops
+		runs     int
+		lastRead int
+
+		startedOnce sync.Once
+		started     = make(chan struct{})
+	)
+
+	s.build = func(ctx context.Context, builder serviceBuilder, migrate bool) (service.Service, func(), error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		hops = builder.config.Hops
+		return service.Service{}, func() {}, nil
+	}
+
+	// scuttlego reads the hops from its config without synchronization every
+	// time it opens a transaction
+	s.serve = func(ctx context.Context, service service.Service) error {
+		mutex.Lock()
+		runHops := hops
+		runs++
+		mutex.Unlock()
+
+		startedOnce.Do(func() {
+			close(started)
+		})
+
+		var read int
+		for ctx.Err() == nil {
+			read = runHops.Int()
+			runtime.Gosched()
+		}
+
+		mutex.Lock()
+		lastRead = read
+		mutex.Unlock()
+
+		return ctx.Err()
+	}
+
+	node.ctx = ctx
+	node.cancel = cancel
+	node.service = &service.Service{}
+	node.config = config
+	node.builder = serviceBuilder{config: serviceConfig}
+	node.log = s.log
+	node.reloads = make(chan reloadRequest)
+	s.reloads = node.reloads
+
+	done := make(chan NodeState)
+	go func() {
+		state, _ := s.run(ctx, service.Service{}, func() {})
+		done <- state
+	}()
+
+	<-started
+
+	result, err := node.Reconfigure([]byte(`{"hops": 2}`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"hops"}, result.Applied)
+
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return runs == 2
+	}, time.Second, 10*time.Millisecond)
+
+	mutex.Lock()
+	require.Equal(t, 2, hops.Int())
+	require.Equal(t, 1, lastRead, "the previous service should have seen the old hops")
+	mutex.Unlock()
+
+	require.Equal(t, 1, serviceConfig.Hops.Int(), "the config of the previous service shouldn't be modified")
+
+	cancel()
+
+	require.Equal(t, NodeStateStopped, <-done)
+}
+
+func TestApplyConfigPatch(t *testing.T) {
+	current := BotConfig{
+		NetworkKey:         "networkKey",
+		Hops:               1,
+		Repo:               "/repo",
+		ListenAddr:         ":8008",
+		MaxServiceRestarts: 5,
+		PreferredPubs:      []string{"a"},
+	}
+
+	testCases := []struct {
+		Name string
+
+		Patch string
+
+		ExpectedConfig  BotConfig
+		ExpectedResult  ReconfigureResult
+		ExpectedReload  bool
+		ExpectedFailure bool
+	}{
+		{
+			Name:  "empty",
+			Patch: `{}`,
+
+			ExpectedConfig: current,
+			ExpectedResult: ReconfigureResult{
+				Applied:         []string{},
+				RequiresRestart: []string{},
+			},
+			ExpectedReload: false,
+		},
+		{
+			Name:  "unchanged_fields_are_ignored",
+			Patch: `{"hops": 1, "repo": "/repo"}`,
+
+			ExpectedConfig: current,
+			ExpectedResult: ReconfigureResult{
+				Applied:         []string{},
+				RequiresRestart: []string{},
+			},
+			ExpectedReload: false,
+		},
+		{
+			Name:  "live",
+			Patch: `{"maxServiceRestarts": 10}`,
+
+			ExpectedConfig: BotConfig{
+				NetworkKey:         "networkKey",
+				Hops:               1,
+				Repo:               "/repo",
+				ListenAddr:         ":8008",
+				MaxServiceRestarts: 10,
+				PreferredPubs:      []string{"a"},
+			},
+			ExpectedResult: ReconfigureResult{
+				Applied:         []string{"maxServiceRestarts"},
+				RequiresRestart: []string{},
+			},
+			ExpectedReload: false,
+		},
+		{
+			Name:  "hops_rebuild_the_service",
+			Patch: `{"hops": 2}`,
+
+			ExpectedConfig: BotConfig{
+				NetworkKey:         "networkKey",
+				Hops:               2,
+				Repo:               "/repo",
+				ListenAddr:         ":8008",
+				MaxServiceRestarts: 5,
+				PreferredPubs:      []string{"a"},
+			},
+			ExpectedResult: ReconfigureResult{
+				Applied:         []string{"hops"},
+				RequiresRestart: []string{},
+			},
+			ExpectedReload: true,
+		},
+		{
+			Name:  "reload",
+			Patch: `{"hops": 2, "listenAddr": ":8009"}`,
+
+			ExpectedConfig: BotConfig{
+				NetworkKey:         "networkKey",
+				Hops:               2,
+				Repo:               "/repo",
+				ListenAddr:         ":8009",
+				MaxServiceRestarts: 5,
+				PreferredPubs:      []string{"a"},
+			},
+			ExpectedResult: ReconfigureResult{
+				Applied:         []string{"hops", "listenAddr"},
+				RequiresRestart: []string{},
+			},
+			ExpectedReload: true,
+		},
+		{
+			Name:  "fields_requiring_restart_are_not_applied",
+			Patch: `{"hops": 2, "repo": "/other", "networkKey": "other"}`,
+
+			ExpectedConfig: BotConfig{
+				NetworkKey:         "networkKey",
+				Hops:               2,
+				Repo:               "/repo",
+				ListenAddr:         ":8008",
+				MaxServiceRestarts: 5,
+				PreferredPubs:      []string{"a"},
+			},
+			ExpectedResult: ReconfigureResult{
+				Applied:         []string{"hops"},
+				RequiresRestart: []string{"networkKey", "repo"},
+			},
+			ExpectedReload: true,
+		},
+		{
+			Name:  "slices_are_replaced",
+			Patch: `{"preferredPubs": ["b"]}`,
+
+			ExpectedConfig: BotConfig{
+				NetworkKey:         "networkKey",
+				Hops:               1,
+				Repo:               "/repo",
+				ListenAddr:         ":8008",
+				MaxServiceRestarts: 5,
+				PreferredPubs:      []string{"b"},
+			},
+			ExpectedResult: ReconfigureResult{
+				Applied:         []string{"preferredPubs"},
+				RequiresRestart: []string{},
+			},
+			ExpectedReload: true,
+		},
+		{
+			Name:            "unknown_field",
+			Patch:           `{"unknown": 1}`,
+			ExpectedFailure: true,
+		},
+		{
+			Name:            "invalid_json",
+			Patch:           `{`,
+			ExpectedFailure: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			config, result, reload, err := applyConfigPatch(current, []byte(testCase.Patch))
+			if testCase.ExpectedFailure {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, testCase.ExpectedConfig, config)
+			require.Equal(t, testCase.ExpectedResult, result)
+			require.Equal(t, testCase.ExpectedReload, reload)
+			require.Equal(t, []string{"a"}, current.PreferredPubs)
+		})
+	}
+}
@@ -0,0 +1,366 @@
+package bindings
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode"
+
+	"github.com/boreq/errors"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/planetary-social/scuttlego/service/app/common"
+	"github.com/planetary-social/scuttlego/service/app/queries"
+	"github.com/planetary-social/scuttlego/service/domain/refs"
+)
+
+const (
+	searchTermMinLength = 2
+	searchTermMaxLength = 64
+
+	// searchMaxScanned limits the number of index entries examined by a single
+	// query so that queries with several terms return in a reasonable time.
+	searchMaxScanned = 10000
+
+	// searchSnippetContext is the number of characters preceding and following
+	// the match which are included in the snippet.
+	searchSnippetContext  = 40
+	searchSnippetEllipsis = "…"
+)
+
+var (
+	// ErrEmptySearchQuery is returned if the query doesn't contain any
+	// searchable terms.
+	ErrEmptySearchQuery = errors.New("search query doesn't contain any terms")
+
+	indexPrefixSearch = []byte("s:")
+)
+
+// SearchResult is a post which contains all terms of the query.
+type SearchResult struct {
+	Key      refs.Message
+	Sequence common.ReceiveLogSequence
+
+	// Snippet is a fragment of the text of the post around the first match.
+	Snippet string
+}
+
+type searchHit struct {
+	Key      refs.Message
+	Sequence common.ReceiveLogSequence
+}
+
+// Search returns at most limit posts containing all terms of the query,
+// ordered from the newest to the oldest. Only posts with a receive log
+// sequence lower than the cursor are returned, a cursor equal to 0 starts
+// with the newest post. The returned cursor should be passed to the next call,
+// 0 means that there are no more results. Terms prefixed with a # or an @ only
+// match hashtags and mentions, other terms match them as well as regular
+// words. Encrypted messages and messages which weren't indexed yet aren't
+// searched.
+func (n *Node) Search(query string, cursor int, limit int) ([]SearchResult, int, error) {
+	if limit <= 0 {
+		return nil, 0, errors.New("limit must be positive")
+	}
+
+	if cursor < 0 {
+		return nil, 0, errors.New("cursor can't be negative")
+	}
+
+	terms := searchTerms(query, false)
+	if len(terms) == 0 {
+		return nil, 0, ErrEmptySearchQuery
+	}
+
+	service, err := n.Get()
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "error getting the service")
+	}
+
+	index, err := n.getIndex()
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "error getting the index")
+	}
+
+	hits, next, err := index.Search(terms, cursor, limit)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "error querying the index")
+	}
+
+	var result []SearchResult
+	for _, hit := range hits {
+		query, err := queries.NewGetMessage(hit.Key)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "error creating the query")
+		}
+
+		msg, err := service.App.Queries.GetMessage.Handle(query)
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				continue
+			}
+			return nil, 0, errors.Wrapf(err, "error getting message '%s'", hit.Key)
+		}
+
+		result = append(result, SearchResult{
+			Key:      hit.Key,
+			Sequence: hit.Sequence,
+			Snippet:  searchSnippet(postText(msg.Content().Raw().Bytes()), terms),
+		})
+	}
+
+	return result, next, nil
+}
+
+// Search iterates over the entries of the longest term, which is likely to be
+// the least common one, and checks if the remaining terms are present.
+func (i *index) Search(terms []string, cursor int, limit int) ([]searchHit, int, error) {
+	driving := terms[0]
+	for _, term := range terms[1:] {
+		if len(term) > len(driving) {
+			driving = term
+		}
+	}
+
+	var result []searchHit
+	next := 0
+
+	prefix := indexSearchPrefix(driving)
+
+	if err := i.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{
+			PrefetchValues: false,
+			Reverse:        true,
+			Prefix:         prefix,
+		})
+		defer it.Close()
+
+		seek := append(append([]byte(nil), prefix...), 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+		if cursor > 0 {
+			seek = indexSearchKey(driving, cursor-1)
+		}
+
+		scanned := 0
+		for it.Seek(seek); it.ValidForPrefix(prefix); it.Next() {
+			if scanned == searchMaxScanned || len(result) == limit {
+				return nil
+			}
+			scanned++
+
+			seq, err := decodeIndexInt(it.Item().Key()[len(prefix):])
+			if err != nil {
+				return errors.Wrap(err, "error decoding the sequence")
+			}
+			next = seq
+
+			ok, err := i.containsTerms(txn, terms, seq)
+			if err != nil {
+				return errors.Wrap(err, "error checking the terms")
+			}
+
+			if !ok {
+				continue
+			}
+
+			hit, err := decodeSearchHit(it.Item(), seq)
+			if err != nil {
+				return errors.Wrap(err, "error decoding the hit")
+			}
+
+			result = append(result, hit)
+		}
+
+		next = 0
+		return nil
+	}); err != nil {
+		return nil, 0, errors.Wrap(err, "transaction failed")
+	}
+
+	return result, next, nil
+}
+
+func (i *index) containsTerms(txn *badger.Txn, terms []string, seq int) (bool, error) {
+	for _, term := range terms {
+		if _, err := txn.Get(indexSearchKey(term, seq)); err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return false, nil
+			}
+			return false, errors.Wrap(err, "error getting the item")
+		}
+	}
+	return true, nil
+}
+
+func (i *index) addSearchTerms(txn *badger.Txn, msg queries.LogMessage) error {
+	var post struct {
+		Type    string `json:"type"`
+		Text    string `json:"text"`
+		Channel string `json:"channel"`
+	}
+
+	if err := json.Unmarshal(msg.Message.Content().Raw().Bytes(), &post); err != nil || post.Type != "post" {
+		return nil
+	}
+
+	text := post.Text
+	if channel := strings.TrimPrefix(post.Channel, "#"); channel != "" {
+		text += " #" + channel
+	}
+
+	for _, term := range searchTerms(text, true) {
+		if err := txn.Set(indexSearchKey(term, msg.Sequence.Int()), []byte(msg.Message.Id().String())); err != nil {
+			return errors.Wrap(err, "error setting the term")
+		}
+	}
+
+	return nil
+}
+
+// Keys have the following format: prefix, term, 0, sequence. Values contain
+// the message ref.
+func indexSearchPrefix(term string) []byte {
+	return append(append(append([]byte(nil), indexPrefixSearch...), term...), 0)
+}
+
+func indexSearchKey(term string, seq int) []byte {
+	return append(indexSearchPrefix(term), encodeIndexInt(seq)...)
+}
+
+func decodeSearchHit(item *badger.Item, seq int) (searchHit, error) {
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return searchHit{}, errors.Wrap(err, "error getting the value")
+	}
+
+	key, err := refs.NewMessage(string(value))
+	if err != nil {
+		return searchHit{}, errors.Wrap(err, "error creating the message ref")
+	}
+
+	sequence, err := common.NewReceiveLogSequence(seq)
+	if err != nil {
+		return searchHit{}, errors.Wrap(err, "error creating the sequence")
+	}
+
+	return searchHit{
+		Key:      key,
+		Sequence: sequence,
+	}, nil
+}
+
+// searchTerms splits the text into unique lowercase terms. Words consist of
+// letters, digits, underscores and hyphens. Hashtags and mentions keep their
+// prefix. If expand is true they are additionally returned without the prefix
+// so that searching for a word also finds hashtags and mentions.
+func searchTerms(text string, expand bool) []string {
+	var terms []string
+	seen := make(map[string]struct{})
+
+	add := func(term string) {
+		length := len([]rune(term))
+		if length < searchTermMinLength || length > searchTermMaxLength {
+			return
+		}
+
+		if _, ok := seen[term]; ok {
+			return
+		}
+		seen[term] = struct{}{}
+		terms = append(terms, term)
+	}
+
+	runes := []rune(strings.ToLower(text))
+	for i := 0; i < len(runes); {
+		start := i
+
+		if (runes[i] == '#' || runes[i] == '@') && i+1 < len(runes) && isSearchWordStart(runes[i+1]) {
+			i++
+		} else if !isSearchWordStart(runes[i]) {
+			i++
+			continue
+		}
+
+		for i < len(runes) && isSearchWordRune(runes[i]) {
+			i++
+		}
+
+		term := strings.TrimRight(string(runes[start:i]), "_-")
+		add(term)
+
+		if expand && (term[0] == '#' || term[0] == '@') {
+			add(term[1:])
+		}
+	}
+
+	return terms
+}
+
+func isSearchWordStart(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isSearchWordRune(r rune) bool {
+	return isSearchWordStart(r) || r == '_' || r == '-'
+}
+
+// searchSnippet returns a fragment of the text around the first occurrence of
+// any of the terms or the beginning of the text if none of them occur in it.
+func searchSnippet(text string, terms []string) string {
+	runes := []rune(text)
+
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	match, matchLength := -1, 0
+	for _, term := range terms {
+		position := indexRunes(lower, []rune(term))
+		if position >= 0 && (match < 0 || position < match) {
+			match, matchLength = position, len([]rune(term))
+		}
+	}
+
+	if match < 0 {
+		match = 0
+	}
+
+	from := match - searchSnippetContext
+	if from < 0 {
+		from = 0
+	}
+
+	to := match + matchLength + searchSnippetContext
+	if to > len(runes) {
+		to = len(runes)
+	}
+
+	snippet := strings.TrimSpace(string(runes[from:to]))
+	if from > 0 {
+		snippet = searchSnippetEllipsis + snippet
+	}
+	if to < len(runes) {
+		snippet += searchSnippetEllipsis
+	}
+
+	return snippet
+}
+
+func indexRunes(s []rune, substr []rune) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if string(s[i:i+len(substr)]) == string(substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+func postText(content []byte) string {
+	var post struct {
+		Text string `json:"text"`
+	}
+
+	if err := json.Unmarshal(content, &post); err != nil {
+		return ""
+	}
+
+	return post.Text
+}
@@ -0,0 +1,121 @@
+package bindings
+
+import (
+	"testing"
+
+	"github.com/planetary-social/scuttlego/service/app/common"
+	"github.com/planetary-social/scuttlego/service/app/queries"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchTerms(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Text   string
+		Expand bool
+		Terms  []string
+	}{
+		{
+			Name:  "words",
+			Text:  "Hello, World! hello a-b_c x",
+			Terms: []string{"hello", "world", "a-b_c"},
+		},
+		{
+			Name:  "hashtags_and_mentions",
+			Text:  "#Scuttlebutt with @alice-",
+			Terms: []string{"#scuttlebutt", "with", "@alice"},
+		},
+		{
+			Name:   "expanded",
+			Text:   "#Scuttlebutt with @alice",
+			Expand: true,
+			Terms:  []string{"#scuttlebutt", "scuttlebutt", "with", "@alice", "alice"},
+		},
+		{
+			Name:  "punctuation_only",
+			Text:  "# @ -- !",
+			Terms: nil,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			require.Equal(t, testCase.Terms, searchTerms(testCase.Text, testCase.Expand))
+		})
+	}
+}
+
+func TestIndex_SearchReturnsPostsContainingAllTermsFromNewest(t *testing.T) {
+	index := newTestIndex(t)
+
+	msgs := []queries.LogMessage{
+		newTestLogMessage(t, 0, `{"type":"post","text":"hello scuttlebutt"}`),
+		newTestLogMessage(t, 1, `{"type":"post","text":"hello world"}`),
+		newTestLogMessage(t, 2, `{"type":"about","name":"hello scuttlebutt"}`),
+		newTestLogMessage(t, 3, `{"type":"post","text":"Hello again","channel":"scuttlebutt"}`),
+	}
+	require.NoError(t, index.Add(common.MustNewReceiveLogSequence(0), msgs))
+
+	hits, next, err := index.Search([]string{"hello", "scuttlebutt"}, 0, 1)
+	require.NoError(t, err)
+	require.Equal(t, []searchHit{{Key: msgs[3].Message.Id(), Sequence: msgs[3].Sequence}}, hits)
+	require.Equal(t, 3, next)
+
+	hits, next, err = index.Search([]string{"hello", "scuttlebutt"}, next, 10)
+	require.NoError(t, err)
+	require.Equal(t, []searchHit{{Key: msgs[0].Message.Id(), Sequence: msgs[0].Sequence}}, hits)
+	require.Equal(t, 0, next)
+
+	hits, _, err = index.Search([]string{"#scuttlebutt"}, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, []searchHit{{Key: msgs[3].Message.Id(), Sequence: msgs[3].Sequence}}, hits)
+}
+
+func TestIndex_ResetRejectsStaleBatches(t *testing.T) {
+	index := newTestIndex(t)
+
+	msg := newTestLogMessage(t, 0, `{"type":"post","text":"hello"}`)
+	require.NoError(t, index.Add(common.MustNewReceiveLogSequence(0), []queries.LogMessage{msg}))
+	require.NoError(t, index.Reset())
+
+	next, err := index.Next()
+	require.NoError(t, err)
+	require.Equal(t, 0, next.Int())
+
+	stale := newTestLogMessage(t, 1, `{"type":"post","text":"hello"}`)
+	require.ErrorIs(t, index.Add(common.MustNewReceiveLogSequence(1), []queries.LogMessage{stale}), errIndexWasReset)
+
+	hits, _, err := index.Search([]string{"hello"}, 0, 10)
+	require.NoError(t, err)
+	require.Empty(t, hits)
+}
+
+func TestSearchSnippet(t *testing.T) {
+	testCases := []struct {
+		Name    string
+		Text    string
+		Snippet string
+	}{
+		{
+			Name:    "short",
+			Text:    "Hello World",
+			Snippet: "Hello World",
+		},
+		{
+			Name:    "long",
+			Text:    "Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor World incididunt ut labore et dolore magna aliqua. Ut enim ad minim veniam",
+			Snippet: "…adipiscing elit, sed do eiusmod tempor World incididunt ut labore et dolore magna al…",
+		},
+		{
+			Name:    "no_match",
+			Text:    "Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor",
+			Snippet: "Lorem ipsum dolor sit amet, consectetur…",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			require.Equal(t, testCase.Snippet, searchSnippet(testCase.Text, []string{"world"}))
+		})
+	}
+}
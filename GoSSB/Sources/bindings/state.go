@@ -0,0 +1,148 @@
+package bindings
+
+import (
+	"sync"
+
+	"github.com/boreq/errors"
+)
+
+// NodeState describes the lifecycle of a node. The numeric values are passed
+// to the state change callback and therefore must not change.
+type NodeState int
+
+const (
+	NodeStateStopped   NodeState = 0
+	NodeStateBuilding  NodeState = 1
+	NodeStateMigrating NodeState = 2
+	NodeStateRunning   NodeState = 3
+	NodeStateStopping  NodeState = 4
+	NodeStateCrashed   NodeState = 5
+	NodeStateSuspended NodeState = 6
+)
+
+func (s NodeState) String() string {
+	switch s {
+	case NodeStateStopped:
+		return "stopped"
+	case NodeStateBuilding:
+		return "building"
+	case NodeStateMigrating:
+		return "migrating"
+	case NodeStateRunning:
+		return "running"
+	case NodeStateStopping:
+		return "stopping"
+	case NodeStateCrashed:
+		return "crashed"
+	case NodeStateSuspended:
+		return "suspended"
+	default:
+		return "unknown"
+	}
+}
+
+// NodeErrorCode explains why a state transition happened. The numeric values
+// are passed to the state change callback and therefore must not change.
+type NodeErrorCode int
+
+const (
+	NodeErrorNone              NodeErrorCode = 0
+	NodeErrorUnknown           NodeErrorCode = 1
+	NodeErrorInvalidConfig     NodeErrorCode = 2
+	NodeErrorBuildingFailed    NodeErrorCode = 3
+	NodeErrorMigrationsFailed  NodeErrorCode = 4
+	NodeErrorServiceTerminated NodeErrorCode = 5
+)
+
+type OnStateChangedFn func(previous, current NodeState, errorCode NodeErrorCode)
+
+// nodeError associates an error with the code which is reported to the state
+// change callback.
+type nodeError struct {
+	code NodeErrorCode
+	err  error
+}
+
+func newNodeError(code NodeErrorCode, err error) error {
+	return nodeError{code: code, err: err}
+}
+
+func (e nodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e nodeError) Unwrap() error {
+	return e.err
+}
+
+// ErrorCodeOf returns the code which would be reported to the state change
+// callback if the error caused a state transition.
+func ErrorCodeOf(err error) NodeErrorCode {
+	return errorCode(err)
+}
+
+func errorCode(err error) NodeErrorCode {
+	if err == nil {
+		return NodeErrorNone
+	}
+
+	var nodeErr nodeError
+	if errors.As(err, &nodeErr) {
+		return nodeErr.code
+	}
+
+	return NodeErrorUnknown
+}
+
+// lifecycle tracks the state of a node and notifies the registered callback
+// about every transition. Callbacks are delivered in order. The callback is
+// called synchronously from the goroutine performing the transition which
+// may be holding the node's lock so it must not call methods of the node
+// other than State.
+type lifecycle struct {
+	notifyMutex sync.Mutex
+
+	stateMutex     sync.Mutex
+	state          NodeState
+	onStateChanged OnStateChangedFn
+}
+
+func newLifecycle() *lifecycle {
+	return &lifecycle{
+		state: NodeStateStopped,
+	}
+}
+
+func (l *lifecycle) State() NodeState {
+	l.stateMutex.Lock()
+	defer l.stateMutex.Unlock()
+
+	return l.state
+}
+
+func (l *lifecycle) SetCallback(onStateChanged OnStateChangedFn) {
+	l.notifyMutex.Lock()
+	defer l.notifyMutex.Unlock()
+
+	l.onStateChanged = onStateChanged
+}
+
+// Set transitions to the given state. Transitions to the current state are
+// only reported if they carry an error code.
+func (l *lifecycle) Set(state NodeState, errorCode NodeErrorCode) {
+	l.notifyMutex.Lock()
+	defer l.notifyMutex.Unlock()
+
+	l.stateMutex.Lock()
+	previous := l.state
+	l.state = state
+	l.stateMutex.Unlock()
+
+	if previous == state && errorCode == NodeErrorNone {
+		return
+	}
+
+	if l.onStateChanged != nil {
+		l.onStateChanged(previous, state, errorCode)
+	}
+}
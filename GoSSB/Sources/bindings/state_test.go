@@ -0,0 +1,48 @@
+package bindings
+
+import (
+	"testing"
+
+	"github.com/boreq/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLifecycle_TransitionsAreReported(t *testing.T) {
+	l := newLifecycle()
+
+	var transitions []transition
+	l.SetCallback(func(previous, current NodeState, errorCode NodeErrorCode) {
+		transitions = append(transitions, transition{previous, current, errorCode})
+		require.Equal(t, current, l.State(), "state should be updated before the callback is called")
+	})
+
+	l.Set(NodeStateBuilding, NodeErrorNone)
+	l.Set(NodeStateBuilding, NodeErrorNone)
+	l.Set(NodeStateBuilding, NodeErrorBuildingFailed)
+	l.Set(NodeStateMigrating, NodeErrorNone)
+	l.Set(NodeStateCrashed, NodeErrorMigrationsFailed)
+
+	require.Equal(t,
+		[]transition{
+			{NodeStateStopped, NodeStateBuilding, NodeErrorNone},
+			{NodeStateBuilding, NodeStateBuilding, NodeErrorBuildingFailed},
+			{NodeStateBuilding, NodeStateMigrating, NodeErrorNone},
+			{NodeStateMigrating, NodeStateCrashed, NodeErrorMigrationsFailed},
+		},
+		transitions,
+	)
+}
+
+func TestErrorCode(t *testing.T) {
+	require.Equal(t, NodeErrorNone, errorCode(nil))
+	require.Equal(t, NodeErrorUnknown, errorCode(errors.New("some error")))
+
+	err := newNodeError(NodeErrorMigrationsFailed, errors.New("some error"))
+	require.Equal(t, NodeErrorMigrationsFailed, errorCode(errors.Wrap(err, "wrapped")))
+}
+
+type transition struct {
+	previous  NodeState
+	current   NodeState
+	errorCode NodeErrorCode
+}
@@ -0,0 +1,204 @@
+package bindings
+
+import (
+	"fmt"
+	"strings"
+	bindingslogging "verseproj/scuttlegobridge/logging"
+
+	"github.com/boreq/errors"
+	badgeroptions "github.com/dgraph-io/badger/v3/options"
+	"github.com/planetary-social/scuttlego/service"
+	"github.com/planetary-social/scuttlego/service/adapters/badger"
+)
+
+const (
+	StorageProfileLowMemory  = "low-memory"
+	StorageProfileBalanced   = "balanced"
+	StorageProfileThroughput = "throughput"
+
+	defaultStorageProfile = StorageProfileBalanced
+
+	// Badger can't memory map larger value log files.
+	maxValueLogFileSizeInMiB = 2047
+)
+
+var storageCompressions = map[string]badgeroptions.CompressionType{
+	"none":   badgeroptions.None,
+	"snappy": badgeroptions.Snappy,
+	"zstd":   badgeroptions.ZSTD,
+}
+
+// StorageOptions overrides individual options of the selected storage
+// profile. Options which aren't set are taken from the profile.
+type StorageOptions struct {
+	NumGoroutines *int `json:"numGoroutines"`
+
+	// NumCompactors must be at least 2.
+	NumCompactors *int `json:"numCompactors"`
+
+	// Compression is one of "none", "snappy" or "zstd". Compression
+	// requires a non-zero block cache.
+	Compression *string `json:"compression"`
+
+	// ValueLogFileSizeMiB must be between 1 and 2047.
+	ValueLogFileSizeMiB *int64 `json:"valueLogFileSizeMiB"`
+
+	BlockCacheSizeMiB *int64 `json:"blockCacheSizeMiB"`
+	IndexCacheSizeMiB *int64 `json:"indexCacheSizeMiB"`
+	SyncWrites        *bool  `json:"syncWrites"`
+}
+
+// storageSettings are the Badger options which are applied when the service
+// is built.
+type storageSettings struct {
+	NumGoroutines       int
+	NumCompactors       int
+	Compression         string
+	ValueLogFileSizeMiB int64
+	BlockCacheSizeMiB   int64
+	IndexCacheSizeMiB   int64
+	SyncWrites          bool
+}
+
+var storageProfiles = map[string]storageSettings{
+	StorageProfileLowMemory: {
+		NumGoroutines:       1,
+		NumCompactors:       2,
+		Compression:         "zstd",
+		ValueLogFileSizeMiB: 16,
+		BlockCacheSizeMiB:   8,
+		IndexCacheSizeMiB:   0,
+		SyncWrites:          true,
+	},
+	StorageProfileBalanced: {
+		NumGoroutines:       2,
+		NumCompactors:       2,
+		Compression:         "zstd",
+		ValueLogFileSizeMiB: 32,
+		BlockCacheSizeMiB:   32,
+		IndexCacheSizeMiB:   0,
+		SyncWrites:          true,
+	},
+	StorageProfileThroughput: {
+		NumGoroutines:       8,
+		NumCompactors:       4,
+		Compression:         "snappy",
+		ValueLogFileSizeMiB: 128,
+		BlockCacheSizeMiB:   256,
+		IndexCacheSizeMiB:   64,
+		SyncWrites:          false,
+	},
+}
+
+func newStorageSettings(config BotConfig) (storageSettings, error) {
+	settings, err := storageProfileSettings(config.StorageProfile)
+	if err != nil {
+		return storageSettings{}, errors.Wrap(err, "invalid storage profile")
+	}
+
+	if config.StorageOptions != nil {
+		settings = config.StorageOptions.apply(settings)
+	}
+
+	if err := settings.Validate(); err != nil {
+		return storageSettings{}, errors.Wrap(err, "invalid storage options")
+	}
+
+	return settings, nil
+}
+
+func storageProfileSettings(profile string) (storageSettings, error) {
+	if profile == "" {
+		profile = defaultStorageProfile
+	}
+
+	settings, ok := storageProfiles[profile]
+	if !ok {
+		return storageSettings{}, fmt.Errorf("unknown storage profile '%s'", profile)
+	}
+
+	return settings, nil
+}
+
+func (o StorageOptions) apply(settings storageSettings) storageSettings {
+	if o.NumGoroutines != nil {
+		settings.NumGoroutines = *o.NumGoroutines
+	}
+	if o.NumCompactors != nil {
+		settings.NumCompactors = *o.NumCompactors
+	}
+	if o.Compression != nil {
+		settings.Compression = *o.Compression
+	}
+	if o.ValueLogFileSizeMiB != nil {
+		settings.ValueLogFileSizeMiB = *o.ValueLogFileSizeMiB
+	}
+	if o.BlockCacheSizeMiB != nil {
+		settings.BlockCacheSizeMiB = *o.BlockCacheSizeMiB
+	}
+	if o.IndexCacheSizeMiB != nil {
+		settings.IndexCacheSizeMiB = *o.IndexCacheSizeMiB
+	}
+	if o.SyncWrites != nil {
+		settings.SyncWrites = *o.SyncWrites
+	}
+	return settings
+}
+
+// Validate rejects settings which would make Badger fail or panic when the
+// database is opened.
+func (s storageSettings) Validate() error {
+	if s.NumGoroutines < 1 {
+		return errors.New("number of goroutines must be positive")
+	}
+
+	if s.NumCompactors < 2 {
+		return errors.New("number of compactors must be at least 2")
+	}
+
+	compression, ok := storageCompressions[s.Compression]
+	if !ok {
+		return fmt.Errorf("unknown compression '%s'", s.Compression)
+	}
+
+	if s.ValueLogFileSizeMiB < 1 || s.ValueLogFileSizeMiB > maxValueLogFileSizeInMiB {
+		return fmt.Errorf("value log file size must be between 1 and %d MiB", maxValueLogFileSizeInMiB)
+	}
+
+	if s.BlockCacheSizeMiB < 0 {
+		return errors.New("block cache size can't be negative")
+	}
+
+	if compression != badgeroptions.None && s.BlockCacheSizeMiB == 0 {
+		return errors.New("block cache is required when compression is enabled")
+	}
+
+	if s.IndexCacheSizeMiB < 0 {
+		return errors.New("index cache size can't be negative")
+	}
+
+	return nil
+}
+
+func (s storageSettings) Apply(options service.BadgerOptions, logger bindingslogging.Logger) {
+	options.SetNumGoroutines(s.NumGoroutines)
+	options.SetNumCompactors(s.NumCompactors)
+	options.SetCompression(storageCompressions[s.Compression])
+	options.SetLogger(badger.NewLogger(logger, badger.LoggerLevelInfo))
+	options.SetValueLogFileSize(s.ValueLogFileSizeMiB * mebibyte)
+	options.SetBlockCacheSize(s.BlockCacheSizeMiB * mebibyte)
+	options.SetIndexCacheSize(s.IndexCacheSizeMiB * mebibyte)
+	options.SetSyncWrites(s.SyncWrites)
+}
+
+func (s storageSettings) String() string {
+	return strings.Join([]string{
+		fmt.Sprintf("numGoroutines=%d", s.NumGoroutines),
+		fmt.Sprintf("numCompactors=%d", s.NumCompactors),
+		fmt.Sprintf("compression=%s", s.Compression),
+		fmt.Sprintf("valueLogFileSizeMiB=%d", s.ValueLogFileSizeMiB),
+		fmt.Sprintf("blockCacheSizeMiB=%d", s.BlockCacheSizeMiB),
+		fmt.Sprintf("indexCacheSizeMiB=%d", s.IndexCacheSizeMiB),
+		fmt.Sprintf("syncWrites=%t", s.SyncWrites),
+	}, " ")
+}
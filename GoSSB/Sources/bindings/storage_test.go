@@ -0,0 +1,115 @@
+package bindings
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewStorageSettings(t *testing.T) {
+	intPtr := func(v int) *int { return &v }
+	int64Ptr := func(v int64) *int64 { return &v }
+	stringPtr := func(v string) *string { return &v }
+	boolPtr := func(v bool) *bool { return &v }
+
+	testCases := []struct {
+		Name string
+
+		Profile string
+		Options *StorageOptions
+
+		ExpectedSettings storageSettings
+		ExpectedFailure  bool
+	}{
+		{
+			Name:             "default_profile",
+			ExpectedSettings: storageProfiles[StorageProfileBalanced],
+		},
+		{
+			Name:             "profile",
+			Profile:          StorageProfileThroughput,
+			ExpectedSettings: storageProfiles[StorageProfileThroughput],
+		},
+		{
+			Name:    "overrides",
+			Profile: StorageProfileBalanced,
+			Options: &StorageOptions{
+				NumCompactors:     intPtr(3),
+				BlockCacheSizeMiB: int64Ptr(64),
+				SyncWrites:        boolPtr(false),
+			},
+			ExpectedSettings: storageSettings{
+				NumGoroutines:       2,
+				NumCompactors:       3,
+				Compression:         "zstd",
+				ValueLogFileSizeMiB: 32,
+				BlockCacheSizeMiB:   64,
+				IndexCacheSizeMiB:   0,
+				SyncWrites:          false,
+			},
+		},
+		{
+			Name:            "unknown_profile",
+			Profile:         "unknown",
+			ExpectedFailure: true,
+		},
+		{
+			Name:            "one_compactor",
+			Options:         &StorageOptions{NumCompactors: intPtr(1)},
+			ExpectedFailure: true,
+		},
+		{
+			Name:            "unknown_compression",
+			Options:         &StorageOptions{Compression: stringPtr("lz4")},
+			ExpectedFailure: true,
+		},
+		{
+			Name:            "value_log_too_large",
+			Options:         &StorageOptions{ValueLogFileSizeMiB: int64Ptr(2048)},
+			ExpectedFailure: true,
+		},
+		{
+			Name:            "compression_without_block_cache",
+			Options:         &StorageOptions{BlockCacheSizeMiB: int64Ptr(0)},
+			ExpectedFailure: true,
+		},
+		{
+			Name: "no_compression_without_block_cache",
+			Options: &StorageOptions{
+				Compression:       stringPtr("none"),
+				BlockCacheSizeMiB: int64Ptr(0),
+			},
+			ExpectedSettings: storageSettings{
+				NumGoroutines:       2,
+				NumCompactors:       2,
+				Compression:         "none",
+				ValueLogFileSizeMiB: 32,
+				BlockCacheSizeMiB:   0,
+				IndexCacheSizeMiB:   0,
+				SyncWrites:          true,
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			settings, err := newStorageSettings(BotConfig{
+				StorageProfile: testCase.Profile,
+				StorageOptions: testCase.Options,
+			})
+			if testCase.ExpectedFailure {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, testCase.ExpectedSettings, settings)
+		})
+	}
+}
+
+func TestStorageProfilesAreValid(t *testing.T) {
+	for name, settings := range storageProfiles {
+		require.NoError(t, settings.Validate(), name)
+	}
+}
@@ -0,0 +1,258 @@
+package bindings
+
+import (
+	"context"
+	"sync"
+	"time"
+	bindingslogging "verseproj/scuttlegobridge/logging"
+
+	"github.com/boreq/errors"
+	"github.com/planetary-social/scuttlego/service/app/common"
+	"github.com/planetary-social/scuttlego/service/app/queries"
+)
+
+// If the callback of a subscription returns an error the batch is delivered
+// again after this interval.
+const receiveLogRetryInterval = 1 * time.Second
+
+var ErrUnknownSubscription = errors.New("unknown subscription")
+
+// OnReceiveLogFn is called with consecutive batches of messages from the
+// receive log. If it returns an error the same batch is delivered again after
+// a while.
+type OnReceiveLogFn func(messages []queries.LogMessage) error
+
+// receiveLogNotifier wakes up the subscriptions once new messages are appended
+// to the receive log. Scuttlego doesn't notify about appended messages so the
+// notifier is driven by the index which tails the receive log anyway. Local
+// publishes wake up the index so that they are delivered without waiting for
+// the next poll.
+type receiveLogNotifier struct {
+	mutex     sync.Mutex
+	changed   chan struct{}
+	published chan struct{}
+}
+
+func newReceiveLogNotifier() *receiveLogNotifier {
+	return &receiveLogNotifier{
+		changed:   make(chan struct{}),
+		published: make(chan struct{}, 1),
+	}
+}
+
+// wait returns a channel which is closed the next time notify is called. It
+// has to be called before reading the receive log so that messages appended
+// in the meantime aren't missed.
+func (r *receiveLogNotifier) wait() <-chan struct{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.changed
+}
+
+// notify wakes up everyone waiting for new messages.
+func (r *receiveLogNotifier) notify() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// publish records that a message was published locally.
+func (r *receiveLogNotifier) publish() {
+	select {
+	case r.published <- struct{}{}:
+	default:
+	}
+}
+
+// publishes returns a channel which receives a value after a message was
+// published locally.
+func (r *receiveLogNotifier) publishes() <-chan struct{} {
+	return r.published
+}
+
+type receiveLogSubscription struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// receiveLogSubscriptions keeps track of the subscriptions of a node. It is
+// separate from the node's mutex so that unsubscribing can wait for the
+// subscription to finish without blocking the node.
+type receiveLogSubscriptions struct {
+	mutex         sync.Mutex
+	next          int64
+	subscriptions map[int64]receiveLogSubscription
+	running       sync.WaitGroup
+}
+
+func newReceiveLogSubscriptions() *receiveLogSubscriptions {
+	return &receiveLogSubscriptions{
+		next:          1,
+		subscriptions: make(map[int64]receiveLogSubscription),
+	}
+}
+
+func (s *receiveLogSubscriptions) add(cancel context.CancelFunc) (int64, chan struct{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := s.next
+	s.next++
+	s.running.Add(1)
+
+	done := make(chan struct{})
+	s.subscriptions[id] = receiveLogSubscription{
+		cancel: cancel,
+		done:   done,
+	}
+	return id, done
+}
+
+func (s *receiveLogSubscriptions) remove(id int64) (receiveLogSubscription, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	subscription, ok := s.subscriptions[id]
+	delete(s.subscriptions, id)
+	return subscription, ok
+}
+
+// wait waits until the goroutines of all subscriptions exit.
+func (s *receiveLogSubscriptions) wait() {
+	s.running.Wait()
+}
+
+// SubscribeReceiveLog delivers messages from the receive log starting with
+// the given sequence to the callback in batches of at most limit messages.
+// The next batch is retrieved only after the callback returns. The
+// subscription survives service restarts and reconfiguration but ends when
+// the node stops. New messages are delivered once they are indexed. Returns the identifier of the subscription which is always
+// positive.
+func (n *Node) SubscribeReceiveLog(from common.ReceiveLogSequence, limit int, fn OnReceiveLogFn) (int64, error) {
+	if limit <= 0 {
+		return 0, errors.New("limit must be positive")
+	}
+
+	if fn == nil {
+		return 0, errors.New("nil callback")
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if !n.isRunning() || n.ctx.Err() != nil {
+		return 0, ErrNodeIsNotRunning
+	}
+
+	ctx, cancel := context.WithCancel(n.ctx)
+	id, done := n.subscriptions.add(cancel)
+	log := n.log.WithField("subscription", id)
+
+	go func() {
+		defer n.subscriptions.running.Done()
+		defer close(done)
+		defer n.subscriptions.remove(id)
+		defer n.crashes.Recover("receive log subscription")
+
+		n.tailReceiveLog(ctx, log, from, limit, fn)
+		log.Debug().Message("receive log subscription ended")
+	}()
+
+	return id, nil
+}
+
+// UnsubscribeReceiveLog ends the subscription and waits until the callback is
+// no longer being called. It must not be called from within the callback.
+func (n *Node) UnsubscribeReceiveLog(id int64) error {
+	subscription, ok := n.subscriptions.remove(id)
+	if !ok {
+		return ErrUnknownSubscription
+	}
+
+	subscription.cancel()
+	<-subscription.done
+	return nil
+}
+
+// endSubscriptions ends all subscriptions and waits until their callbacks are
+// no longer being called. New subscriptions can't be created afterwards as
+// the node's context is cancelled. It must be called without holding the
+// node's mutex.
+func (n *Node) endSubscriptions() {
+	n.mutex.Lock()
+	n.cancel()
+	n.mutex.Unlock()
+
+	n.subscriptions.wait()
+}
+
+func (n *Node) tailReceiveLog(ctx context.Context, log bindingslogging.Logger, from common.ReceiveLogSequence, limit int, fn OnReceiveLogFn) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		changed := n.receiveLog.wait()
+
+		next, full, err := n.deliverReceiveLog(from, limit, fn)
+		if err != nil {
+			log.Debug().WithField(bindingslogging.ErrorField, err).Message("error delivering the receive log")
+
+			select {
+			case <-time.After(receiveLogRetryInterval):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		from = next
+		if full {
+			continue
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deliverReceiveLog delivers one batch of messages and returns the sequence
+// from which the next batch starts. The returned bool is true if the batch
+// was full and therefore there may be more messages waiting.
+func (n *Node) deliverReceiveLog(from common.ReceiveLogSequence, limit int, fn OnReceiveLogFn) (common.ReceiveLogSequence, bool, error) {
+	service, err := n.Get()
+	if err != nil {
+		return common.ReceiveLogSequence{}, false, errors.Wrap(err, "error getting the service")
+	}
+
+	query, err := queries.NewReceiveLog(from, limit)
+	if err != nil {
+		return common.ReceiveLogSequence{}, false, errors.Wrap(err, "error creating the query")
+	}
+
+	messages, err := service.App.Queries.ReceiveLog.Handle(query)
+	if err != nil {
+		return common.ReceiveLogSequence{}, false, errors.Wrap(err, "error querying the receive log")
+	}
+
+	if len(messages) == 0 {
+		return from, false, nil
+	}
+
+	if err := fn(messages); err != nil {
+		return common.ReceiveLogSequence{}, false, errors.Wrap(err, "callback returned an error")
+	}
+
+	next, err := common.NewReceiveLogSequence(messages[len(messages)-1].Sequence.Int() + 1)
+	if err != nil {
+		return common.ReceiveLogSequence{}, false, errors.Wrap(err, "error creating the next sequence")
+	}
+
+	return next, len(messages) == limit, nil
+}
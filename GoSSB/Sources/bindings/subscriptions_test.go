@@ -0,0 +1,186 @@
+package bindings
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+	bindingslogging "verseproj/scuttlegobridge/logging"
+
+	"github.com/planetary-social/scuttlego/service"
+	"github.com/planetary-social/scuttlego/service/app"
+	"github.com/planetary-social/scuttlego/service/app/common"
+	"github.com/planetary-social/scuttlego/service/app/queries"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNode_SubscribeReceiveLogRequiresRunningNode(t *testing.T) {
+	node := NewNode()
+
+	from, err := common.NewReceiveLogSequence(0)
+	require.NoError(t, err)
+
+	_, err = node.SubscribeReceiveLog(from, 10, func(messages []queries.LogMessage) error {
+		return nil
+	})
+	require.ErrorIs(t, err, ErrNodeIsNotRunning)
+}
+
+func TestNode_UnsubscribeReceiveLogRejectsUnknownSubscriptions(t *testing.T) {
+	node := NewNode()
+
+	require.ErrorIs(t, node.UnsubscribeReceiveLog(1), ErrUnknownSubscription)
+}
+
+func TestReceiveLogSubscriptions(t *testing.T) {
+	subscriptions := newReceiveLogSubscriptions()
+
+	id1, _ := subscriptions.add(func() {})
+	id2, _ := subscriptions.add(func() {})
+	require.Positive(t, id1)
+	require.NotEqual(t, id1, id2)
+
+	_, ok := subscriptions.remove(id1)
+	require.True(t, ok)
+
+	_, ok = subscriptions.remove(id1)
+	require.False(t, ok)
+}
+
+func TestReceiveLogNotifier(t *testing.T) {
+	notifier := newReceiveLogNotifier()
+
+	changed := notifier.wait()
+	require.False(t, isClosed(changed))
+
+	notifier.notify()
+	require.True(t, isClosed(changed))
+	require.False(t, isClosed(notifier.wait()))
+
+	notifier.publish()
+	notifier.publish()
+	<-notifier.publishes()
+
+	select {
+	case <-notifier.publishes():
+		t.Fatal("publishes should be coalesced")
+	default:
+	}
+}
+
+func TestNode_SubscriptionsAreWokenUpByTheNotifierAndEndedWithTheNode(t *testing.T) {
+	receiveLog := newFakeReceiveLog()
+	receiveLog.Append(newTestLogMessage(t, 0, `{"type":"post"}`))
+
+	node := newTestNode(t, service.Service{
+		App: app.Application{
+			Queries: app.Queries{
+				ReceiveLog: queries.NewReceiveLogHandler(receiveLog),
+			},
+		},
+	})
+
+	batches := make(chan []queries.LogMessage)
+	release := make(chan struct{})
+	_, err := node.SubscribeReceiveLog(common.MustNewReceiveLogSequence(0), 10, func(messages []queries.LogMessage) error {
+		batches <- messages
+		<-release
+		return nil
+	})
+	require.NoError(t, err)
+
+	batch := <-batches
+	require.Len(t, batch, 1)
+	require.Equal(t, 0, batch[0].Sequence.Int())
+	release <- struct{}{}
+
+	receiveLog.Append(newTestLogMessage(t, 1, `{"type":"post"}`))
+	node.receiveLog.notify()
+
+	batch = <-batches
+	require.Len(t, batch, 1)
+	require.Equal(t, 1, batch[0].Sequence.Int())
+
+	ended := make(chan struct{})
+	go func() {
+		node.endSubscriptions()
+		close(ended)
+	}()
+
+	select {
+	case <-ended:
+		t.Fatal("subscriptions ended while the callback was being called")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	release <- struct{}{}
+	<-ended
+
+	_, err = node.SubscribeReceiveLog(common.MustNewReceiveLogSequence(0), 10, func(messages []queries.LogMessage) error {
+		return nil
+	})
+	require.ErrorIs(t, err, ErrNodeIsNotRunning)
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// newTestNode returns a node which looks like it is running but only
+// supports the parts of the application set up by the test.
+func newTestNode(t *testing.T, service service.Service) *Node {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	node := NewNode()
+	node.ctx = ctx
+	node.cancel = cancel
+	node.log = bindingslogging.NewLogrusLogger(logger)
+	node.service = &service
+	return node
+}
+
+type fakeReceiveLog struct {
+	queries.ReceiveLogRepository
+
+	mutex    sync.Mutex
+	messages []queries.LogMessage
+}
+
+func newFakeReceiveLog() *fakeReceiveLog {
+	return &fakeReceiveLog{}
+}
+
+func (f *fakeReceiveLog) Append(msg queries.LogMessage) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.messages = append(f.messages, msg)
+}
+
+func (f *fakeReceiveLog) Transact(fn func(adapters queries.Adapters) error) error {
+	return fn(queries.Adapters{ReceiveLog: f})
+}
+
+func (f *fakeReceiveLog) List(startSeq common.ReceiveLogSequence, limit int) ([]queries.LogMessage, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var result []queries.LogMessage
+	for _, msg := range f.messages {
+		if msg.Sequence.Int() >= startSeq.Int() && len(result) < limit {
+			result = append(result, msg)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,410 @@
+package bindings
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	bindingslogging "verseproj/scuttlegobridge/logging"
+
+	"github.com/boreq/errors"
+	"github.com/planetary-social/scuttlego/service"
+	"github.com/planetary-social/scuttlego/service/app/commands"
+	"github.com/planetary-social/scuttlego/service/di"
+	"github.com/planetary-social/scuttlego/service/domain/identity"
+)
+
+const (
+	defaultMaxServiceRestarts = 5
+
+	initialRestartBackoff = 1 * time.Second
+	maxRestartBackoff     = 1 * time.Minute
+
+	// If the service runs for longer than this before terminating then the
+	// previous failures are forgotten.
+	resetFailuresAfter = 10 * time.Minute
+)
+
+// serviceBuilder builds the service and brings its storage up to date by
+// running the migrations. It is used both when the node is started and when
+// the supervisor restarts the service.
+type serviceBuilder struct {
+	privateIdentity identity.Private
+	config          service.Config
+	lifecycle       *lifecycle
+	log             bindingslogging.Logger
+
+	migrationOnRunningFn  MigrationOnRunningFn
+	migrationOnErrorFn    MigrationOnErrorFn
+	migrationOnDoneFn     MigrationOnDoneFn
+	migrationOnProgressFn MigrationOnProgressFn
+	migrationCanceller    *migrationCanceller
+	crashes               *crashReporter
+}
+
+// Build builds the service and runs the migrations.
+func (b serviceBuilder) Build(ctx context.Context) (service.Service, func(), error) {
+	return b.build(ctx, true)
+}
+
+// Rebuild builds the service without running the migrations. It is used
+// when the node is reconfigured as the migrations already ran when the node
+// was started and the repository can't change without restarting the node.
+func (b serviceBuilder) Rebuild(ctx context.Context) (service.Service, func(), error) {
+	return b.build(ctx, false)
+}
+
+func (b serviceBuilder) build(ctx context.Context, migrate bool) (service.Service, func(), error) {
+	service, cleanup, err := di.BuildService(b.privateIdentity, b.config)
+	if err != nil {
+		return service, nil, newNodeError(NodeErrorBuildingFailed, errors.Wrap(err, "error building service"))
+	}
+
+	if !migrate {
+		return service, cleanup, nil
+	}
+
+	b.lifecycle.Set(NodeStateMigrating, NodeErrorNone)
+
+	if err := b.runMigrations(ctx, service); err != nil {
+		cleanup()
+		return service, nil, newNodeError(NodeErrorMigrationsFailed, errors.Wrap(err, "error running migrations"))
+	}
+
+	return service, cleanup, nil
+}
+
+func (b serviceBuilder) runMigrations(ctx context.Context, service service.Service) error {
+	progressCallback, err := NewProgressCallback(b.migrationOnRunningFn, b.migrationOnErrorFn, b.migrationOnDoneFn)
+	if err != nil {
+		return errors.Wrap(err, "error creating the progress callback")
+	}
+
+	estimator := newGoSSBImportEstimator(b.config.GoSSBDataDirectory, func() (int, error) {
+		status, err := service.App.Queries.Status.Handle()
+		if err != nil {
+			return 0, errors.Wrap(err, "error getting the status")
+		}
+		return status.NumberOfMessages, nil
+	})
+
+	migrationsCmd, err := commands.NewRunMigrations(newProgressReportingCallback(progressCallback, estimator, b.migrationOnProgressFn, b.log, b.crashes))
+	if err != nil {
+		return errors.Wrap(err, "error creating the migration command")
+	}
+
+	ctx, finish := b.migrationCanceller.start(ctx)
+	err = service.App.Commands.RunMigrations.Run(ctx, migrationsCmd)
+	if cancelled := finish(); cancelled && err != nil {
+		return fmt.Errorf("%w: %w", ErrMigrationsCancelled, err)
+	}
+	if err != nil {
+		return errors.Wrap(err, "error running migrations")
+	}
+
+	return nil
+}
+
+// supervisor runs the service of a node and rebuilds it with exponential
+// backoff if it terminates unexpectedly. Once the number of consecutive
+// failures exceeds the limit the supervisor gives up and the node stops. The
+// supervisor also rebuilds the service when the node is reconfigured.
+type supervisor struct {
+	node             *Node
+	builder          serviceBuilder
+	log              bindingslogging.Logger
+	onBlobDownloaded OnBlobDownloadedFn
+	maxRestarts      int
+	reloads          <-chan reloadRequest
+
+	// build, serve and backoff are replaced in tests.
+	build   func(ctx context.Context, builder serviceBuilder, migrate bool) (service.Service, func(), error)
+	serve   func(ctx context.Context, service service.Service) error
+	backoff func(failures int) time.Duration
+}
+
+func newSupervisor(
+	node *Node,
+	builder serviceBuilder,
+	log bindingslogging.Logger,
+	onBlobDownloaded OnBlobDownloadedFn,
+	maxRestarts int,
+	reloads <-chan reloadRequest,
+) *supervisor {
+	s := &supervisor{
+		node:             node,
+		builder:          builder,
+		log:              log,
+		onBlobDownloaded: onBlobDownloaded,
+		maxRestarts:      normalizeMaxRestarts(maxRestarts),
+		reloads:          reloads,
+		build: func(ctx context.Context, builder serviceBuilder, migrate bool) (service.Service, func(), error) {
+			return builder.build(ctx, migrate)
+		},
+		backoff: restartBackoff,
+	}
+	s.serve = s.runService
+	return s
+}
+
+// Run runs the provided service until the context is cancelled or the
+// supervisor gives up on restarting it. While the node is suspended the
+// service isn't running but it isn't cleaned up either so that its storage
+// remains available. The service is always cleaned up before Run returns.
+func (s *supervisor) Run(ctx context.Context, service service.Service, cleanup func()) {
+	defer s.node.crashes.Recover("supervisor")
+
+	state, errorCode := s.run(ctx, service, cleanup)
+	s.node.endSubscriptions()
+	s.node.closeIndex()
+	s.node.clear(state, errorCode)
+}
+
+func (s *supervisor) run(ctx context.Context, service service.Service, cleanup func()) (NodeState, NodeErrorCode) {
+	var failures int
+
+	for {
+		started := time.Now()
+
+		err := s.runUntilTerminated(ctx, service, cleanup)
+		if ctx.Err() != nil {
+			return NodeStateStopped, NodeErrorNone
+		}
+
+		if errors.Is(err, ErrMigrationsCancelled) {
+			return NodeStateStopped, NodeErrorMigrationsFailed
+		}
+
+		if time.Since(started) > resetFailuresAfter {
+			failures = 0
+		}
+
+		for {
+			failures++
+
+			logger := s.log.WithField(bindingslogging.ErrorField, err).WithField("failures", failures)
+
+			if !s.shouldRestart(failures) {
+				logger.Error().Message("service terminated, giving up")
+				return NodeStateCrashed, errorCode(err)
+			}
+
+			s.node.lifecycle.Set(NodeStateBuilding, errorCode(err))
+
+			backoff := s.backoff(failures)
+			logger.Error().WithField("backoff", backoff).Message("service terminated, restarting")
+
+			if !s.waitForRestart(ctx, backoff) {
+				return NodeStateStopped, NodeErrorNone
+			}
+
+			service, cleanup, err = s.build(ctx, s.builder, true)
+			if err == nil {
+				break
+			}
+
+			if ctx.Err() != nil {
+				return NodeStateStopped, NodeErrorNone
+			}
+
+			if errors.Is(err, ErrMigrationsCancelled) {
+				return NodeStateStopped, NodeErrorMigrationsFailed
+			}
+		}
+
+		if ctx.Err() != nil {
+			cleanup()
+			return NodeStateStopped, NodeErrorNone
+		}
+
+		s.node.replaceService(&service, true)
+	}
+}
+
+// runUntilTerminated runs the service, pausing it while the node is suspended
+// and rebuilding it when the node is reconfigured. It returns once the
+// context is cancelled or the service terminates unexpectedly. In both cases
+// the service is cleaned up. A nil error is returned only if the context was
+// cancelled.
+func (s *supervisor) runUntilTerminated(ctx context.Context, service service.Service, cleanup func()) error {
+	for {
+		runCtx, cancelRun := context.WithCancel(ctx)
+
+		resumed, run, suspended := s.node.beginRun(cancelRun)
+		if suspended {
+			cancelRun()
+
+			select {
+			case <-resumed:
+			case req := <-s.reloads:
+				if err := s.reload(ctx, req, &service, &cleanup); err != nil {
+					return err
+				}
+			case <-ctx.Done():
+				cleanup()
+				return nil
+			}
+
+			continue
+		}
+
+		errCh := make(chan error, 1)
+		go func() {
+			defer s.node.crashes.Recover("service")
+			errCh <- s.serve(runCtx, service)
+		}()
+
+		select {
+		case err := <-errCh:
+			cancelRun()
+
+			if ctx.Err() != nil {
+				cleanup()
+				return nil
+			}
+
+			if suspended := s.node.endRun(run); suspended {
+				continue
+			}
+
+			cleanup()
+
+			if err == nil {
+				err = errors.New("service terminated without an error")
+			}
+			return newNodeError(NodeErrorServiceTerminated, err)
+		case req := <-s.reloads:
+			cancelRun()
+			<-errCh
+			s.node.endRun(run)
+
+			if err := s.reload(ctx, req, &service, &cleanup); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// reload applies the reload request. If the request requires rebuilding the
+// service the current service must not be running. The migrations aren't run
+// again so the migration callbacks aren't called. If the service can't be
+// rebuilt with the new config the supervisor falls back to the previous
+// config. An error is returned only if that fails too, in which case there is
+// no service left to clean up.
+func (s *supervisor) reload(ctx context.Context, req reloadRequest, service *service.Service, cleanup *func()) error {
+	s.maxRestarts = normalizeMaxRestarts(req.maxRestarts)
+
+	if req.builder == nil {
+		req.result <- nil
+		return nil
+	}
+
+	(*cleanup)()
+
+	s.node.lifecycle.Set(NodeStateBuilding, NodeErrorNone)
+
+	newService, newCleanup, err := s.build(ctx, *req.builder, false)
+	if err != nil {
+		req.result <- errors.Wrap(err, "error rebuilding the service with the new config")
+
+		s.log.Error().WithField(bindingslogging.ErrorField, err).Message("reconfiguring failed, falling back to the previous config")
+
+		newService, newCleanup, err = s.build(ctx, s.builder, false)
+		if err != nil {
+			return errors.Wrap(err, "error rebuilding the service with the previous config")
+		}
+	} else {
+		req.result <- nil
+		s.builder = *req.builder
+	}
+
+	*service = newService
+	*cleanup = newCleanup
+
+	s.node.replaceService(service, false)
+
+	return nil
+}
+
+// waitForRestart waits before the next restart attempt. Reload requests
+// received in the meantime only update the config which will be used to
+// rebuild the service. It returns false if the context was cancelled.
+func (s *supervisor) waitForRestart(ctx context.Context, backoff time.Duration) bool {
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			return true
+		case req := <-s.reloads:
+			s.maxRestarts = normalizeMaxRestarts(req.maxRestarts)
+			if req.builder != nil {
+				s.builder = *req.builder
+			}
+			req.result <- nil
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+func (s *supervisor) shouldRestart(failures int) bool {
+	return s.maxRestarts > 0 && failures <= s.maxRestarts
+}
+
+func (s *supervisor) runService(ctx context.Context, service service.Service) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wg := &sync.WaitGroup{}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer s.node.crashes.Recover("stats")
+		s.node.printStats(ctx, s.log, service)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer s.node.crashes.Recover("blob downloaded events")
+
+		for event := range service.App.Queries.BlobDownloadedEvents.Handle(ctx) {
+			logger := s.log.WithField("blob", event.Id).WithField("size", event.Size.InBytes())
+			if err := s.onBlobDownloaded(event); err != nil {
+				logger.Error().WithField(bindingslogging.ErrorField, err).Message("error calling onBlobDownloaded")
+			} else {
+				logger.Debug().Message("called onBlobDownloaded")
+			}
+		}
+	}()
+
+	err := service.Run(ctx)
+
+	cancel()
+	wg.Wait()
+
+	return err
+}
+
+func normalizeMaxRestarts(maxRestarts int) int {
+	if maxRestarts == 0 {
+		return defaultMaxServiceRestarts
+	}
+	return maxRestarts
+}
+
+// restartBackoff returns the time to wait before the restart following the
+// given number of consecutive failures.
+func restartBackoff(failures int) time.Duration {
+	backoff := initialRestartBackoff
+	for i := 1; i < failures; i++ {
+		backoff *= 2
+		if backoff >= maxRestartBackoff {
+			return maxRestartBackoff
+		}
+	}
+	return backoff
+}
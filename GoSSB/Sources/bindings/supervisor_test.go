@@ -0,0 +1,332 @@
+package bindings
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+	bindingslogging "verseproj/scuttlegobridge/logging"
+
+	"github.com/boreq/errors"
+	"github.com/planetary-social/scuttlego/service"
+	"github.com/planetary-social/scuttlego/service/app"
+	"github.com/planetary-social/scuttlego/service/app/commands"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestartBackoff(t *testing.T) {
+	testCases := []struct {
+		failures int
+		backoff  time.Duration
+	}{
+		{failures: 1, backoff: 1 * time.Second},
+		{failures: 2, backoff: 2 * time.Second},
+		{failures: 3, backoff: 4 * time.Second},
+		{failures: 6, backoff: 32 * time.Second},
+		{failures: 7, backoff: 1 * time.Minute},
+		{failures: 100, backoff: 1 * time.Minute},
+	}
+
+	for _, testCase := range testCases {
+		require.Equal(t, testCase.backoff, restartBackoff(testCase.failures), "failures: %d", testCase.failures)
+	}
+}
+
+func TestSupervisor_ShouldRestart(t *testing.T) {
+	s := newSupervisor(nil, serviceBuilder{}, nil, nil, 0, nil)
+	require.True(t, s.shouldRestart(defaultMaxServiceRestarts))
+	require.False(t, s.shouldRestart(defaultMaxServiceRestarts+1))
+
+	s = newSupervisor(nil, serviceBuilder{}, nil, nil, -1, nil)
+	require.False(t, s.shouldRestart(1))
+}
+
+func TestSupervisor_RebuildsTerminatedServiceUntilGivingUp(t *testing.T) {
+	services := newFakeServices(func(ctx context.Context, run int) error {
+		return errors.New("service failed")
+	})
+
+	s := newTestSupervisor(t, services, 3)
+
+	state, errorCode := s.run(context.Background(), service.Service{}, services.Cleanup)
+	require.Equal(t, NodeStateCrashed, state)
+	require.Equal(t, NodeErrorServiceTerminated, errorCode)
+
+	require.Equal(t, 3, services.Builds())
+	require.Equal(t, 3, services.Migrations())
+	require.Equal(t, 4, services.Runs())
+	require.Equal(t, 4, services.Cleanups())
+	require.Equal(t, 3, s.node.Restarts())
+}
+
+func TestSupervisor_RunsRebuiltService(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	services := newFakeServices(func(ctx context.Context, run int) error {
+		if run == 1 {
+			return errors.New("service failed")
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	s := newTestSupervisor(t, services, 3)
+
+	type result struct {
+		State     NodeState
+		ErrorCode NodeErrorCode
+	}
+
+	done := make(chan result)
+	go func() {
+		state, errorCode := s.run(ctx, service.Service{}, services.Cleanup)
+		done <- result{state, errorCode}
+	}()
+
+	require.Eventually(t, func() bool {
+		return services.Runs() == 2
+	}, time.Second, 10*time.Millisecond)
+
+	require.Equal(t, NodeStateRunning, s.node.State())
+	require.Equal(t, 1, s.node.Restarts())
+
+	cancel()
+
+	r := <-done
+	require.Equal(t, NodeStateStopped, r.State)
+	require.Equal(t, NodeErrorNone, r.ErrorCode)
+	require.Equal(t, 1, services.Builds())
+	require.Equal(t, 2, services.Cleanups())
+}
+
+// fakeServices builds services which are run using the provided function
+// called with the number of the run starting with 1.
+type fakeServices struct {
+	mutex      sync.Mutex
+	builds     int
+	migrations int
+	runs       int
+	cleanups   int
+	run        func(ctx context.Context, run int) error
+}
+
+func newFakeServices(run func(ctx context.Context, run int) error) *fakeServices {
+	return &fakeServices{run: run}
+}
+
+func (f *fakeServices) Build(ctx context.Context, builder serviceBuilder, migrate bool) (service.Service, func(), error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.builds++
+	if migrate {
+		f.migrations++
+	}
+	return service.Service{}, f.Cleanup, nil
+}
+
+func (f *fakeServices) Serve(ctx context.Context, service service.Service) error {
+	f.mutex.Lock()
+	f.runs++
+	run := f.runs
+	f.mutex.Unlock()
+
+	return f.run(ctx, run)
+}
+
+func (f *fakeServices) Cleanup() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.cleanups++
+}
+
+func (f *fakeServices) Builds() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.builds
+}
+
+func (f *fakeServices) Migrations() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.migrations
+}
+
+func (f *fakeServices) Runs() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.runs
+}
+
+func (f *fakeServices) Cleanups() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.cleanups
+}
+
+func newTestSupervisor(t *testing.T, services *fakeServices, maxRestarts int) *supervisor {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	node := NewNode()
+	s := newSupervisor(node, serviceBuilder{}, bindingslogging.NewLogrusLogger(logger), nil, maxRestarts, nil)
+	s.build = services.Build
+	s.serve = services.Serve
+	s.backoff = func(failures int) time.Duration {
+		return time.Millisecond
+	}
+	return s
+}
+
+func TestSupervisor_SuspendFollowedByImmediateResumeDoesNotRebuildService(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	services := newFakeServices(func(ctx context.Context, run int) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	s := newTestSupervisor(t, services, 3)
+
+	initial := newFakeDisconnectingService(nil)
+	s.node.service = &initial
+
+	done := make(chan NodeState)
+	go func() {
+		state, _ := s.run(ctx, initial, services.Cleanup)
+		done <- state
+	}()
+
+	require.Eventually(t, func() bool {
+		return services.Runs() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, s.node.Suspend())
+	require.NoError(t, s.node.Resume())
+
+	require.Eventually(t, func() bool {
+		return services.Runs() == 2
+	}, time.Second, 10*time.Millisecond)
+
+	require.Equal(t, 0, services.Builds())
+	require.Equal(t, 0, services.Cleanups())
+	require.Equal(t, 0, s.node.Restarts())
+	require.Equal(t, NodeStateRunning, s.node.State())
+
+	cancel()
+
+	require.Equal(t, NodeStateStopped, <-done)
+	require.Equal(t, 1, services.Cleanups())
+}
+
+func TestSupervisor_FailedSuspendResumesTheNode(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	services := newFakeServices(func(ctx context.Context, run int) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	s := newTestSupervisor(t, services, 3)
+
+	initial := newFakeDisconnectingService(errors.New("disconnecting failed"))
+	s.node.service = &initial
+
+	done := make(chan NodeState)
+	go func() {
+		state, _ := s.run(ctx, initial, services.Cleanup)
+		done <- state
+	}()
+
+	require.Eventually(t, func() bool {
+		return services.Runs() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	require.Error(t, s.node.Suspend())
+	require.False(t, s.node.IsSuspended())
+	require.Equal(t, NodeStateRunning, s.node.State())
+
+	require.Eventually(t, func() bool {
+		return services.Runs() == 2
+	}, time.Second, 10*time.Millisecond)
+
+	require.Equal(t, 0, services.Builds())
+	require.Equal(t, 0, s.node.Restarts())
+
+	cancel()
+
+	require.Equal(t, NodeStateStopped, <-done)
+}
+
+func TestSupervisor_ReloadRebuildsServiceWithoutRunningMigrations(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	services := newFakeServices(func(ctx context.Context, run int) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	reloads := make(chan reloadRequest)
+
+	s := newTestSupervisor(t, services, 3)
+	s.reloads = reloads
+
+	done := make(chan NodeState)
+	go func() {
+		state, _ := s.run(ctx, service.Service{}, services.Cleanup)
+		done <- state
+	}()
+
+	require.Eventually(t, func() bool {
+		return services.Runs() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	req := newReloadRequest(&serviceBuilder{}, 3)
+	reloads <- req
+	require.NoError(t, <-req.result)
+
+	require.Eventually(t, func() bool {
+		return services.Runs() == 2
+	}, time.Second, 10*time.Millisecond)
+
+	require.Equal(t, 1, services.Builds())
+	require.Equal(t, 0, services.Migrations())
+	require.Equal(t, 1, services.Cleanups())
+	require.Equal(t, 0, s.node.Restarts())
+
+	cancel()
+
+	require.Equal(t, NodeStateStopped, <-done)
+}
+
+type fakePeerManager struct {
+	commands.PeerManager
+	err error
+}
+
+func (f fakePeerManager) DisconnectAll() error {
+	return f.err
+}
+
+// newFakeDisconnectingService returns a service which only supports the
+// command used by Suspend. Disconnecting the peers returns the given error.
+func newFakeDisconnectingService(err error) service.Service {
+	return service.Service{
+		App: app.Application{
+			Commands: app.Commands{
+				DisconnectAll: commands.NewDisconnectAllHandler(fakePeerManager{err: err}),
+			},
+		},
+	}
+}
@@ -0,0 +1,457 @@
+package bindings
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/boreq/errors"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/planetary-social/scuttlego/service/app/common"
+	"github.com/planetary-social/scuttlego/service/app/queries"
+	"github.com/planetary-social/scuttlego/service/domain/feeds/formats"
+	"github.com/planetary-social/scuttlego/service/domain/feeds/message"
+	"github.com/planetary-social/scuttlego/service/domain/refs"
+	"github.com/ssbc/go-ssb/message/legacy"
+)
+
+const verificationProgressInterval = migrationProgressInterval
+
+var indexPrefixFeedSequences = []byte("f:")
+
+// FeedReport describes the problems found in a locally stored feed.
+type FeedReport struct {
+	Feed string `json:"feed"`
+
+	// Messages is the number of stored messages.
+	Messages int `json:"messages"`
+
+	// LatestSequence is the highest sequence of a message of this feed which
+	// was received.
+	LatestSequence int `json:"latestSequence"`
+
+	Gaps          []FeedGap          `json:"gaps"`
+	BrokenLinks   []FeedBrokenLink   `json:"brokenLinks"`
+	BadSignatures []FeedBadSignature `json:"badSignatures"`
+	Forks         []FeedFork         `json:"forks"`
+}
+
+// HasProblems returns true if any problems were found.
+func (r FeedReport) HasProblems() bool {
+	return len(r.Gaps) > 0 || len(r.BrokenLinks) > 0 || len(r.BadSignatures) > 0 || len(r.Forks) > 0
+}
+
+// FeedGap is an inclusive range of sequences of messages which aren't stored.
+type FeedGap struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// FeedBrokenLink is a message which doesn't reference the preceding message.
+// Expected is empty for the first message of a feed which must not reference
+// any message. Previous is empty if the message doesn't reference any message.
+type FeedBrokenLink struct {
+	Sequence int    `json:"sequence"`
+	Key      string `json:"key"`
+	Expected string `json:"expected"`
+	Previous string `json:"previous"`
+}
+
+// FeedBadSignature is a message which fails verification, for example because
+// its signature doesn't match its content, it was signed using a different
+// HMAC key or it was stored under a wrong key.
+type FeedBadSignature struct {
+	Sequence int    `json:"sequence"`
+	Key      string `json:"key"`
+	Error    string `json:"error"`
+}
+
+// FeedFork is a sequence for which several different messages were received.
+type FeedFork struct {
+	Sequence int      `json:"sequence"`
+	Keys     []string `json:"keys"`
+}
+
+// RepoReport describes the problems found in all locally stored feeds.
+type RepoReport struct {
+	Feeds    int `json:"feeds"`
+	Messages int `json:"messages"`
+
+	// Problems lists reports of feeds with at least one problem.
+	Problems []FeedReport `json:"problems"`
+}
+
+// VerificationOnProgressFn receives the number of verified messages out of
+// the total.
+type VerificationOnProgressFn func(messagesVerified, messagesTotal int64)
+
+// indexedFeed is a feed as seen by the index.
+type indexedFeed struct {
+	Feed           refs.Feed
+	LatestSequence int
+	Messages       int
+	Forks          []FeedFork
+}
+
+// VerifyFeed checks that the stored messages of the feed form a valid chain
+// which was signed using the configured HMAC key. Sequences of received
+// messages are taken from the index so messages which weren't indexed yet may
+// not be verified.
+func (n *Node) VerifyFeed(feed refs.Feed) (FeedReport, error) {
+	service, hmac, err := n.getVerificationDependencies()
+	if err != nil {
+		return FeedReport{}, err
+	}
+
+	index, err := n.getIndex()
+	if err != nil {
+		return FeedReport{}, errors.Wrap(err, "error getting the index")
+	}
+
+	indexed, err := index.Feed(feed)
+	if err != nil {
+		return FeedReport{}, errors.Wrap(err, "error querying the index")
+	}
+
+	return verifyFeed(newGetMessageBySequenceFn(service, feed), hmac, indexed, nil)
+}
+
+// VerifyRepo verifies every feed known to the index, see VerifyFeed.
+func (n *Node) VerifyRepo(onProgress VerificationOnProgressFn) (RepoReport, error) {
+	service, hmac, err := n.getVerificationDependencies()
+	if err != nil {
+		return RepoReport{}, err
+	}
+
+	index, err := n.getIndex()
+	if err != nil {
+		return RepoReport{}, errors.Wrap(err, "error getting the index")
+	}
+
+	feeds, err := index.Feeds()
+	if err != nil {
+		return RepoReport{}, errors.Wrap(err, "error querying the index")
+	}
+
+	var total int64
+	for _, feed := range feeds {
+		total += int64(feed.Messages)
+	}
+
+	var verified int64
+	var lastReport time.Time
+
+	progress := func(delta int) {
+		verified += int64(delta)
+		if onProgress != nil && time.Since(lastReport) >= verificationProgressInterval {
+			onProgress(verified, total)
+			lastReport = time.Now()
+		}
+	}
+
+	report := RepoReport{
+		Feeds:    len(feeds),
+		Problems: []FeedReport{},
+	}
+
+	for _, feed := range feeds {
+		if err := service.Ctx.Err(); err != nil {
+			return RepoReport{}, errors.Wrap(err, "node was stopped")
+		}
+
+		feedReport, err := verifyFeed(newGetMessageBySequenceFn(service, feed.Feed), hmac, feed, progress)
+		if err != nil {
+			return RepoReport{}, errors.Wrapf(err, "error verifying feed '%s'", feed.Feed)
+		}
+
+		report.Messages += feedReport.Messages
+		if feedReport.HasProblems() {
+			report.Problems = append(report.Problems, feedReport)
+		}
+	}
+
+	if onProgress != nil {
+		onProgress(total, total)
+	}
+
+	return report, nil
+}
+
+func (n *Node) getVerificationDependencies() (*Service, formats.MessageHMAC, error) {
+	n.mutex.Lock()
+	config := n.config
+	n.mutex.Unlock()
+
+	service, err := n.Get()
+	if err != nil {
+		return nil, formats.MessageHMAC{}, errors.Wrap(err, "error getting the service")
+	}
+
+	hmac, err := decodeMessageHMAC(config.HMACKey)
+	if err != nil {
+		return nil, formats.MessageHMAC{}, errors.Wrap(err, "error decoding the HMAC key")
+	}
+
+	return service, hmac, nil
+}
+
+func newGetMessageBySequenceFn(service *Service, feed refs.Feed) getMessageBySequenceFn {
+	return func(sequence message.Sequence) (message.Message, error) {
+		query, err := queries.NewGetMessageBySequence(feed, sequence)
+		if err != nil {
+			return message.Message{}, errors.Wrap(err, "error creating the query")
+		}
+		return service.App.Queries.GetMessageBySequence.Handle(query)
+	}
+}
+
+// verifyFeed reads the messages of the feed one by one starting with the
+// first one. It continues until the latest sequence known to the index and
+// past it for as long as more messages are stored. The progress function is
+// optional.
+func verifyFeed(get getMessageBySequenceFn, hmac formats.MessageHMAC, indexed indexedFeed, progress func(delta int)) (FeedReport, error) {
+	report := FeedReport{
+		Feed:           indexed.Feed.String(),
+		LatestSequence: indexed.LatestSequence,
+		Gaps:           []FeedGap{},
+		BrokenLinks:    []FeedBrokenLink{},
+		BadSignatures:  []FeedBadSignature{},
+		Forks:          append([]FeedFork{}, indexed.Forks...),
+	}
+
+	var hmacKey *[32]byte
+	if !hmac.IsZero() {
+		hmacKey = (*[32]byte)(hmac.Bytes())
+	}
+
+	var previous *message.Message
+	gapStart := 0
+
+	for seq := 1; ; seq++ {
+		sequence, err := message.NewSequence(seq)
+		if err != nil {
+			return FeedReport{}, errors.Wrap(err, "error creating the sequence")
+		}
+
+		msg, err := get(sequence)
+		if err != nil {
+			if !errors.Is(err, common.ErrFeedMessageNotFound) {
+				return FeedReport{}, errors.Wrapf(err, "error getting message %d", seq)
+			}
+
+			if seq > report.LatestSequence {
+				break
+			}
+
+			if gapStart == 0 {
+				gapStart = seq
+			}
+			previous = nil
+			continue
+		}
+
+		if gapStart != 0 {
+			report.Gaps = append(report.Gaps, FeedGap{From: gapStart, To: seq - 1})
+			gapStart = 0
+		}
+
+		report.Messages++
+		if seq > report.LatestSequence {
+			report.LatestSequence = seq
+		}
+
+		if problem, ok := verifyMessageSignature(msg, hmacKey); !ok {
+			report.BadSignatures = append(report.BadSignatures, FeedBadSignature{
+				Sequence: seq,
+				Key:      msg.Id().String(),
+				Error:    problem,
+			})
+		}
+
+		if brokenLink, ok := verifyMessageLink(seq, msg, previous); !ok {
+			report.BrokenLinks = append(report.BrokenLinks, brokenLink)
+		}
+
+		previous = &msg
+
+		if progress != nil {
+			progress(1)
+		}
+	}
+
+	if gapStart != 0 {
+		report.Gaps = append(report.Gaps, FeedGap{From: gapStart, To: report.LatestSequence})
+	}
+
+	return report, nil
+}
+
+func verifyMessageSignature(msg message.Message, hmacKey *[32]byte) (string, bool) {
+	key, _, err := legacy.Verify(msg.Raw().Bytes(), hmacKey)
+	if err != nil {
+		return err.Error(), false
+	}
+
+	if key.Sigil() != msg.Id().String() {
+		return "message is stored under a different key: " + key.Sigil(), false
+	}
+
+	return "", true
+}
+
+// verifyMessageLink checks the link to the previous message. Links of messages
+// directly following a gap can't be checked.
+func verifyMessageLink(seq int, msg message.Message, previous *message.Message) (FeedBrokenLink, bool) {
+	var actual string
+	if msg.Previous() != nil {
+		actual = msg.Previous().String()
+	}
+
+	var expected string
+	switch {
+	case seq == 1:
+	case previous != nil:
+		expected = previous.Id().String()
+	default:
+		return FeedBrokenLink{}, true
+	}
+
+	if actual == expected {
+		return FeedBrokenLink{}, true
+	}
+
+	return FeedBrokenLink{
+		Sequence: seq,
+		Key:      msg.Id().String(),
+		Expected: expected,
+		Previous: actual,
+	}, false
+}
+
+// Feed returns the sequences of the feed seen by the index. Zero value is
+// returned if the feed is unknown.
+func (i *index) Feed(feed refs.Feed) (indexedFeed, error) {
+	var result indexedFeed
+
+	if err := i.db.View(func(txn *badger.Txn) error {
+		feeds, err := i.scanFeeds(txn, indexFeedSequencesPrefix(feed))
+		if err != nil {
+			return err
+		}
+
+		if len(feeds) > 0 {
+			result = feeds[0]
+		}
+		return nil
+	}); err != nil {
+		return indexedFeed{}, errors.Wrap(err, "transaction failed")
+	}
+
+	result.Feed = feed
+	return result, nil
+}
+
+// Feeds returns all feeds seen by the index.
+func (i *index) Feeds() ([]indexedFeed, error) {
+	var result []indexedFeed
+
+	if err := i.db.View(func(txn *badger.Txn) error {
+		var err error
+		result, err = i.scanFeeds(txn, indexPrefixFeedSequences)
+		return err
+	}); err != nil {
+		return nil, errors.Wrap(err, "transaction failed")
+	}
+
+	return result, nil
+}
+
+// scanFeeds relies on the keys being grouped by feed and then ordered by
+// sequence.
+func (i *index) scanFeeds(txn *badger.Txn, prefix []byte) ([]indexedFeed, error) {
+	it := txn.NewIterator(badger.IteratorOptions{
+		PrefetchValues: false,
+		Prefix:         prefix,
+	})
+	defer it.Close()
+
+	var result []indexedFeed
+	var currentFeed []byte
+	var keys []string
+	lastSeq := 0
+
+	flushSequence := func() {
+		if len(keys) > 1 {
+			current := &result[len(result)-1]
+			current.Forks = append(current.Forks, FeedFork{Sequence: lastSeq, Keys: keys})
+		}
+		keys = nil
+	}
+
+	for it.Rewind(); it.ValidForPrefix(prefix); it.Next() {
+		feed, seq, key, err := decodeFeedSequenceKey(it.Item().Key())
+		if err != nil {
+			return nil, errors.Wrap(err, "error decoding the key")
+		}
+
+		if len(result) == 0 || !bytes.Equal(feed, currentFeed) {
+			flushSequence()
+
+			feedRef, err := refs.NewFeed(string(feed))
+			if err != nil {
+				return nil, errors.Wrap(err, "error creating the feed ref")
+			}
+
+			result = append(result, indexedFeed{Feed: feedRef})
+			currentFeed = append(currentFeed[:0], feed...)
+			lastSeq = 0
+		}
+
+		current := &result[len(result)-1]
+		if seq != lastSeq {
+			flushSequence()
+			current.Messages++
+			current.LatestSequence = seq
+			lastSeq = seq
+		}
+
+		keys = append(keys, key)
+	}
+
+	flushSequence()
+
+	return result, nil
+}
+
+func (i *index) addFeedSequence(txn *badger.Txn, msg queries.LogMessage) error {
+	key := indexFeedSequenceKey(msg.Message.Feed(), msg.Message.Sequence().Int(), msg.Message.Id())
+	if err := txn.Set(key, nil); err != nil {
+		return errors.Wrap(err, "error setting the sequence")
+	}
+	return nil
+}
+
+// Keys have the following format: prefix, feed, 0, sequence, message ref.
+// Several messages may be stored for the same sequence if the feed forked.
+func indexFeedSequencesPrefix(feed refs.Feed) []byte {
+	return append(append(append([]byte(nil), indexPrefixFeedSequences...), feed.String()...), 0)
+}
+
+func indexFeedSequenceKey(feed refs.Feed, seq int, id refs.Message) []byte {
+	return append(append(indexFeedSequencesPrefix(feed), encodeIndexInt(seq)...), id.String()...)
+}
+
+func decodeFeedSequenceKey(key []byte) ([]byte, int, string, error) {
+	key = key[len(indexPrefixFeedSequences):]
+
+	feed, rest, ok := bytes.Cut(key, []byte{0})
+	if !ok || len(rest) < 8 {
+		return nil, 0, "", errors.New("malformed key")
+	}
+
+	seq, err := decodeIndexInt(rest[:8])
+	if err != nil {
+		return nil, 0, "", errors.Wrap(err, "error decoding the sequence")
+	}
+
+	return feed, seq, string(rest[8:]), nil
+}
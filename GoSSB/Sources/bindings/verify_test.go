@@ -0,0 +1,158 @@
+package bindings
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/planetary-social/scuttlego/service/app/common"
+	"github.com/planetary-social/scuttlego/service/app/queries"
+	"github.com/planetary-social/scuttlego/service/domain/feeds/formats"
+	"github.com/planetary-social/scuttlego/service/domain/feeds/message"
+	"github.com/planetary-social/scuttlego/service/domain/identity"
+	"github.com/planetary-social/scuttlego/service/domain/refs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyFeed(t *testing.T) {
+	private, err := identity.NewPrivate()
+	require.NoError(t, err)
+
+	hmac := formats.MustNewMessageHMAC(make([]byte, formats.MessageHMACLength))
+	feed := newSignedFeed(t, private, hmac, "a", 5)
+	fork := newSignedFeed(t, private, hmac, "b", 5)
+
+	t.Run("intact", func(t *testing.T) {
+		report, err := verifyFeed(newStoredFeed(feed).Get, hmac, indexedFeed{Feed: feed[0].Feed(), LatestSequence: 5}, nil)
+		require.NoError(t, err)
+		require.Equal(t, 5, report.Messages)
+		require.False(t, report.HasProblems())
+
+		j, err := json.Marshal(report)
+		require.NoError(t, err)
+		require.JSONEq(t, fmt.Sprintf(`{
+			"feed": "%s",
+			"latestSequence": 5,
+			"messages": 5,
+			"gaps": [],
+			"brokenLinks": [],
+			"badSignatures": [],
+			"forks": []
+		}`, feed[0].Feed()), string(j))
+	})
+
+	t.Run("gaps", func(t *testing.T) {
+		stored := newStoredFeed(feed)
+		delete(stored, 3)
+
+		report, err := verifyFeed(stored.Get, hmac, indexedFeed{Feed: feed[0].Feed(), LatestSequence: 6}, nil)
+		require.NoError(t, err)
+		require.Equal(t, 4, report.Messages)
+		require.Equal(t, []FeedGap{{From: 3, To: 3}, {From: 6, To: 6}}, report.Gaps)
+		require.Empty(t, report.BrokenLinks)
+	})
+
+	t.Run("broken_links", func(t *testing.T) {
+		stored := newStoredFeed(feed)
+		stored[2] = fork[1]
+
+		report, err := verifyFeed(stored.Get, hmac, indexedFeed{Feed: feed[0].Feed(), LatestSequence: 5}, nil)
+		require.NoError(t, err)
+		require.Len(t, report.BrokenLinks, 2)
+		require.Equal(t, 2, report.BrokenLinks[0].Sequence)
+		require.Equal(t, feed[0].Id().String(), report.BrokenLinks[0].Expected)
+		require.Equal(t, 3, report.BrokenLinks[1].Sequence)
+		require.Empty(t, report.BadSignatures)
+	})
+
+	t.Run("bad_signatures", func(t *testing.T) {
+		report, err := verifyFeed(newStoredFeed(feed).Get, formats.NewDefaultMessageHMAC(), indexedFeed{Feed: feed[0].Feed(), LatestSequence: 5}, nil)
+		require.NoError(t, err)
+		require.Len(t, report.BadSignatures, 5)
+	})
+}
+
+func TestIndex_FeedsReportsForks(t *testing.T) {
+	index := newTestIndex(t)
+
+	private, err := identity.NewPrivate()
+	require.NoError(t, err)
+
+	hmac := formats.NewDefaultMessageHMAC()
+	feed := newSignedFeed(t, private, hmac, "a", 2)
+	fork := newSignedFeed(t, private, hmac, "b", 1)
+	other := newTestLogMessage(t, 3, `{"type":"post"}`)
+
+	msgs := []queries.LogMessage{
+		{Message: feed[0], Sequence: common.MustNewReceiveLogSequence(0)},
+		{Message: feed[1], Sequence: common.MustNewReceiveLogSequence(1)},
+		{Message: fork[0], Sequence: common.MustNewReceiveLogSequence(2)},
+		other,
+	}
+	require.NoError(t, index.Add(common.MustNewReceiveLogSequence(0), msgs))
+
+	feeds, err := index.Feeds()
+	require.NoError(t, err)
+	require.Len(t, feeds, 2)
+
+	indexed, err := index.Feed(feed[0].Feed())
+	require.NoError(t, err)
+	require.Equal(t, 2, indexed.LatestSequence)
+	require.Equal(t, 2, indexed.Messages)
+	require.Len(t, indexed.Forks, 1)
+	require.Equal(t, 1, indexed.Forks[0].Sequence)
+	require.Len(t, indexed.Forks[0].Keys, 2)
+}
+
+type storedFeed map[int]message.Message
+
+func newStoredFeed(msgs []message.Message) storedFeed {
+	stored := make(storedFeed)
+	for _, msg := range msgs {
+		stored[msg.Sequence().Int()] = msg
+	}
+	return stored
+}
+
+func (f storedFeed) Get(sequence message.Sequence) (message.Message, error) {
+	msg, ok := f[sequence.Int()]
+	if !ok {
+		return message.Message{}, common.ErrFeedMessageNotFound
+	}
+	return msg, nil
+}
+
+func newSignedFeed(t *testing.T, private identity.Private, hmac formats.MessageHMAC, text string, length int) []message.Message {
+	author, err := refs.NewIdentityFromPublic(private.Public())
+	require.NoError(t, err)
+
+	format := formats.NewScuttlebutt(rawContentParser{}, hmac)
+
+	var msgs []message.Message
+	var previous *refs.Message
+
+	for seq := 1; seq <= length; seq++ {
+		content := message.MustNewRawContent([]byte(fmt.Sprintf(`{"type":"post","text":"%s%d"}`, text, seq)))
+
+		unsigned, err := message.NewUnsignedMessage(previous, message.MustNewSequence(seq), author, author.MainFeed(), time.Now(), content)
+		require.NoError(t, err)
+
+		msg, err := format.Sign(unsigned, private)
+		require.NoError(t, err)
+
+		msgs = append(msgs, msg)
+
+		id := msg.Id()
+		previous = &id
+	}
+
+	return msgs
+}
+
+type rawContentParser struct {
+}
+
+func (p rawContentParser) Parse(raw message.RawContent) (message.Content, error) {
+	return message.NewContent(raw, nil, nil)
+}
@@ -2,53 +2,62 @@ package main
 
 import "C"
 import (
+	"encoding/json"
 	"os"
+	"path/filepath"
+	"verseproj/scuttlegobridge/bindings"
 
 	"github.com/pkg/errors"
 	"github.com/planetary-social/scuttlego/service/app/commands"
 	"github.com/planetary-social/scuttlego/service/domain/refs"
 )
 
+// ssbBlobsWant starts downloading the blob from peers. While the node is
+// under memory pressure the download is deferred, see
+// ssbNotifyMemoryPressure. Returns one of:
+//
+//  0. Error.
+//  1. The download was started.
+//  2. The download was deferred. It is dropped if the node is stopped before
+//     the memory pressure returns to normal and the blob has to be wanted
+//     again after the node is started.
+//
 //export ssbBlobsWant
-func ssbBlobsWant(ref string) bool {
-	defer logPanic()
+func ssbBlobsWant(handle int64, ref string) int {
+	defer logPanic(handle)
 
 	var err error
-	defer logError("ssbBlobsWant", &err)
+	defer logError(handle, "ssbBlobsWant", &err)
 
-	service, err := node.Get()
+	instance, err := nodes.Get(handle)
 	if err != nil {
 		err = errors.Wrap(err, "could not get the node")
-		return false
+		return 0
 	}
 
 	id, err := refs.NewBlob(ref)
 	if err != nil {
-		err = errors.Wrap(err, "could not create a ref")
-		return false
+		err = errors.Wrap(invalidArgument(err), "could not create a ref")
+		return 0
 	}
 
-	cmd := commands.DownloadBlob{
-		Id: id,
-	}
-
-	err = service.App.Commands.DownloadBlob.Handle(cmd)
+	want, err := instance.node.WantBlob(id)
 	if err != nil {
-		err = errors.Wrap(err, "command failed")
-		return false
+		err = errors.Wrap(err, "could not want the blob")
+		return 0
 	}
 
-	return true
+	return int(want)
 }
 
 //export ssbBlobsAdd
-func ssbBlobsAdd(fd int32) *C.char {
-	defer logPanic()
+func ssbBlobsAdd(handle int64, fd int32) *C.char {
+	defer logPanic(handle)
 
 	var err error
-	defer logError("ssbBlobsAdd", &err)
+	defer logError(handle, "ssbBlobsAdd", &err)
 
-	service, err := node.Get()
+	service, err := getService(handle)
 	if err != nil {
 		err = errors.Wrap(err, "could not get the node")
 		return nil
@@ -66,3 +75,166 @@ func ssbBlobsAdd(fd int32) *C.char {
 
 	return C.CString(ref.String())
 }
+
+// ssbPublishWithBlobs stores the attachments as blobs and publishes a post
+// mentioning them. Post is a JSON object in the format accepted by
+// ssbPublishPost. Attachments is a JSON array of objects with either the
+// field fd containing an open file descriptor or the field path containing
+// the path of a file and the optional field name, which defaults to the base
+// name of the path. The file descriptors are closed by this function, also
+// if it fails, unless attachments isn't a JSON array.
+//
+// A mention with the fields link, name, size and type is added to the post
+// for each attachment, mentions already linking to one of the blobs are
+// completed instead. Nothing is stored if the post is invalid and the blobs
+// added by this call are removed if publishing fails.
+//
+// Returns a JSON object with the field key containing the ref of the
+// published message and the field mentions containing the mentions of the
+// attachments in order or NULL on error.
+//
+//export ssbPublishWithBlobs
+func ssbPublishWithBlobs(handle int64, post string, attachments string) *C.char {
+	defer logPanic(handle)
+
+	var err error
+	defer logError(handle, "ssbPublishWithBlobs", &err)
+
+	sources, files, err := adoptBlobAttachments(attachments)
+	defer func() {
+		for _, file := range files {
+			if file != nil {
+				file.Close()
+			}
+		}
+	}()
+	if err != nil {
+		err = errors.Wrap(invalidArgument(err), "invalid attachments")
+		return nil
+	}
+
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the node")
+		return nil
+	}
+
+	content, err := bindings.DecodePost([]byte(post))
+	if err != nil {
+		err = errors.Wrap(err, "could not decode the post")
+		return nil
+	}
+
+	var blobAttachments []bindings.BlobAttachment
+	for i, source := range sources {
+		if files[i] == nil {
+			files[i], err = source.Open()
+			if err != nil {
+				err = errors.Wrapf(err, "could not open attachment %d", i)
+				return nil
+			}
+		}
+
+		blobAttachments = append(blobAttachments, bindings.BlobAttachment{
+			Reader: files[i],
+			Name:   source.DisplayName(),
+		})
+	}
+
+	id, mentions, err := instance.node.PublishPostWithBlobs(content, blobAttachments)
+	if err != nil {
+		err = errors.Wrap(err, "could not publish")
+		return nil
+	}
+
+	b, err := json.Marshal(publishedWithBlobs{
+		Key:      id.String(),
+		Mentions: mentions,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "json marshaling failed")
+		return nil
+	}
+
+	return C.CString(string(b))
+}
+
+type blobAttachmentSource struct {
+	Fd   *int32 `json:"fd"`
+	Path string `json:"path"`
+	Name string `json:"name"`
+}
+
+// adoptBlobAttachments decodes the attachments and takes ownership of all
+// file descriptors passed in them before anything else is validated so that
+// the caller can close them on every path. The returned files contain an
+// entry for each attachment, attachments passed by path are nil as they
+// aren't opened yet. If the attachments aren't a JSON array the file
+// descriptors can't be known and nothing is returned.
+func adoptBlobAttachments(attachments string) ([]blobAttachmentSource, []*os.File, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal([]byte(attachments), &items); err != nil {
+		return nil, nil, errors.Wrap(err, "attachments must be a JSON array")
+	}
+
+	sources := make([]blobAttachmentSource, len(items))
+	files := make([]*os.File, len(items))
+
+	var decodingErr error
+	for i, item := range items {
+		// fields which were decoded are set even if decoding fails
+		if err := json.Unmarshal(item, &sources[i]); err != nil && decodingErr == nil {
+			decodingErr = errors.Wrapf(err, "invalid attachment %d", i)
+		}
+
+		if fd := sources[i].Fd; fd != nil && *fd >= 0 {
+			files[i] = os.NewFile(uintptr(*fd), "attachment")
+		}
+	}
+
+	if decodingErr != nil {
+		return nil, files, decodingErr
+	}
+
+	for i, source := range sources {
+		if err := source.validate(); err != nil {
+			return nil, files, errors.Wrapf(err, "invalid attachment %d", i)
+		}
+	}
+
+	return sources, files, nil
+}
+
+func (s blobAttachmentSource) validate() error {
+	switch {
+	case s.Fd != nil && s.Path != "":
+		return errors.New("fd and path are mutually exclusive")
+	case s.Fd != nil:
+		if *s.Fd < 0 {
+			return errors.New("invalid fd")
+		}
+		return nil
+	case s.Path != "":
+		return nil
+	default:
+		return errors.New("either fd or path is required")
+	}
+}
+
+// Open opens an attachment passed by path. Attachments passed by fd are
+// adopted by adoptBlobAttachments instead.
+func (s blobAttachmentSource) Open() (*os.File, error) {
+	return os.Open(s.Path)
+}
+
+func (s blobAttachmentSource) DisplayName() string {
+	if s.Name == "" && s.Path != "" {
+		return filepath.Base(s.Path)
+	}
+	return s.Name
+}
+
+type publishedWithBlobs struct {
+	Key      string             `json:"key"`
+	Mentions []bindings.Mention `json:"mentions"`
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestPublishWithBlobsClosesFileDescriptorsOnError(t *testing.T) {
+	handle := nodes.Create()
+	defer nodes.Remove(handle)
+
+	testCases := []struct {
+		Name        string
+		Handle      int64
+		Post        string
+		Attachments func(fds []int) string
+	}{
+		{
+			Name:   "node_does_not_exist",
+			Handle: -1,
+			Post:   `{"text": "hello"}`,
+			Attachments: func(fds []int) string {
+				return fmt.Sprintf(`[{"fd": %d}, {"fd": %d}]`, fds[0], fds[1])
+			},
+		},
+		{
+			Name:   "invalid_post",
+			Handle: handle,
+			Post:   `not json`,
+			Attachments: func(fds []int) string {
+				return fmt.Sprintf(`[{"fd": %d}, {"fd": %d}]`, fds[0], fds[1])
+			},
+		},
+		{
+			Name:   "invalid_attachment",
+			Handle: handle,
+			Post:   `{"text": "hello"}`,
+			Attachments: func(fds []int) string {
+				return fmt.Sprintf(`[{"fd": %d}, {"fd": %d, "path": "/some/path"}]`, fds[0], fds[1])
+			},
+		},
+		{
+			Name:   "malformed_attachment",
+			Handle: handle,
+			Post:   `{"text": "hello"}`,
+			Attachments: func(fds []int) string {
+				return fmt.Sprintf(`[{"fd": %d}, {"fd": %d, "name": 5}]`, fds[0], fds[1])
+			},
+		},
+		{
+			Name:   "attachment_which_can_not_be_opened",
+			Handle: handle,
+			Post:   `{"text": "hello"}`,
+			Attachments: func(fds []int) string {
+				path, err := json.Marshal("/does/not/exist")
+				require.NoError(t, err)
+				return fmt.Sprintf(`[{"path": %s}, {"fd": %d}, {"fd": %d}]`, path, fds[0], fds[1])
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			fds := []int{newTestFd(t), newTestFd(t)}
+
+			result := ssbPublishWithBlobs(testCase.Handle, testCase.Post, testCase.Attachments(fds))
+			require.Nil(t, result)
+
+			for _, fd := range fds {
+				_, err := unix.FcntlInt(uintptr(fd), unix.F_GETFD, 0)
+				require.ErrorIs(t, err, unix.EBADF, "fd %d wasn't closed", fd)
+			}
+		})
+	}
+}
+
+func newTestFd(t *testing.T) int {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+	defer w.Close()
+
+	fd, err := unix.Dup(int(r.Fd()))
+	require.NoError(t, err)
+	return fd
+}
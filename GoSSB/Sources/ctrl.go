@@ -5,15 +5,14 @@ import (
 	"context"
 	"encoding/json"
 	"time"
+	"verseproj/scuttlegobridge/bindings"
 
 	"github.com/pkg/errors"
 	"github.com/planetary-social/scuttlego/service/app/commands"
 	"github.com/planetary-social/scuttlego/service/app/queries"
 	"github.com/planetary-social/scuttlego/service/domain/invites"
-	"github.com/planetary-social/scuttlego/service/domain/network"
 	"github.com/planetary-social/scuttlego/service/domain/refs"
 	"github.com/planetary-social/scuttlego/service/domain/rooms/aliases"
-	multiserver "github.com/ssbc/go-ssb-multiserver"
 )
 
 // typedef struct ssbRoomsAliasRegisterReturn {
@@ -23,21 +22,21 @@ import (
 import "C"
 
 //export ssbConnectPeer
-func ssbConnectPeer(quasiMs string) bool {
-	defer logPanic()
+func ssbConnectPeer(handle int64, quasiMs string) bool {
+	defer logPanic(handle)
 
 	var err error
-	defer logError("ssbConnectPeer", &err)
+	defer logError(handle, "ssbConnectPeer", &err)
 
-	service, err := node.Get()
+	service, err := getNetworkingService(handle)
 	if err != nil {
 		err = errors.Wrap(err, "could not get the node")
 		return false
 	}
 
-	addr, identity, err := multiserverAddressToAddressAndRef(quasiMs)
+	addr, identity, err := bindings.MultiserverAddressToAddressAndRef(quasiMs)
 	if err != nil {
-		err = errors.Wrapf(err, "error parsing the address '%s'", quasiMs)
+		err = errors.Wrapf(invalidArgument(err), "error parsing the address '%s'", quasiMs)
 		return false
 	}
 
@@ -56,13 +55,13 @@ func ssbConnectPeer(quasiMs string) bool {
 }
 
 //export ssbDisconnectAllPeers
-func ssbDisconnectAllPeers() bool {
-	defer logPanic()
+func ssbDisconnectAllPeers(handle int64) bool {
+	defer logPanic(handle)
 
 	var err error
-	defer logError("ssbDisconnectAllPeers", &err)
+	defer logError(handle, "ssbDisconnectAllPeers", &err)
 
-	service, err := node.Get()
+	service, err := getService(handle)
 	if err != nil {
 		err = errors.Wrap(err, "could not get the node")
 		return false
@@ -81,13 +80,13 @@ func ssbDisconnectAllPeers() bool {
 // a specific feed to the list of replicated feeds when a user views it.
 //
 //export ssbFeedReplicate
-func ssbFeedReplicate(ref string) {
-	defer logPanic()
+func ssbFeedReplicate(handle int64, ref string) {
+	defer logPanic(handle)
 
 	var err error
-	defer logError("ssbFeedReplicate", &err)
+	defer logError(handle, "ssbFeedReplicate", &err)
 
-	service, err := node.Get()
+	service, err := getService(handle)
 	if err != nil {
 		err = errors.Wrap(err, "could not get the node")
 		return
@@ -95,7 +94,7 @@ func ssbFeedReplicate(ref string) {
 
 	feedRef, err := refs.NewFeed(ref)
 	if err != nil {
-		err = errors.Wrap(err, "could not create a ref")
+		err = errors.Wrap(invalidArgument(err), "could not create a ref")
 		return
 	}
 
@@ -113,13 +112,13 @@ func ssbFeedReplicate(ref string) {
 }
 
 //export ssbInviteAccept
-func ssbInviteAccept(token string) bool {
-	defer logPanic()
+func ssbInviteAccept(handle int64, token string) bool {
+	defer logPanic(handle)
 
 	var err error
-	defer logError("ssbInviteAccept", &err)
+	defer logError(handle, "ssbInviteAccept", &err)
 
-	service, err := node.Get()
+	service, err := getNetworkingService(handle)
 	if err != nil {
 		err = errors.Wrap(err, "could not get the node")
 		return false
@@ -127,7 +126,7 @@ func ssbInviteAccept(token string) bool {
 
 	invite, err := invites.NewInviteFromString(token)
 	if err != nil {
-		err = errors.Wrap(err, "could not create an invite")
+		err = errors.Wrap(invalidArgument(err), "could not create an invite")
 		return false
 	}
 
@@ -154,27 +153,27 @@ const (
 )
 
 //export ssbRoomsAliasRegister
-func ssbRoomsAliasRegister(addressString, aliasString string) C.ssbRoomsAliasRegisterReturn_t {
-	defer logPanic()
+func ssbRoomsAliasRegister(handle int64, addressString, aliasString string) C.ssbRoomsAliasRegisterReturn_t {
+	defer logPanic(handle)
 
 	var err error
-	defer logError("ssbRoomsAliasRegister", &err)
+	defer logError(handle, "ssbRoomsAliasRegister", &err)
 
-	service, err := node.Get()
+	service, err := getNetworkingService(handle)
 	if err != nil {
 		err = errors.Wrap(err, "could not get the node")
 		return C.ssbRoomsAliasRegisterReturn_t{err: SsbRoomsAliasRegisterUnknown}
 	}
 
-	addr, identity, err := multiserverAddressToAddressAndRef(addressString)
+	addr, identity, err := bindings.MultiserverAddressToAddressAndRef(addressString)
 	if err != nil {
-		err = errors.Wrap(err, "error parsing the address")
+		err = errors.Wrap(invalidArgument(err), "error parsing the address")
 		return C.ssbRoomsAliasRegisterReturn_t{err: SsbRoomsAliasRegisterUnknown}
 	}
 
 	alias, err := aliases.NewAlias(aliasString)
 	if err != nil {
-		err = errors.Wrap(err, "could not create an alias")
+		err = errors.Wrap(invalidArgument(err), "could not create an alias")
 		return C.ssbRoomsAliasRegisterReturn_t{err: SsbRoomsAliasRegisterUnknown}
 	}
 
@@ -200,27 +199,27 @@ func ssbRoomsAliasRegister(addressString, aliasString string) C.ssbRoomsAliasReg
 }
 
 //export ssbRoomsAliasRevoke
-func ssbRoomsAliasRevoke(addressString, aliasString string) bool {
-	defer logPanic()
+func ssbRoomsAliasRevoke(handle int64, addressString, aliasString string) bool {
+	defer logPanic(handle)
 
 	var err error
-	defer logError("ssbRoomsAliasRevoke", &err)
+	defer logError(handle, "ssbRoomsAliasRevoke", &err)
 
-	service, err := node.Get()
+	service, err := getNetworkingService(handle)
 	if err != nil {
 		err = errors.Wrap(err, "could not get the node")
 		return false
 	}
 
-	addr, identity, err := multiserverAddressToAddressAndRef(addressString)
+	addr, identity, err := bindings.MultiserverAddressToAddressAndRef(addressString)
 	if err != nil {
-		err = errors.Wrap(err, "error parsing the address")
+		err = errors.Wrap(invalidArgument(err), "error parsing the address")
 		return false
 	}
 
 	alias, err := aliases.NewAlias(aliasString)
 	if err != nil {
-		err = errors.Wrap(err, "could not create an alias")
+		err = errors.Wrap(invalidArgument(err), "could not create an alias")
 		return false
 	}
 
@@ -243,21 +242,21 @@ func ssbRoomsAliasRevoke(addressString, aliasString string) bool {
 }
 
 //export ssbRoomsListAliases
-func ssbRoomsListAliases(addressString string) *C.char {
-	defer logPanic()
+func ssbRoomsListAliases(handle int64, addressString string) *C.char {
+	defer logPanic(handle)
 
 	var err error
-	defer logError("ssbRoomsListAliases", &err)
+	defer logError(handle, "ssbRoomsListAliases", &err)
 
-	service, err := node.Get()
+	service, err := getNetworkingService(handle)
 	if err != nil {
 		err = errors.Wrap(err, "could not get the node")
 		return nil
 	}
 
-	addr, identity, err := multiserverAddressToAddressAndRef(addressString)
+	addr, identity, err := bindings.MultiserverAddressToAddressAndRef(addressString)
 	if err != nil {
-		err = errors.Wrap(err, "error parsing the address")
+		err = errors.Wrap(invalidArgument(err), "error parsing the address")
 		return nil
 	}
 
@@ -289,19 +288,3 @@ func ssbRoomsListAliases(addressString string) *C.char {
 
 	return C.CString(string(j))
 }
-
-func multiserverAddressToAddressAndRef(multiserverAddress string) (network.Address, refs.Identity, error) {
-	netAddress, err := multiserver.ParseNetAddress([]byte(multiserverAddress))
-	if err != nil {
-		return network.Address{}, refs.Identity{}, errors.Wrap(err, "could not parse the address")
-	}
-
-	addr := network.NewAddress(netAddress.Addr.String())
-
-	identity, err := refs.NewIdentity(netAddress.Ref.String())
-	if err != nil {
-		return network.Address{}, refs.Identity{}, errors.Wrap(err, "error creating an identity ref")
-	}
-
-	return addr, identity, nil
-}
@@ -3,6 +3,8 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"runtime/debug"
+	"verseproj/scuttlegobridge/bindings"
 
 	"github.com/pkg/errors"
 )
@@ -10,13 +12,13 @@ import (
 import "C"
 
 //export ssbBotStatus
-func ssbBotStatus() *C.char {
-	defer logPanic()
+func ssbBotStatus(handle int64) *C.char {
+	defer logPanic(handle)
 
 	var err error
-	defer logError("ssbBotStatus", &err)
+	defer logError(handle, "ssbBotStatus", &err)
 
-	service, err := node.Get()
+	service, err := getService(handle)
 	if err != nil {
 		err = errors.Wrap(err, "could not get the node")
 		return nil
@@ -50,13 +52,13 @@ func ssbBotStatus() *C.char {
 }
 
 //export ssbOpenConnections
-func ssbOpenConnections() uint {
-	defer logPanic()
+func ssbOpenConnections(handle int64) uint {
+	defer logPanic(handle)
 
 	var err error
-	defer logError("ssbOpenConnections", &err)
+	defer logError(handle, "ssbOpenConnections", &err)
 
-	service, err := node.Get()
+	service, err := getService(handle)
 	if err != nil {
 		err = errors.Wrap(err, "could not get the node")
 		return 0
@@ -72,13 +74,13 @@ func ssbOpenConnections() uint {
 }
 
 //export ssbRepoStats
-func ssbRepoStats() *C.char {
-	defer logPanic()
+func ssbRepoStats(handle int64) *C.char {
+	defer logPanic(handle)
 
 	var err error
-	defer logError("ssbRepoStats", &err)
+	defer logError(handle, "ssbRepoStats", &err)
 
-	service, err := node.Get()
+	service, err := getService(handle)
 	if err != nil {
 		err = errors.Wrap(err, "could not get the node")
 		return nil
@@ -104,6 +106,88 @@ func ssbRepoStats() *C.char {
 	return C.CString(string(countsBytes))
 }
 
+// ssbMemoryStats returns the memory usage of the whole process encoded as JSON
+// or NULL on error. The returned object contains allocBytes, sysBytes,
+// heapIdleBytes, heapReleasedBytes, mallocs, frees, numGC, gcCPUFraction,
+// goroutines and memoryLimitBytes.
+//
+//export ssbMemoryStats
+func ssbMemoryStats() *C.char {
+	defer logPanic(noHandle)
+
+	var err error
+	defer logError(noHandle, "ssbMemoryStats", &err)
+
+	j, err := json.Marshal(bindings.ReadMemoryStats())
+	if err != nil {
+		err = errors.Wrap(err, "failed to marshal json")
+		return nil
+	}
+
+	return C.CString(string(j))
+}
+
+// ssbSetMemoryLimit sets the soft memory limit of the Go runtime in MiB. The
+// limit applies to the whole process and therefore to all nodes. A limit
+// which isn't positive restores the default limit of 500 MB.
+//
+//export ssbSetMemoryLimit
+func ssbSetMemoryLimit(limitMiB int) {
+	defer logPanic(noHandle)
+
+	setMemoryLimit(limitMiB)
+}
+
+func setMemoryLimit(limitMiB int) {
+	if limitMiB <= 0 {
+		debug.SetMemoryLimit(memoryLimitInBytes)
+		return
+	}
+
+	debug.SetMemoryLimit(int64(limitMiB) * mebibyte)
+}
+
+// ssbLastCrashReport returns the report of the last panic which occurred in
+// an exported function or in one of the goroutines of the node and removes it
+// so that each report is returned only once. Reports are stored in the debug
+// directory of the repository so the report of a panic which crashed the
+// process can be retrieved after the node is started again with ssbBotInit.
+// The report is encoded as JSON with the fields time, source, panic, stack,
+// goroutines, stats and config, the keys are removed from the config. Returns
+// NULL if there is no report or on error.
+//
+//export ssbLastCrashReport
+func ssbLastCrashReport(handle int64) *C.char {
+	defer logPanic(handle)
+
+	var err error
+	defer logError(handle, "ssbLastCrashReport", &err)
+
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the node")
+		return nil
+	}
+
+	report, err := instance.node.TakeCrashReport()
+	if err != nil {
+		err = errors.Wrap(err, "could not get the crash report")
+		return nil
+	}
+
+	if report == nil {
+		return nil
+	}
+
+	j, err := json.Marshal(report)
+	if err != nil {
+		err = errors.Wrap(err, "failed to marshal json")
+		return nil
+	}
+
+	return C.CString(string(j))
+}
+
 type botStatus struct {
 	Peers []botStatusPeer `json:"peers"`
 }
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetMemoryLimit(t *testing.T) {
+	defer debug.SetMemoryLimit(debug.SetMemoryLimit(-1))
+
+	setMemoryLimit(100)
+	require.Equal(t, int64(100*mebibyte), debug.SetMemoryLimit(-1))
+
+	setMemoryLimit(0)
+	require.Equal(t, int64(memoryLimitInBytes), debug.SetMemoryLimit(-1))
+}
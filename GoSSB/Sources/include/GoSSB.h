@@ -25,49 +25,139 @@ typedef struct ssbRoomsAliasRegisterReturn {
 
 typedef bool (notifyBlobHandle_t)(int64_t, const char*);
 typedef void (notifyMigrationOnRunning_t)(int64_t migrationIndex, int64_t migrationsCount);
+// error is one of:
+// 0 - unknown error
+// 1 - disk full
+// 2 - corrupted old go-ssb repository
+// 3 - permission denied
+// 4 - cancelled
+// 5 - data inconsistency
 typedef void (notifyMigrationOnError_t)(int64_t migrationIndex, int64_t migrationsCount, int64_t error);
+typedef void (notifyMigrationOnErrorMessage_t)(int64_t migrationIndex, int64_t migrationsCount, int64_t error, const char* message);
 typedef void (notifyMigrationOnDone_t)(int64_t migrationsCount);
+typedef void (notifyMigrationOnProgress_t)(int64_t migrationIndex, int64_t migrationsCount, int64_t itemsProcessed, int64_t itemsTotal, int64_t bytesProcessed, int64_t bytesTotal);
+// reported while the index used by ssbSearch, ssbBacklinks and
+// ssbGetMessageByKey catches up with the receive log, done is true once it did
+typedef void (notifyIndexOnProgress_t)(int64_t itemsProcessed, int64_t itemsTotal, bool done);
+
+// state is one of:
+// 0 - stopped
+// 1 - building
+// 2 - migrating
+// 3 - running
+// 4 - stopping
+// 5 - crashed
+// 6 - suspended
+//
+// error is one of:
+// 0 - no error
+// 1 - unknown error
+// 2 - invalid config
+// 3 - building the service failed
+// 4 - running migrations failed
+// 5 - the service terminated unexpectedly
+typedef void (notifyStateChanged_t)(int64_t previousState, int64_t currentState, int64_t error);
 
-extern char* ssbGenKey(void);
-
-extern bool ssbBotIsRunning(void);
-extern bool ssbBotInit(gostring_t configPath, notifyBlobHandle_t blobFn, notifyMigrationOnRunning_t migrationOnRunningFn, notifyMigrationOnError_t migrationOnErrorFn, notifyMigrationOnDone_t migrationOnDoneFn);
-extern bool ssbBotStop(void);
-extern char* ssbBotStatus(void);
-
-extern bool ssbInviteAccept(gostring_t token);
-
-extern void ssbFeedReplicate(gostring_t feed);
-
-extern bool ssbBanListSet(gostring_t hashes);
-
-extern char* ssbPublish(gostring_t content);
-extern char* ssbPublishPrivate(gostring_t content, gostring_t recipients);
+// return false to receive the same batch again later
+typedef bool (notifyReceiveLog_t)(int64_t subscription, const char* entries);
 
-extern int ssbTestingMakeNamedKey(gostring_t nick);
-extern char* ssbTestingAllNamedKeypairs();
-extern char* ssbTestingPublishAs(gostring_t nick, gostring_t content);
-extern char* ssbTestingPublishPrivateAs(gostring_t nick, gostring_t content, gostring_t recipients);
+typedef void (notifyVerificationOnProgress_t)(int64_t messagesVerified, int64_t messagesTotal);
 
-extern char* ssbRepoStats(void);
+extern char* ssbGenKey(void);
 
-extern char* ssbStreamRootLog(uint64_t seq, int limit);
-extern char* ssbStreamPrivateLog(uint64_t seq, int limit);
-extern char* ssbStreamPublishedLog(int64_t seq);
+// Returns the last error returned for the given handle (0 for functions which
+// don't take a handle) as JSON with the fields code, category, message and
+// function. code is one of:
+// 0 - no error
+// 1 - unknown error
+// 2 - node isn't running
+// 3 - node is suspended
+// 4 - unknown handle
+// 5 - invalid argument
+// 6 - timeout
+// 7 - network error
+// 8 - the peer rejected the request
+// 9 - storage error
+// 10 - not found
+// 11 - room alias is already taken
+extern char* ssbLastError(int64_t handle);
+
+// handles are always positive
+extern int64_t ssbNodeCreate(void);
+extern bool ssbNodeDestroy(int64_t handle);
+
+extern bool ssbBotIsRunning(int64_t handle);
+extern int ssbBotState(int64_t handle);
+extern char* ssbValidateConfig(gostring_t config);
+extern bool ssbBotInit(int64_t handle, gostring_t configPath, notifyBlobHandle_t blobFn, notifyMigrationOnRunning_t migrationOnRunningFn, notifyMigrationOnError_t migrationOnErrorFn, notifyMigrationOnDone_t migrationOnDoneFn, notifyStateChanged_t stateChangedFn, notifyMigrationOnErrorMessage_t migrationOnErrorMessageFn, notifyMigrationOnProgress_t migrationOnProgressFn, notifyIndexOnProgress_t indexOnProgressFn);
+extern bool ssbCancelMigrations(int64_t handle);
+extern bool ssbBotStop(int64_t handle);
+extern bool ssbBotSuspend(int64_t handle);
+extern bool ssbBotResume(int64_t handle);
+extern char* ssbNotifyMemoryPressure(int64_t handle, int level);
+extern char* ssbBotReconfigure(int64_t handle, gostring_t patch);
+extern char* ssbBotStatus(int64_t handle);
+
+extern bool ssbInviteAccept(int64_t handle, gostring_t token);
+
+extern void ssbFeedReplicate(int64_t handle, gostring_t feed);
+
+extern bool ssbBanListSet(int64_t handle, gostring_t hashes);
+
+extern char* ssbPublish(int64_t handle, gostring_t content);
+// recipients is a JSON array of 1 to 7 feed refs
+extern char* ssbPublishPrivate(int64_t handle, gostring_t content, gostring_t recipients);
+// content is a JSON object, ssbLastError lists the invalid fields on error
+extern char* ssbPublishPost(int64_t handle, gostring_t post);
+extern char* ssbPublishContact(int64_t handle, gostring_t contact);
+extern char* ssbPublishAbout(int64_t handle, gostring_t about);
+extern char* ssbPublishVote(int64_t handle, gostring_t vote);
+
+extern int ssbTestingMakeNamedKey(int64_t handle, gostring_t nick);
+extern char* ssbTestingAllNamedKeypairs(int64_t handle);
+extern char* ssbTestingPublishAs(int64_t handle, gostring_t nick, gostring_t content);
+extern char* ssbTestingPublishPrivateAs(int64_t handle, gostring_t nick, gostring_t content, gostring_t recipients);
+
+extern char* ssbRepoStats(int64_t handle);
+extern char* ssbMemoryStats(void);
+extern void ssbSetMemoryLimit(int limitMiB);
+extern char* ssbLastCrashReport(int64_t handle);
+
+extern char* ssbStreamRootLog(int64_t handle, uint64_t seq, int limit);
+// filter is a JSON object with the optional fields types, authors and excludeEncrypted
+extern char* ssbStreamRootLogFiltered(int64_t handle, int64_t seq, int limit, gostring_t filter);
+// filter is a JSON object with the optional fields rels and types
+extern char* ssbBacklinks(int64_t handle, gostring_t ref, gostring_t filter, int64_t seq, int limit);
+// pass 0 as the cursor to get the newest results, returns a JSON object with the fields results and next
+extern char* ssbSearch(int64_t handle, gostring_t query, int64_t cursor, int limit);
+extern bool ssbRebuildIndex(int64_t handle);
+extern int64_t ssbSubscribeReceiveLog(int64_t handle, int64_t fromSeq, int limit, notifyReceiveLog_t fn);
+extern bool ssbUnsubscribeReceiveLog(int64_t handle, int64_t subscription);
+extern char* ssbStreamPrivateLog(int64_t handle, uint64_t seq, int limit);
+extern char* ssbStreamPublishedLog(int64_t handle, int64_t seq, int limit);
+extern char* ssbStreamFeed(int64_t handle, gostring_t feed, int64_t seq, int limit, bool reverse);
 
 // returns true if the connection was successfull
-extern bool ssbConnectPeer(gostring_t multisrv);
+extern bool ssbConnectPeer(int64_t handle, gostring_t multisrv);
+
+extern bool ssbDisconnectAllPeers(int64_t handle);
+extern uint ssbOpenConnections(int64_t handle);
 
-extern bool ssbDisconnectAllPeers(void);
-extern uint ssbOpenConnections(void);
+extern int ssbBlobsWant(int64_t handle, gostring_t ref);
+extern char* ssbBlobsAdd(int64_t handle, int32_t fd);
+// attachments is a JSON array of objects with the field fd or path
+extern char* ssbPublishWithBlobs(int64_t handle, gostring_t post, gostring_t attachments);
 
-extern bool ssbBlobsWant(gostring_t ref);
-extern char* ssbBlobsAdd(int32_t fd);
+extern char* ssbRoomsListAliases(int64_t handle, gostring_t address);
+extern ssbRoomsAliasRegisterReturn_t ssbRoomsAliasRegister(int64_t handle, gostring_t address, gostring_t alias);
+extern bool ssbRoomsAliasRevoke(int64_t handle, gostring_t address, gostring_t alias);
 
-extern char* ssbRoomsListAliases(gostring_t address);
-extern ssbRoomsAliasRegisterReturn_t ssbRoomsAliasRegister(gostring_t address, gostring_t alias);
-extern bool ssbRoomsAliasRevoke(gostring_t address, gostring_t alias);
+extern char* ssbGetRawMessage(int64_t handle, gostring_t feedRef, uint64_t seq);
+// returns NULL if the message isn't stored locally, author is optional
+extern char* ssbGetMessageByKey(int64_t handle, gostring_t msgRef, gostring_t author);
 
-extern char* ssbGetRawMessage(gostring_t feedRef, uint64_t seq);
+// return JSON reports of gaps, broken links, bad signatures and forks
+extern char* ssbVerifyFeed(int64_t handle, gostring_t feedRef);
+extern char* ssbVerifyRepo(int64_t handle, notifyVerificationOnProgress_t progressFn);
 
 #endif
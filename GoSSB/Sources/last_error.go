@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"verseproj/scuttlegobridge/bindings"
+	"verseproj/scuttlegobridge/logging"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+	"github.com/planetary-social/scuttlego/service/app/commands"
+	"github.com/planetary-social/scuttlego/service/app/common"
+	"github.com/planetary-social/scuttlego/service/domain/blobs/replication"
+	"github.com/planetary-social/scuttlego/service/domain/transport/rpc"
+)
+
+import "C"
+
+// errorCode identifies the kind of the last error returned by an exported
+// function. The numeric values are returned by ssbLastError and therefore
+// must not change.
+type errorCode int
+
+const (
+	errorCodeNone                  errorCode = 0
+	errorCodeUnknown               errorCode = 1
+	errorCodeNodeIsNotRunning      errorCode = 2
+	errorCodeNodeIsSuspended       errorCode = 3
+	errorCodeUnknownHandle         errorCode = 4
+	errorCodeInvalidArgument       errorCode = 5
+	errorCodeTimeout               errorCode = 6
+	errorCodeNetwork               errorCode = 7
+	errorCodeRemoteRejected        errorCode = 8
+	errorCodeStorage               errorCode = 9
+	errorCodeNotFound              errorCode = 10
+	errorCodeRoomAliasAlreadyTaken errorCode = 11
+)
+
+const (
+	errorCategoryUnknown    = "unknown"
+	errorCategoryNotRunning = "not-running"
+	errorCategoryValidation = "validation"
+	errorCategoryTimeout    = "timeout"
+	errorCategoryNetwork    = "network"
+	errorCategoryStorage    = "storage"
+)
+
+var errorCategories = map[errorCode]string{
+	errorCodeNone:                  "",
+	errorCodeUnknown:               errorCategoryUnknown,
+	errorCodeNodeIsNotRunning:      errorCategoryNotRunning,
+	errorCodeNodeIsSuspended:       errorCategoryNotRunning,
+	errorCodeUnknownHandle:         errorCategoryValidation,
+	errorCodeInvalidArgument:       errorCategoryValidation,
+	errorCodeTimeout:               errorCategoryTimeout,
+	errorCodeNetwork:               errorCategoryNetwork,
+	errorCodeRemoteRejected:        errorCategoryNetwork,
+	errorCodeStorage:               errorCategoryStorage,
+	errorCodeNotFound:              errorCategoryStorage,
+	errorCodeRoomAliasAlreadyTaken: errorCategoryValidation,
+}
+
+// ssbLastError returns the last error returned by an exported function called
+// with the given handle, pass 0 for functions which don't take a handle. The
+// error is encoded as JSON with the following fields:
+//   - "code": a stable numeric code, see below.
+//   - "category": one of "unknown", "not-running", "validation", "timeout",
+//     "network" or "storage", empty if there was no error.
+//   - "message": a message meant for debugging which may change at any time.
+//   - "function": the name of the function which returned the error.
+//   - "problems": optional list of objects with the fields "field" and
+//     "problem" describing invalid fields, present only if invalid content
+//     was passed to one of the typed publish functions.
+//
+// The codes are:
+//
+//  0. No error.
+//  1. Unknown error.
+//  2. The node isn't running.
+//  3. The node is suspended, see ssbBotSuspend.
+//  4. The handle is unknown.
+//  5. An argument is invalid, for example a malformed ref or config.
+//  6. The operation timed out.
+//  7. A network error occurred, for example the peer is unreachable.
+//  8. The peer rejected the request, for example an invite was already used.
+//  9. A storage error occurred.
+//  10. The requested item wasn't found.
+//  11. The room alias is already taken.
+//
+// The last error isn't cleared when a function succeeds so it should only be
+// checked right after a function reported a failure. Concurrent calls with
+// the same handle overwrite each other's errors. Returns NULL on error.
+//
+//export ssbLastError
+func ssbLastError(handle int64) *C.char {
+	defer logPanic(handle)
+
+	j, err := json.Marshal(lastErrors.Get(handle))
+	if err != nil {
+		nodes.Logger(handle).Error().WithField(logging.ErrorField, err).Message("failed to marshal the last error")
+		return nil
+	}
+
+	return C.CString(string(j))
+}
+
+var lastErrors = newLastErrorRegistry()
+
+type lastError struct {
+	Code     errorCode `json:"code"`
+	Category string    `json:"category"`
+	Message  string    `json:"message"`
+	Function string    `json:"function"`
+
+	Problems []bindings.ContentProblem `json:"problems,omitempty"`
+}
+
+func newLastError(functionName string, err error) lastError {
+	code := classifyError(err)
+	lastErr := lastError{
+		Code:     code,
+		Category: errorCategories[code],
+		Message:  err.Error(),
+		Function: functionName,
+	}
+
+	var validationErr bindings.ContentValidationError
+	if errors.As(err, &validationErr) {
+		lastErr.Problems = validationErr.Problems
+	}
+
+	return lastErr
+}
+
+// lastErrorRegistry stores the last error per handle. It is separate from
+// the node registry so that errors caused by unknown handles can be
+// reported.
+type lastErrorRegistry struct {
+	mutex  sync.Mutex
+	errors map[int64]lastError
+}
+
+func newLastErrorRegistry() *lastErrorRegistry {
+	return &lastErrorRegistry{
+		errors: make(map[int64]lastError),
+	}
+}
+
+func (r *lastErrorRegistry) Set(handle int64, functionName string, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.errors[handle] = newLastError(functionName, err)
+}
+
+func (r *lastErrorRegistry) Get(handle int64) lastError {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	v, ok := r.errors[handle]
+	if !ok {
+		return lastError{Code: errorCodeNone}
+	}
+	return v
+}
+
+func (r *lastErrorRegistry) Remove(handle int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.errors, handle)
+}
+
+// invalidArgumentError marks errors caused by invalid arguments passed to
+// exported functions.
+type invalidArgumentError struct {
+	err error
+}
+
+func invalidArgument(err error) error {
+	return invalidArgumentError{err: err}
+}
+
+func (e invalidArgumentError) Error() string {
+	return e.err.Error()
+}
+
+func (e invalidArgumentError) Unwrap() error {
+	return e.err
+}
+
+func classifyError(err error) errorCode {
+	if err == nil {
+		return errorCodeNone
+	}
+
+	var invalidArgumentErr invalidArgumentError
+	if errors.As(err, &invalidArgumentErr) {
+		return errorCodeInvalidArgument
+	}
+
+	var validationErr bindings.ContentValidationError
+	if errors.As(err, &validationErr) {
+		return errorCodeInvalidArgument
+	}
+
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, errUnknownHandle):
+		return errorCodeUnknownHandle
+	case errors.Is(err, bindings.ErrNodeIsNotRunning):
+		return errorCodeNodeIsNotRunning
+	case errors.Is(err, bindings.ErrNodeIsSuspended):
+		return errorCodeNodeIsSuspended
+	case bindings.ErrorCodeOf(err) == bindings.NodeErrorInvalidConfig,
+		errors.Is(err, bindings.ErrInvalidPrivateMessage),
+		errors.Is(err, bindings.ErrEmptySearchQuery),
+		errors.Is(err, bindings.ErrBlobTooLarge):
+		return errorCodeInvalidArgument
+	case errors.Is(err, commands.ErrRoomAliasAlreadyTaken):
+		return errorCodeRoomAliasAlreadyTaken
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return errorCodeTimeout
+	case errors.Is(err, rpc.RemoteError{}):
+		return errorCodeRemoteRejected
+	case errors.Is(err, common.ErrFeedNotFound),
+		errors.Is(err, common.ErrFeedMessageNotFound),
+		errors.Is(err, common.ErrReceiveLogEntryNotFound),
+		errors.Is(err, bindings.ErrMessageNotFound),
+		errors.Is(err, replication.ErrBlobNotFound),
+		errors.Is(err, badger.ErrKeyNotFound):
+		return errorCodeNotFound
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return errorCodeTimeout
+		}
+		return errorCodeNetwork
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return errorCodeNetwork
+	case errors.Is(err, syscall.ENOSPC), errors.Is(err, badger.ErrDBClosed), isPathError(err):
+		return errorCodeStorage
+	default:
+		return errorCodeUnknown
+	}
+}
+
+func isPathError(err error) bool {
+	var pathErr *fs.PathError
+	return errors.As(err, &pathErr)
+}
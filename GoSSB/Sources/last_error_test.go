@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"verseproj/scuttlegobridge/bindings"
+
+	"github.com/pkg/errors"
+	"github.com/planetary-social/scuttlego/service/app/commands"
+	"github.com/planetary-social/scuttlego/service/domain/transport/rpc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyError(t *testing.T) {
+	testCases := []struct {
+		Name         string
+		Err          error
+		ExpectedCode errorCode
+	}{
+		{
+			Name:         "nil",
+			Err:          nil,
+			ExpectedCode: errorCodeNone,
+		},
+		{
+			Name:         "unknown",
+			Err:          errors.New("some error"),
+			ExpectedCode: errorCodeUnknown,
+		},
+		{
+			Name:         "not_running",
+			Err:          errors.Wrap(bindings.ErrNodeIsNotRunning, "could not get the node"),
+			ExpectedCode: errorCodeNodeIsNotRunning,
+		},
+		{
+			Name:         "suspended",
+			Err:          errors.Wrap(bindings.ErrNodeIsSuspended, "could not get the node"),
+			ExpectedCode: errorCodeNodeIsSuspended,
+		},
+		{
+			Name:         "unknown_handle",
+			Err:          errors.Wrap(errUnknownHandle, "could not get the node"),
+			ExpectedCode: errorCodeUnknownHandle,
+		},
+		{
+			Name:         "invalid_argument",
+			Err:          errors.Wrap(invalidArgument(errors.New("invalid ref")), "could not create a ref"),
+			ExpectedCode: errorCodeInvalidArgument,
+		},
+		{
+			Name:         "timeout",
+			Err:          errors.Wrap(context.DeadlineExceeded, "command failed"),
+			ExpectedCode: errorCodeTimeout,
+		},
+		{
+			Name:         "network",
+			Err:          errors.Wrap(&net.OpError{Op: "dial", Err: errors.New("connection refused")}, "command failed"),
+			ExpectedCode: errorCodeNetwork,
+		},
+		{
+			Name:         "remote_rejected",
+			Err:          errors.Wrap(rpc.NewRemoteError([]byte("invite expired")), "command failed"),
+			ExpectedCode: errorCodeRemoteRejected,
+		},
+		{
+			Name:         "blob_too_large",
+			Err:          errors.Wrap(bindings.ErrBlobTooLarge, "could not publish"),
+			ExpectedCode: errorCodeInvalidArgument,
+		},
+		{
+			Name:         "invalid_content",
+			Err:          errors.Wrap(bindings.ContentValidationError{Problems: []bindings.ContentProblem{{Field: "text", Problem: "is required"}}}, "could not publish"),
+			ExpectedCode: errorCodeInvalidArgument,
+		},
+		{
+			Name:         "alias_taken",
+			Err:          errors.Wrap(commands.ErrRoomAliasAlreadyTaken, "error calling the handler"),
+			ExpectedCode: errorCodeRoomAliasAlreadyTaken,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			require.Equal(t, testCase.ExpectedCode, classifyError(testCase.Err))
+		})
+	}
+}
+
+func TestErrorCodesHaveCategories(t *testing.T) {
+	for code := errorCodeNone; code <= errorCodeRoomAliasAlreadyTaken; code++ {
+		_, ok := errorCategories[code]
+		require.True(t, ok, "code %d has no category", code)
+	}
+}
+
+func TestLastErrorRegistry(t *testing.T) {
+	r := newLastErrorRegistry()
+
+	require.Equal(t, errorCodeNone, r.Get(1).Code)
+
+	r.Set(1, "ssbPublish", errors.Wrap(bindings.ErrNodeIsNotRunning, "could not get the node"))
+
+	lastErr := r.Get(1)
+	require.Equal(t, errorCodeNodeIsNotRunning, lastErr.Code)
+	require.Equal(t, errorCategoryNotRunning, lastErr.Category)
+	require.Equal(t, "ssbPublish", lastErr.Function)
+	require.NotEmpty(t, lastErr.Message)
+
+	require.Equal(t, errorCodeNone, r.Get(2).Code)
+
+	r.Remove(1)
+	require.Equal(t, errorCodeNone, r.Get(1).Code)
+}
+
+func TestLastErrorListsContentProblems(t *testing.T) {
+	problems := []bindings.ContentProblem{{Field: "text", Problem: "is required"}}
+
+	lastErr := newLastError("ssbPublishPost", errors.Wrap(bindings.ContentValidationError{Problems: problems}, "could not publish"))
+	require.Equal(t, errorCodeInvalidArgument, lastErr.Code)
+	require.Equal(t, problems, lastErr.Problems)
+}
+
+func TestLastErrorReportsNodeWhichIsNotRunning(t *testing.T) {
+	handle := nodes.Create()
+	defer nodes.Remove(handle)
+
+	_, err := getService(handle)
+	require.Error(t, err)
+	require.Equal(t, errorCodeNodeIsNotRunning, newLastError("ssbPublish", errors.Wrap(err, "could not get the node")).Code)
+}
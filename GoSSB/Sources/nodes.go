@@ -0,0 +1,187 @@
+package main
+
+import "C"
+import (
+	"sync"
+	"verseproj/scuttlegobridge/bindings"
+	"verseproj/scuttlegobridge/logging"
+
+	"github.com/pkg/errors"
+)
+
+// noHandle is passed to the logging functions by exported functions which
+// don't operate on a particular node.
+const noHandle = 0
+
+var errUnknownHandle = errors.New("unknown node handle")
+
+// ssbNodeCreate creates a new node and returns a handle which identifies it in
+// calls to all other functions. Each node is configured and started
+// separately with ssbBotInit and has its own repository, logger and
+// callbacks. Handles are always positive.
+//
+//export ssbNodeCreate
+func ssbNodeCreate() int64 {
+	defer logPanic(noHandle)
+
+	return nodes.Create()
+}
+
+// ssbNodeDestroy stops the node if it is running and releases the handle. The
+// handle can't be used after calling this function.
+//
+//export ssbNodeDestroy
+func ssbNodeDestroy(handle int64) bool {
+	defer logPanic(handle)
+
+	var err error
+	defer logError(handle, "ssbNodeDestroy", &err)
+
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the node")
+		return false
+	}
+
+	err = instance.node.Stop()
+	if err != nil {
+		if !errors.Is(err, bindings.ErrNodeIsNotRunning) {
+			err = errors.Wrap(err, "failed to stop the node")
+			return false
+		}
+	}
+
+	nodes.Remove(handle)
+	lastErrors.Remove(handle)
+	return true
+}
+
+var nodes = newNodeRegistry()
+
+type nodeRegistry struct {
+	mutex      sync.Mutex
+	nodes      map[int64]*nodeInstance
+	nextHandle int64
+}
+
+func newNodeRegistry() *nodeRegistry {
+	return &nodeRegistry{
+		nodes:      make(map[int64]*nodeInstance),
+		nextHandle: noHandle + 1,
+	}
+}
+
+func (r *nodeRegistry) Create() int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	handle := r.nextHandle
+	r.nextHandle++
+
+	r.nodes[handle] = newNodeInstance()
+	return handle
+}
+
+func (r *nodeRegistry) Get(handle int64) (*nodeInstance, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	instance, ok := r.nodes[handle]
+	if !ok {
+		return nil, errors.Wrapf(errUnknownHandle, "handle %d", handle)
+	}
+
+	return instance, nil
+}
+
+func (r *nodeRegistry) Remove(handle int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.nodes, handle)
+}
+
+// Reporting returns the nodes to which a panic in a function called with the
+// given handle should be reported. If the handle is unknown all nodes are
+// returned.
+func (r *nodeRegistry) Reporting(handle int64) []*nodeInstance {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if instance, ok := r.nodes[handle]; ok {
+		return []*nodeInstance{instance}
+	}
+
+	var result []*nodeInstance
+	for _, instance := range r.nodes {
+		result = append(result, instance)
+	}
+	return result
+}
+
+// Logger returns the logger of the node with the given handle. If the handle
+// is unknown or the node wasn't initialized yet the pre-init logger is
+// returned.
+func (r *nodeRegistry) Logger(handle int64) logging.Logger {
+	instance, err := r.Get(handle)
+	if err != nil {
+		return log.WithField("handle", handle)
+	}
+	return instance.Logger()
+}
+
+type nodeInstance struct {
+	node *bindings.Node
+
+	logMutex sync.Mutex
+	log      logging.Logger
+}
+
+func newNodeInstance() *nodeInstance {
+	return &nodeInstance{
+		node: bindings.NewNode(),
+	}
+}
+
+func (i *nodeInstance) Logger() logging.Logger {
+	i.logMutex.Lock()
+	defer i.logMutex.Unlock()
+
+	if i.log == nil {
+		return log
+	}
+	return i.log
+}
+
+func (i *nodeInstance) SetLogger(logger logging.Logger) {
+	i.logMutex.Lock()
+	defer i.logMutex.Unlock()
+
+	i.log = logger
+}
+
+// getService returns the service of a running node with the given handle.
+func getService(handle int64) (*bindings.Service, error) {
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get the node instance")
+	}
+
+	return instance.node.Get()
+}
+
+// getNetworkingService returns the service of a running node with the given
+// handle. It fails if the node is suspended and therefore shouldn't be used
+// to establish new connections.
+func getNetworkingService(handle int64) (*bindings.Service, error) {
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get the node instance")
+	}
+
+	if instance.node.IsSuspended() {
+		return nil, bindings.ErrNodeIsSuspended
+	}
+
+	return instance.node.Get()
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeRegistry(t *testing.T) {
+	r := newNodeRegistry()
+
+	handle1 := r.Create()
+	handle2 := r.Create()
+	require.Positive(t, handle1)
+	require.NotEqual(t, handle1, handle2)
+
+	instance1, err := r.Get(handle1)
+	require.NoError(t, err)
+
+	instance2, err := r.Get(handle2)
+	require.NoError(t, err)
+
+	require.NotSame(t, instance1.node, instance2.node)
+
+	r.Remove(handle1)
+
+	_, err = r.Get(handle1)
+	require.ErrorIs(t, err, errUnknownHandle)
+
+	_, err = r.Get(handle2)
+	require.NoError(t, err)
+}
@@ -2,30 +2,33 @@ package main
 
 import "C"
 import (
+	"encoding/json"
+	"verseproj/scuttlegobridge/bindings"
+
 	"github.com/pkg/errors"
 	"github.com/planetary-social/scuttlego/service/app/commands"
+	"github.com/planetary-social/scuttlego/service/domain/refs"
 )
 
 //export ssbPublish
-func ssbPublish(content string) *C.char {
-	defer logPanic()
+func ssbPublish(handle int64, content string) *C.char {
+	defer logPanic(handle)
 
 	var err error
-	defer logError("ssbPublish", &err)
+	defer logError(handle, "ssbPublish", &err)
 
-	service, err := node.Get()
-	if err != nil {
-		err = errors.Wrap(err, "could not get the node")
+	if _, err = commands.NewPublishRaw([]byte(content)); err != nil {
+		err = errors.Wrap(invalidArgument(err), "error creating a command")
 		return nil
 	}
 
-	cmd, err := commands.NewPublishRaw([]byte(content))
+	instance, err := nodes.Get(handle)
 	if err != nil {
-		err = errors.Wrap(err, "error creating a command")
+		err = errors.Wrap(err, "could not get the node")
 		return nil
 	}
 
-	id, err := service.App.Commands.PublishRaw.Handle(cmd)
+	id, err := instance.node.PublishRaw([]byte(content))
 	if err != nil {
 		err = errors.Wrap(err, "command failed")
 		return nil
@@ -34,9 +37,171 @@ func ssbPublish(content string) *C.char {
 	return C.CString(id.String())
 }
 
+// ssbPublishPrivate encrypts the content using private-box and publishes it.
+// Content must be a JSON object with a type field. Recipients must be a JSON
+// array of 1 to 7 feed refs. The current identity has to be one of the
+// recipients in order to be able to read the message later. Returns the ref
+// of the published message or NULL on error.
+//
 //export ssbPublishPrivate
-func ssbPublishPrivate(content, recps string) *C.char {
-	defer logPanic()
+func ssbPublishPrivate(handle int64, content, recps string) *C.char {
+	defer logPanic(handle)
+
+	var err error
+	defer logError(handle, "ssbPublishPrivate", &err)
+
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the node")
+		return nil
+	}
+
+	var recipientRefs []string
+	if err = json.Unmarshal([]byte(recps), &recipientRefs); err != nil {
+		err = errors.Wrap(invalidArgument(err), "could not unmarshal the recipients")
+		return nil
+	}
+
+	var recipients []refs.Identity
+	for _, recipientRef := range recipientRefs {
+		var recipient refs.Identity
+		recipient, err = refs.NewIdentity(recipientRef)
+		if err != nil {
+			err = errors.Wrapf(invalidArgument(err), "invalid recipient '%s'", recipientRef)
+			return nil
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	id, err := instance.node.PublishPrivate([]byte(content), recipients)
+	if err != nil {
+		err = errors.Wrap(err, "could not publish")
+		return nil
+	}
+
+	return C.CString(id.String())
+}
+
+// ssbPublishPost publishes a post. Post is a JSON object with the field text
+// and the optional fields root, branch, mentions and channel. Branch is a
+// message ref or an array of message refs and requires root. Mentions is an
+// array of objects with the field link containing a feed, message or blob ref
+// or a channel prefixed with # and the optional fields name, size and type.
+// Returns the ref of the published message or NULL on error.
+//
+// Unknown fields, invalid refs, missing fields and content which would make
+// the message exceed the size limit are rejected before anything is signed.
+// In that case ssbLastError reports the invalid argument error code and lists
+// the problems in the field problems, the same as ssbValidateConfig.
+//
+//export ssbPublishPost
+func ssbPublishPost(handle int64, post string) *C.char {
+	defer logPanic(handle)
+
+	var err error
+	defer logError(handle, "ssbPublishPost", &err)
+
+	content, err := bindings.DecodePost([]byte(post))
+	if err != nil {
+		err = errors.Wrap(err, "could not decode the post")
+		return nil
+	}
+
+	id, err := publishTyped(handle, content)
+	if err != nil {
+		err = errors.Wrap(err, "could not publish")
+		return nil
+	}
+
+	return C.CString(id.String())
+}
+
+// ssbPublishContact follows, unfollows, blocks or unblocks a feed. Contact is
+// a JSON object with the field contact containing a feed ref and at least one
+// of the boolean fields following and blocking. Returns the ref of the
+// published message or NULL on error, see ssbPublishPost.
+//
+//export ssbPublishContact
+func ssbPublishContact(handle int64, contact string) *C.char {
+	defer logPanic(handle)
+
+	var err error
+	defer logError(handle, "ssbPublishContact", &err)
+
+	content, err := bindings.DecodeContact([]byte(contact))
+	if err != nil {
+		err = errors.Wrap(err, "could not decode the contact")
+		return nil
+	}
+
+	id, err := publishTyped(handle, content)
+	if err != nil {
+		err = errors.Wrap(err, "could not publish")
+		return nil
+	}
+
+	return C.CString(id.String())
+}
+
+// ssbPublishAbout describes a feed or a message. About is a JSON object with
+// the field about containing a feed or message ref and at least one of the
+// fields name, description and image containing a blob ref. Returns the ref
+// of the published message or NULL on error, see ssbPublishPost.
+//
+//export ssbPublishAbout
+func ssbPublishAbout(handle int64, about string) *C.char {
+	defer logPanic(handle)
+
+	var err error
+	defer logError(handle, "ssbPublishAbout", &err)
+
+	content, err := bindings.DecodeAbout([]byte(about))
+	if err != nil {
+		err = errors.Wrap(err, "could not decode the about")
+		return nil
+	}
+
+	id, err := publishTyped(handle, content)
+	if err != nil {
+		err = errors.Wrap(err, "could not publish")
+		return nil
+	}
+
+	return C.CString(id.String())
+}
+
+// ssbPublishVote likes or unlikes a message. Vote is a JSON object with the
+// field link containing a message ref, the field value which is 1, 0 or -1
+// and the optional fields expression, root and branch. Returns the ref of the
+// published message or NULL on error, see ssbPublishPost.
+//
+//export ssbPublishVote
+func ssbPublishVote(handle int64, vote string) *C.char {
+	defer logPanic(handle)
+
+	var err error
+	defer logError(handle, "ssbPublishVote", &err)
+
+	content, err := bindings.DecodeVote([]byte(vote))
+	if err != nil {
+		err = errors.Wrap(err, "could not decode the vote")
+		return nil
+	}
+
+	id, err := publishTyped(handle, content)
+	if err != nil {
+		err = errors.Wrap(err, "could not publish")
+		return nil
+	}
+
+	return C.CString(id.String())
+}
+
+func publishTyped(handle int64, content bindings.TypedContent) (refs.Message, error) {
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		return refs.Message{}, errors.Wrap(err, "could not get the node")
+	}
 
-	return nil
+	return instance.node.PublishTyped(content)
 }
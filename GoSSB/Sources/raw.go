@@ -2,6 +2,8 @@ package main
 
 import "C"
 import (
+	"encoding/json"
+
 	"github.com/pkg/errors"
 	"github.com/planetary-social/scuttlego/service/app/queries"
 	"github.com/planetary-social/scuttlego/service/domain/feeds/message"
@@ -12,13 +14,13 @@ import (
 // sequence starts at 1.
 //
 //export ssbGetRawMessage
-func ssbGetRawMessage(feedRef string, seq int64) *C.char {
-	defer logPanic()
+func ssbGetRawMessage(handle int64, feedRef string, seq int64) *C.char {
+	defer logPanic(handle)
 
 	var err error
-	defer logError("ssbGetRawMessage", &err)
+	defer logError(handle, "ssbGetRawMessage", &err)
 
-	service, err := node.Get()
+	service, err := getService(handle)
 	if err != nil {
 		err = errors.Wrap(err, "could not get the node")
 		return nil
@@ -26,13 +28,13 @@ func ssbGetRawMessage(feedRef string, seq int64) *C.char {
 
 	feed, err := refs.NewFeed(feedRef)
 	if err != nil {
-		err = errors.Wrap(err, "error creating a feed ref")
+		err = errors.Wrap(invalidArgument(err), "error creating a feed ref")
 		return nil
 	}
 
 	sequence, err := message.NewSequence(int(seq))
 	if err != nil {
-		err = errors.Wrap(err, "error creating a sequence")
+		err = errors.Wrap(invalidArgument(err), "error creating a sequence")
 		return nil
 	}
 
@@ -50,3 +52,64 @@ func ssbGetRawMessage(feedRef string, seq int64) *C.char {
 
 	return C.CString(string(msg.Raw().Bytes()))
 }
+
+// ssbGetMessageByKey returns the message with the given key in the %-notation
+// as a JSON object in the same format as the elements of the array returned by
+// ssbStreamRootLog. receiveLogSequence is -1 if the message wasn't indexed yet.
+// If the message isn't stored locally NULL is returned and ssbLastError
+// reports the not found error code. In that case, if author is not empty, the
+// author's feed is requested from peers so that the message may become
+// available later.
+//
+//export ssbGetMessageByKey
+func ssbGetMessageByKey(handle int64, msgRef string, author string) *C.char {
+	defer logPanic(handle)
+
+	var err error
+	defer logError(handle, "ssbGetMessageByKey", &err)
+
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the node")
+		return nil
+	}
+
+	id, err := refs.NewMessage(msgRef)
+	if err != nil {
+		err = errors.Wrap(invalidArgument(err), "error creating a message ref")
+		return nil
+	}
+
+	var authorRef refs.Feed
+	if author != "" {
+		authorRef, err = refs.NewFeed(author)
+		if err != nil {
+			err = errors.Wrap(invalidArgument(err), "error creating a feed ref")
+			return nil
+		}
+	}
+
+	msg, sequence, err := instance.node.GetMessageByKey(id, authorRef)
+	if err != nil {
+		err = errors.Wrap(err, "error getting the message")
+		return nil
+	}
+
+	entry := logEntry{
+		Key:                msg.Id().String(),
+		Value:              msg.Raw().Bytes(),
+		ReceiveLogSequence: unknownReceiveLogSequence,
+	}
+
+	if sequence != nil {
+		entry.ReceiveLogSequence = sequence.Int()
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		err = errors.Wrap(err, "json marshaling failed")
+		return nil
+	}
+
+	return C.CString(string(b))
+}
@@ -0,0 +1,109 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// ssbSearch returns posts containing all words of the query, from the newest
+// to the oldest. Words prefixed with a # or an @ only match hashtags and
+// mentions, other words match them as well as regular words. Passing 0 as the
+// cursor returns the newest posts, otherwise only posts received before the
+// post with the given receive log sequence are returned. Limit must be a
+// positive number.
+//
+// Returns a JSON object with the fields results and next. Each result has the
+// fields key, receiveLogSequence and snippet which is a fragment of the text
+// of the post around the first match. Next should be passed as the cursor to
+// get the following page, 0 means that there are no more results. The search
+// is performed using an index which lags behind the receive log.
+//
+//export ssbSearch
+func ssbSearch(handle int64, query string, cursor int64, limit int) *C.char {
+	defer logPanic(handle)
+
+	var err error
+	defer logError(handle, "ssbSearch", &err)
+
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the node")
+		return nil
+	}
+
+	if cursor < 0 {
+		err = invalidArgument(errors.New("cursor can't be negative"))
+		return nil
+	}
+
+	if limit <= 0 {
+		err = invalidArgument(errors.New("limit must be positive"))
+		return nil
+	}
+
+	results, next, err := instance.node.Search(query, int(cursor), limit)
+	if err != nil {
+		err = errors.Wrap(err, "search failed")
+		return nil
+	}
+
+	response := searchResponse{
+		Results: make([]searchResult, 0), // prevent empty arrays rendering as null
+		Next:    next,
+	}
+
+	for _, result := range results {
+		response.Results = append(response.Results, searchResult{
+			Key:                result.Key.String(),
+			ReceiveLogSequence: result.Sequence.Int(),
+			Snippet:            result.Snippet,
+		})
+	}
+
+	b, err := json.Marshal(response)
+	if err != nil {
+		err = errors.Wrap(err, "json marshaling failed")
+		return nil
+	}
+
+	return C.CString(string(b))
+}
+
+// ssbRebuildIndex removes the index used by ssbSearch, ssbBacklinks,
+// ssbStreamPrivateLog and ssbGetMessageByKey so that it is rebuilt in the
+// background. The progress is reported using the callback passed to
+// ssbBotInit.
+//
+//export ssbRebuildIndex
+func ssbRebuildIndex(handle int64) bool {
+	defer logPanic(handle)
+
+	var err error
+	defer logError(handle, "ssbRebuildIndex", &err)
+
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the node")
+		return false
+	}
+
+	if err = instance.node.RebuildIndex(); err != nil {
+		err = errors.Wrap(err, "rebuilding the index failed")
+		return false
+	}
+
+	return true
+}
+
+type searchResponse struct {
+	Results []searchResult `json:"results"`
+	Next    int            `json:"next"`
+}
+
+type searchResult struct {
+	Key                string `json:"key"`
+	ReceiveLogSequence int    `json:"receiveLogSequence"`
+	Snippet            string `json:"snippet"`
+}
@@ -1,14 +1,26 @@
 package main
 
+// #include <stdlib.h>
+// #include <stdint.h>
+// #include <stdbool.h>
+//
+// static bool callNotifyReceiveLog(void *func, int64_t subscription, const char *entries)
+// {
+//     return ((bool(*)(int64_t, const char *))func)(subscription, entries);
+// }
 import "C"
 import (
 	"bytes"
 	"encoding/json"
+	"sync"
 	"time"
+	"unsafe"
+	"verseproj/scuttlegobridge/bindings"
 
 	"github.com/pkg/errors"
 	"github.com/planetary-social/scuttlego/service/app/common"
 	"github.com/planetary-social/scuttlego/service/app/queries"
+	"github.com/planetary-social/scuttlego/service/domain/refs"
 )
 
 // ssbStreamRootLog returns received messages. Only messages with a sequence
@@ -18,13 +30,13 @@ import (
 // Number of returned messages can be limited. Limit must be a positive number.
 //
 //export ssbStreamRootLog
-func ssbStreamRootLog(startSeq int64, limit int) *C.char {
-	defer logPanic()
+func ssbStreamRootLog(handle int64, startSeq int64, limit int) *C.char {
+	defer logPanic(handle)
 
 	var err error
-	defer logError("ssbStreamRootLog", &err)
+	defer logError(handle, "ssbStreamRootLog", &err)
 
-	service, err := node.Get()
+	service, err := getService(handle)
 	if err != nil {
 		err = errors.Wrap(err, "could not get the node")
 		return nil
@@ -32,7 +44,7 @@ func ssbStreamRootLog(startSeq int64, limit int) *C.char {
 
 	receiveLogSequence, err := common.NewReceiveLogSequence(int(startSeq))
 	if err != nil {
-		err = errors.Wrap(err, "could not create a receive log sequence")
+		err = errors.Wrap(invalidArgument(err), "could not create a receive log sequence")
 		return nil
 	}
 
@@ -41,7 +53,7 @@ func ssbStreamRootLog(startSeq int64, limit int) *C.char {
 		limit,
 	)
 	if err != nil {
-		err = errors.Wrap(err, "could not create a query")
+		err = errors.Wrap(invalidArgument(err), "could not create a query")
 		return nil
 	}
 
@@ -53,7 +65,7 @@ func ssbStreamRootLog(startSeq int64, limit int) *C.char {
 		return nil
 	}
 
-	log.
+	nodes.Logger(handle).
 		Debug().
 		WithField("param.startSeq", startSeq).
 		WithField("param.limit", limit).
@@ -71,59 +83,385 @@ func ssbStreamRootLog(startSeq int64, limit int) *C.char {
 	return C.CString(buf.String())
 }
 
+// ssbStreamRootLogFiltered returns received messages matching the filter.
+// Sequence and limit work the same as in ssbStreamRootLog. The filter is a
+// JSON object with the following optional fields:
+//
+//	types            - array of content types, e.g. "post" or "vote"
+//	authors          - array of identities
+//	excludeEncrypted - bool
+//
+// Returns a JSON object with the fields messages, containing an array of
+// messages in the same format as ssbStreamRootLog, and next, containing the
+// sequence which should be passed to the next call. The next sequence moves
+// forward even if all scanned messages were filtered out so fewer messages
+// than the limit, possibly none, may be returned before the end of the receive
+// log is reached. The end was reached if next is equal to the given sequence.
+//
+//export ssbStreamRootLogFiltered
+func ssbStreamRootLogFiltered(handle int64, startSeq int64, limit int, filterJSON string) *C.char {
+	defer logPanic(handle)
+
+	var err error
+	defer logError(handle, "ssbStreamRootLogFiltered", &err)
+
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the node")
+		return nil
+	}
+
+	receiveLogSequence, err := common.NewReceiveLogSequence(int(startSeq))
+	if err != nil {
+		err = errors.Wrap(invalidArgument(err), "could not create a receive log sequence")
+		return nil
+	}
+
+	if limit <= 0 {
+		err = invalidArgument(errors.New("limit must be positive"))
+		return nil
+	}
+
+	var filter bindings.ReceiveLogFilter
+	if filterJSON != "" {
+		if err = json.Unmarshal([]byte(filterJSON), &filter); err != nil {
+			err = errors.Wrap(invalidArgument(err), "could not unmarshal the filter")
+			return nil
+		}
+	}
+
+	if err = filter.Validate(); err != nil {
+		err = errors.Wrap(invalidArgument(err), "invalid filter")
+		return nil
+	}
+
+	start := time.Now()
+
+	msgs, next, err := instance.node.FilteredReceiveLog(receiveLogSequence, limit, filter)
+	if err != nil {
+		err = errors.Wrap(err, "query failed")
+		return nil
+	}
+
+	nodes.Logger(handle).
+		Debug().
+		WithField("param.startSeq", startSeq).
+		WithField("param.limit", limit).
+		WithField("n", len(msgs)).
+		WithField("next", next.Int()).
+		WithField("duration", time.Since(start)).
+		Message("returning new messages in ssbStreamRootLogFiltered")
+
+	var entries bytes.Buffer
+	if err = marshalAsLog(&entries, msgs); err != nil {
+		err = errors.Wrap(err, "marshaling failed")
+		return nil
+	}
+
+	b, err := json.Marshal(filteredLog{
+		Messages: entries.Bytes(),
+		Next:     next.Int(),
+	})
+	if err != nil {
+		err = errors.Wrap(err, "json marshaling failed")
+		return nil
+	}
+
+	return C.CString(string(b))
+}
+
+// ssbBacklinks returns messages which link to the given message, feed or blob
+// ref from their content. Sequence and limit work the same as in
+// ssbStreamRootLogFiltered. The filter is a JSON object with the following
+// optional fields:
+//
+//	rels  - array of relations, one of "root", "branch", "mention", "vote",
+//	        "contact" or "link" which is used for links in other fields
+//	types - array of content types of the linking messages
+//
+// Returns a JSON object with the fields messages and next. The messages are in
+// the same format as in ssbStreamRootLog with an additional field rels listing
+// the relations with which the message links to the ref. The backlinks are
+// maintained in an index which lags behind the receive log.
+//
+//export ssbBacklinks
+func ssbBacklinks(handle int64, ref string, filterJSON string, startSeq int64, limit int) *C.char {
+	defer logPanic(handle)
+
+	var err error
+	defer logError(handle, "ssbBacklinks", &err)
+
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the node")
+		return nil
+	}
+
+	receiveLogSequence, err := common.NewReceiveLogSequence(int(startSeq))
+	if err != nil {
+		err = errors.Wrap(invalidArgument(err), "could not create a receive log sequence")
+		return nil
+	}
+
+	if limit <= 0 {
+		err = invalidArgument(errors.New("limit must be positive"))
+		return nil
+	}
+
+	var filter bindings.BacklinksFilter
+	if filterJSON != "" {
+		if err = json.Unmarshal([]byte(filterJSON), &filter); err != nil {
+			err = errors.Wrap(invalidArgument(err), "could not unmarshal the filter")
+			return nil
+		}
+	}
+
+	if _, ok := bindings.ParseLinkTarget(ref); !ok {
+		err = invalidArgument(errors.New("ref must be a message, feed or blob ref"))
+		return nil
+	}
+
+	backlinks, next, err := instance.node.Backlinks(ref, filter, receiveLogSequence, limit)
+	if err != nil {
+		err = errors.Wrap(err, "query failed")
+		return nil
+	}
+
+	entries := make([]backlinkEntry, 0) // prevent empty arrays rendering as null
+	for _, backlink := range backlinks {
+		entries = append(entries, backlinkEntry{
+			logEntry: logEntry{
+				Key:                backlink.Source.String(),
+				Value:              backlink.Message.Raw().Bytes(),
+				ReceiveLogSequence: backlink.Sequence.Int(),
+			},
+			Rels: backlink.Rels,
+		})
+	}
+
+	messages, err := json.Marshal(entries)
+	if err != nil {
+		err = errors.Wrap(err, "json marshaling failed")
+		return nil
+	}
+
+	b, err := json.Marshal(filteredLog{
+		Messages: messages,
+		Next:     next.Int(),
+	})
+	if err != nil {
+		err = errors.Wrap(err, "json marshaling failed")
+		return nil
+	}
+
+	return C.CString(string(b))
+}
+
+// ssbSubscribeReceiveLog delivers received messages to the callback as they
+// are appended to the receive log, starting with the message with the given
+// receive log sequence. See ssbStreamRootLog for the description of the
+// sequence. The callback receives the identifier of the subscription and a
+// JSON array of at most limit messages in the same format as returned by
+// ssbStreamRootLog. The array is freed once the callback returns. The
+// callback is called from a background thread and the next batch is
+// delivered only after it returns. If the callback returns false the same
+// batch is delivered again after a while. The subscription ends when the
+// node stops or when ssbUnsubscribeReceiveLog is called. Returns the
+// identifier of the subscription which is always positive or 0 on error.
+//
+//export ssbSubscribeReceiveLog
+func ssbSubscribeReceiveLog(handle int64, fromSeq int64, limit int, notifyReceiveLogFn uintptr) int64 {
+	defer logPanic(handle)
+
+	var err error
+	defer logError(handle, "ssbSubscribeReceiveLog", &err)
+
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the node")
+		return 0
+	}
+
+	if notifyReceiveLogFn == 0 {
+		err = invalidArgument(errors.New("nil callback"))
+		return 0
+	}
+
+	if limit <= 0 {
+		err = invalidArgument(errors.New("limit must be positive"))
+		return 0
+	}
+
+	receiveLogSequence, err := common.NewReceiveLogSequence(int(fromSeq))
+	if err != nil {
+		err = errors.Wrap(invalidArgument(err), "could not create a receive log sequence")
+		return 0
+	}
+
+	var subscription int64
+	var subscriptionMutex sync.Mutex
+
+	onReceiveLogFn := func(msgs []queries.LogMessage) error {
+		var buf bytes.Buffer
+		if err := marshalAsLog(&buf, msgs); err != nil {
+			return errors.Wrap(err, "marshaling failed")
+		}
+
+		subscriptionMutex.Lock()
+		id := subscription
+		subscriptionMutex.Unlock()
+
+		entries := C.CString(buf.String())
+		defer C.free(unsafe.Pointer(entries))
+
+		if !C.callNotifyReceiveLog(unsafeExternPointer(notifyReceiveLogFn), C.int64_t(id), entries) {
+			return errors.New("callback rejected the messages")
+		}
+		return nil
+	}
+
+	subscriptionMutex.Lock()
+	defer subscriptionMutex.Unlock()
+
+	subscription, err = instance.node.SubscribeReceiveLog(receiveLogSequence, limit, onReceiveLogFn)
+	if err != nil {
+		err = errors.Wrap(err, "could not subscribe")
+		return 0
+	}
+
+	return subscription
+}
+
+// ssbUnsubscribeReceiveLog ends the subscription created with
+// ssbSubscribeReceiveLog. Once this function returns the callback will no
+// longer be called. It must not be called from within the callback.
+//
+//export ssbUnsubscribeReceiveLog
+func ssbUnsubscribeReceiveLog(handle int64, subscription int64) bool {
+	defer logPanic(handle)
+
+	var err error
+	defer logError(handle, "ssbUnsubscribeReceiveLog", &err)
+
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the node")
+		return false
+	}
+
+	err = instance.node.UnsubscribeReceiveLog(subscription)
+	if err != nil {
+		if errors.Is(err, bindings.ErrUnknownSubscription) {
+			err = invalidArgument(err)
+		}
+		err = errors.Wrap(err, "could not unsubscribe")
+		return false
+	}
+
+	return true
+}
+
+// ssbStreamPrivateLog returns received messages which were encrypted for the
+// current identity with their content decrypted. The format and the sequence
+// semantics are the same as in ssbStreamRootLog, the returned sequences are
+// the receive log sequences of the encrypted messages. This means that they
+// aren't consecutive and that the next page should be requested using the
+// sequence of the last returned message plus one. The messages are decrypted
+// by an index which lags behind the receive log.
+//
 //export ssbStreamPrivateLog
-func ssbStreamPrivateLog(seq uint64, limit int) *C.char {
-	defer logPanic()
+func ssbStreamPrivateLog(handle int64, seq uint64, limit int) *C.char {
+	defer logPanic(handle)
 
-	return C.CString("[]")
+	var err error
+	defer logError(handle, "ssbStreamPrivateLog", &err)
+
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the node")
+		return nil
+	}
+
+	receiveLogSequence, err := common.NewReceiveLogSequence(int(seq))
+	if err != nil {
+		err = errors.Wrap(invalidArgument(err), "could not create a receive log sequence")
+		return nil
+	}
+
+	if limit <= 0 {
+		err = invalidArgument(errors.New("limit must be positive"))
+		return nil
+	}
+
+	msgs, err := instance.node.PrivateLog(receiveLogSequence, limit)
+	if err != nil {
+		err = errors.Wrap(err, "query failed")
+		return nil
+	}
+
+	result := make([]logEntry, 0) // prevent empty arrays rendering as null
+	for _, msg := range msgs {
+		result = append(result, logEntry{
+			Key:                msg.Key.String(),
+			Value:              msg.Value,
+			ReceiveLogSequence: msg.Sequence.Int(),
+		})
+	}
+
+	var buf bytes.Buffer
+	if err = json.NewEncoder(&buf).Encode(result); err != nil {
+		err = errors.Wrap(err, "json marshaling failed")
+		return nil
+	}
+
+	return C.CString(buf.String())
 }
 
 // ssbStreamPublishedLog returns messages published by the current active
-// identity. Only messages with receive log sequences greater than the given
-// receive log sequence are returned. This sequence is not the sequence field of
-// Scuttlebutt messages and is simply an index of a message in a list of all
-// received messages. This means that receive log and published log share the
-// sequence numbers. This sequence starts at 0. In order to get the first
-// message you need to pass -1 to this function.
+// identity. Only messages with a receive log sequence greater or equal to the
+// given sequence are returned, see ssbStreamRootLog for the description of
+// the sequence. This means that receive log and published log share the
+// sequence numbers. The returned sequences aren't consecutive so the next page
+// should be requested using the sequence of the last returned message plus
+// one. Number of returned messages can be limited. Limit must be a positive
+// number.
 //
 //export ssbStreamPublishedLog
-func ssbStreamPublishedLog(afterSeq int64) *C.char {
-	defer logPanic()
+func ssbStreamPublishedLog(handle int64, startSeq int64, limit int) *C.char {
+	defer logPanic(handle)
 
 	var err error
-	defer logError("ssbStreamPublishedLog", &err)
+	defer logError(handle, "ssbStreamPublishedLog", &err)
 
-	service, err := node.Get()
+	instance, err := nodes.Get(handle)
 	if err != nil {
 		err = errors.Wrap(err, "could not get the node")
 		return nil
 	}
 
-	query := queries.PublishedLog{
-		LastSeq: nil,
+	if limit <= 0 {
+		err = invalidArgument(errors.New("limit must be positive"))
+		return nil
 	}
 
-	if afterSeq >= 0 {
-		var sequence common.ReceiveLogSequence
-		sequence, err = common.NewReceiveLogSequence(int(afterSeq))
-		if err != nil {
-			err = errors.Wrap(err, "failed to create a message sequence")
-			return nil
-		}
-		query.LastSeq = &sequence
+	sequence, err := common.NewReceiveLogSequence(int(startSeq))
+	if err != nil {
+		err = errors.Wrap(invalidArgument(err), "failed to create a message sequence")
+		return nil
 	}
 
 	start := time.Now()
 
-	msgs, err := service.App.Queries.PublishedLog.Handle(query)
+	msgs, err := instance.node.PublishedLog(sequence, limit)
 	if err != nil {
-		err = errors.Wrap(err, "command failed")
+		err = errors.Wrap(err, "query failed")
 		return nil
 	}
 
-	log.
+	nodes.Logger(handle).
 		Debug().
-		WithField("param.afterSeq", afterSeq).
+		WithField("param.startSeq", startSeq).
+		WithField("param.limit", limit).
 		WithField("n", len(msgs)).
 		WithField("duration", time.Since(start)).
 		Message("returning new messages in ssbStreamPublishedLog")
@@ -138,6 +476,84 @@ func ssbStreamPublishedLog(afterSeq int64) *C.char {
 	return C.CString(buf.String())
 }
 
+// ssbStreamFeed returns at most limit messages of the given feed starting with
+// the message with the given sequence. This sequence is the sequence field of
+// Scuttlebutt messages and starts at 1. If reverse is true the messages are
+// returned in descending order. Passing 0 as the sequence starts with the first
+// message of the feed or with the latest one if reverse is true. The format is
+// the same as in ssbStreamRootLog however receiveLogSequence is set to -1 for
+// messages which weren't indexed yet, see ssbGetMessageByKey. An empty array is
+// returned if the feed is unknown.
+//
+//export ssbStreamFeed
+func ssbStreamFeed(handle int64, feedRef string, fromSeq int64, limit int, reverse bool) *C.char {
+	defer logPanic(handle)
+
+	var err error
+	defer logError(handle, "ssbStreamFeed", &err)
+
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the node")
+		return nil
+	}
+
+	feed, err := refs.NewFeed(feedRef)
+	if err != nil {
+		err = errors.Wrap(invalidArgument(err), "error creating a feed ref")
+		return nil
+	}
+
+	if limit <= 0 {
+		err = invalidArgument(errors.New("limit must be positive"))
+		return nil
+	}
+
+	if fromSeq < 0 {
+		err = invalidArgument(errors.New("sequence can't be negative"))
+		return nil
+	}
+
+	start := time.Now()
+
+	msgs, err := instance.node.StreamFeed(feed, int(fromSeq), limit, reverse)
+	if err != nil {
+		err = errors.Wrap(err, "query failed")
+		return nil
+	}
+
+	nodes.Logger(handle).
+		Debug().
+		WithField("param.fromSeq", fromSeq).
+		WithField("param.limit", limit).
+		WithField("param.reverse", reverse).
+		WithField("n", len(msgs)).
+		WithField("duration", time.Since(start)).
+		Message("returning messages in ssbStreamFeed")
+
+	result := make([]logEntry, 0) // prevent empty arrays rendering as null
+	for _, msg := range msgs {
+		receiveLogSequence := unknownReceiveLogSequence
+		if msg.Sequence != nil {
+			receiveLogSequence = msg.Sequence.Int()
+		}
+
+		result = append(result, logEntry{
+			Key:                msg.Message.Id().String(),
+			Value:              msg.Message.Raw().Bytes(),
+			ReceiveLogSequence: receiveLogSequence,
+		})
+	}
+
+	var buf bytes.Buffer
+	if err = json.NewEncoder(&buf).Encode(result); err != nil {
+		err = errors.Wrap(err, "json marshaling failed")
+		return nil
+	}
+
+	return C.CString(buf.String())
+}
+
 func marshalAsLog(buf *bytes.Buffer, msgs []queries.LogMessage) error {
 	result := make([]logEntry, 0) // prevent empty arrays rendering as null
 
@@ -157,6 +573,21 @@ func marshalAsLog(buf *bytes.Buffer, msgs []queries.LogMessage) error {
 	return nil
 }
 
+// unknownReceiveLogSequence is returned for messages whose receive log
+// sequence isn't known. Scuttlego doesn't expose receive log sequences of
+// messages retrieved from feeds or by key.
+const unknownReceiveLogSequence = -1
+
+type filteredLog struct {
+	Messages json.RawMessage `json:"messages"`
+	Next     int             `json:"next"`
+}
+
+type backlinkEntry struct {
+	logEntry
+	Rels []string `json:"rels"`
+}
+
 type logEntry struct {
 	Key                string          `json:"key"`
 	Value              json.RawMessage `json:"value"`
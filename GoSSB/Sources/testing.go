@@ -8,20 +8,23 @@ import "C"
 import (
 	"encoding/json"
 	"path/filepath"
+	"strings"
+	"verseproj/scuttlegobridge/bindings"
 	"verseproj/scuttlegobridge/tests"
 
 	"github.com/pkg/errors"
 	"github.com/planetary-social/scuttlego/service/app/commands"
+	"github.com/planetary-social/scuttlego/service/domain/refs"
 )
 
 //export ssbTestingMakeNamedKey
-func ssbTestingMakeNamedKey(name string) int {
-	defer logPanic()
+func ssbTestingMakeNamedKey(handle int64, name string) int {
+	defer logPanic(handle)
 
 	var err error
-	defer logError("ssbTestingMakeNamedKey", &err)
+	defer logError(handle, "ssbTestingMakeNamedKey", &err)
 
-	testKeys, err := newTestKeys()
+	testKeys, err := newTestKeys(handle)
 	if err != nil {
 		err = errors.Wrap(err, "error creating test keys")
 		return -1
@@ -33,7 +36,7 @@ func ssbTestingMakeNamedKey(name string) int {
 		return -1
 	}
 
-	log.
+	nodes.Logger(handle).
 		Debug().
 		WithField("function", "ssbTestingMakeNamedKey").
 		WithField("name", name).
@@ -43,13 +46,13 @@ func ssbTestingMakeNamedKey(name string) int {
 }
 
 //export ssbTestingAllNamedKeypairs
-func ssbTestingAllNamedKeypairs() *C.char {
-	defer logPanic()
+func ssbTestingAllNamedKeypairs(handle int64) *C.char {
+	defer logPanic(handle)
 
 	var err error
-	defer logError("ssbTestingAllNamedKeypairs", &err)
+	defer logError(handle, "ssbTestingAllNamedKeypairs", &err)
 
-	testKeys, err := newTestKeys()
+	testKeys, err := newTestKeys(handle)
 	if err != nil {
 		err = errors.Wrap(err, "error creating test keys")
 		return nil
@@ -77,13 +80,13 @@ func ssbTestingAllNamedKeypairs() *C.char {
 }
 
 //export ssbTestingPublishAs
-func ssbTestingPublishAs(nick, content string) *C.char {
-	defer logPanic()
+func ssbTestingPublishAs(handle int64, nick, content string) *C.char {
+	defer logPanic(handle)
 
 	var err error
-	defer logError("ssbTestingPublishAs", &err)
+	defer logError(handle, "ssbTestingPublishAs", &err)
 
-	testKeys, err := newTestKeys()
+	testKeys, err := newTestKeys(handle)
 	if err != nil {
 		err = errors.Wrap(err, "error creating test keys")
 		return nil
@@ -95,7 +98,7 @@ func ssbTestingPublishAs(nick, content string) *C.char {
 		return nil
 	}
 
-	service, err := node.Get()
+	service, err := getService(handle)
 	if err != nil {
 		err = errors.Wrap(err, "could not get the node")
 		return nil
@@ -103,7 +106,7 @@ func ssbTestingPublishAs(nick, content string) *C.char {
 
 	cmd, err := commands.NewPublishRawAsIdentity([]byte(content), iden)
 	if err != nil {
-		err = errors.Wrap(err, "error creating a command")
+		err = errors.Wrap(invalidArgument(err), "error creating a command")
 		return nil
 	}
 
@@ -116,15 +119,74 @@ func ssbTestingPublishAs(nick, content string) *C.char {
 	return C.CString(ref.String())
 }
 
+// ssbTestingPublishPrivateAs encrypts the content for the recipients and
+// publishes it as the named test identity. Recipients are feed refs separated
+// with semicolons.
+//
 //export ssbTestingPublishPrivateAs
-func ssbTestingPublishPrivateAs(nick, content, recps string) *C.char {
-	defer logPanic()
+func ssbTestingPublishPrivateAs(handle int64, nick, content, recps string) *C.char {
+	defer logPanic(handle)
 
-	return nil // publishing private messages is not supported for now
+	var err error
+	defer logError(handle, "ssbTestingPublishPrivateAs", &err)
+
+	testKeys, err := newTestKeys(handle)
+	if err != nil {
+		err = errors.Wrap(err, "error creating test keys")
+		return nil
+	}
+
+	iden, err := testKeys.GetNamedKey(nick)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the identity")
+		return nil
+	}
+
+	var recipients []refs.Identity
+	for _, recipientRef := range strings.Split(recps, ";") {
+		var recipient refs.Identity
+		recipient, err = refs.NewIdentity(recipientRef)
+		if err != nil {
+			err = errors.Wrapf(invalidArgument(err), "invalid recipient '%s'", recipientRef)
+			return nil
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	boxed, err := bindings.BoxPrivateMessage([]byte(content), recipients)
+	if err != nil {
+		err = errors.Wrap(err, "could not box the message")
+		return nil
+	}
+
+	service, err := getService(handle)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the node")
+		return nil
+	}
+
+	cmd, err := commands.NewPublishRawAsIdentity(boxed, iden)
+	if err != nil {
+		err = errors.Wrap(invalidArgument(err), "error creating a command")
+		return nil
+	}
+
+	ref, err := service.App.Commands.PublishRawAsIdentity.Handle(cmd)
+	if err != nil {
+		err = errors.Wrap(err, "error calling the handler")
+		return nil
+	}
+
+	return C.CString(ref.String())
 }
 
-func newTestKeys() (*tests.TestKeys, error) {
-	repository, err := node.Repository()
+func newTestKeys(handle int64) (*tests.TestKeys, error) {
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get the node")
+	}
+
+	repository, err := instance.node.Repository()
 	if err != nil {
 		return nil, errors.Wrap(err, "could not get the repository")
 	}
@@ -24,10 +24,10 @@ import "C"
 
 //export ssbGenKey
 func ssbGenKey() *C.char {
-	defer logPanic()
+	defer logPanic(noHandle)
 
 	var err error
-	defer logError("ssbGenKey", &err)
+	defer logError(noHandle, "ssbGenKey", &err)
 
 	kp, err := ssb.NewKeyPair(nil, refs.RefAlgoFeedSSB1)
 	if err != nil {
@@ -46,9 +46,13 @@ func ssbGenKey() *C.char {
 	return C.CString(buf.String())
 }
 
-func logError(functionName string, errPtr *error) {
+// logError logs the error returned by an exported function and stores it so
+// that it can be retrieved with ssbLastError.
+func logError(handle int64, functionName string, errPtr *error) {
 	if err := *errPtr; err != nil {
-		log.
+		lastErrors.Set(handle, functionName, err)
+
+		nodes.Logger(handle).
 			Error().
 			WithField(logging.ErrorField, err).
 			WithField("function", functionName).
@@ -56,39 +60,61 @@ func logError(functionName string, errPtr *error) {
 	}
 }
 
-func logPanic() {
+// logPanic writes a crash report and logs the panic before panicking again.
+// Panics in functions which don't operate on a particular node are reported
+// to all nodes.
+func logPanic(handle int64) {
 	if p := recover(); p != nil {
-		log.
+		stack := debug.Stack()
+		logger := nodes.Logger(handle)
+
+		for _, instance := range nodes.Reporting(handle) {
+			if err := instance.node.ReportCrash("export", p, stack); err != nil && !errors.Is(err, bindings.ErrCrashReportDirectoryUnknown) {
+				logger.Error().WithField(logging.ErrorField, err).Message("failed to write a crash report")
+			}
+		}
+
+		logger.
 			Error().
 			WithField("panic", p).
-			WithField("stack", string(debug.Stack())).
+			WithField("stack", string(stack)).
 			Message("encountered a panic")
 		panic(p)
 	}
 }
 
+// initPreInitLogger creates the process-wide logger. The standard library
+// logger used by dependencies is redirected to it once instead of to the
+// logger of any particular node as nodes can be created and destroyed at any
+// time.
 func initPreInitLogger() {
-	log = newLogger(os.Stderr, false)
+	logrusLogger := newLogrusLogger(os.Stderr, false)
+	stdlog.SetOutput(logrusLogger.Writer())
+
+	log = logging.NewLogrusLogger(logrusLogger).WithField("source", "golang")
 	log = log.WithField("warning", "pre-init")
 }
 
-func initLogger(config bindings.BotConfig) error {
+func newFileLogger(config bindings.BotConfig) (logging.Logger, error) {
 	debugLogs := logDirectory(config)
 	if err := os.MkdirAll(debugLogs, 0700); err != nil {
-		return errors.Wrap(err, "could not create logs directory")
+		return nil, errors.Wrap(err, "could not create logs directory")
 	}
 
 	logFileName := marshalLogFilename(time.Now())
 	logFile, err := os.Create(filepath.Join(debugLogs, logFileName))
 	if err != nil {
-		return errors.Wrap(err, "failed to create debug log file")
+		return nil, errors.Wrap(err, "failed to create debug log file")
 	}
 
-	log = newLogger(io.MultiWriter(os.Stderr, logFile), config.Testing)
-	return nil
+	return newLogger(io.MultiWriter(os.Stderr, logFile), config.Testing), nil
 }
 
 func newLogger(w io.Writer, testing bool) logging.Logger {
+	return logging.NewLogrusLogger(newLogrusLogger(w, testing)).WithField("source", "golang")
+}
+
+func newLogrusLogger(w io.Writer, testing bool) *logrus.Logger {
 	const swiftLikeFormat = "2006-01-02 15:04:05.0000000 (UTC)"
 
 	customFormatter := new(logrus.TextFormatter)
@@ -103,9 +129,7 @@ func newLogger(w io.Writer, testing bool) logging.Logger {
 		logrusLogger.SetLevel(logrus.DebugLevel)
 	}
 
-	stdlog.SetOutput(logrusLogger.Writer())
-
-	return logging.NewLogrusLogger(logrusLogger).WithField("source", "golang")
+	return logrusLogger
 }
 
 func removeOldLogFiles(cfg bindings.BotConfig) error {
@@ -131,7 +155,7 @@ func removeOldLogFiles(cfg bindings.BotConfig) error {
 }
 
 func logDirectory(cfg bindings.BotConfig) string {
-	return filepath.Join(cfg.Repo, "debug")
+	return bindings.DebugDirectory(cfg)
 }
 
 func marshalLogFilename(t time.Time) string {
@@ -0,0 +1,121 @@
+package main
+
+// #include <stdint.h>
+//
+// static void callNotifyVerificationOnProgress(void *func, int64_t messagesVerified, int64_t messagesTotal)
+// {
+//     ((void(*)(int64_t, int64_t))func)(messagesVerified, messagesTotal);
+// }
+import "C"
+import (
+	"encoding/json"
+	"verseproj/scuttlegobridge/bindings"
+
+	"github.com/pkg/errors"
+	"github.com/planetary-social/scuttlego/service/domain/refs"
+)
+
+// ssbVerifyFeed checks the integrity of the locally stored messages of the
+// given feed. The messages are read one by one the same way as in
+// ssbGetRawMessage. The sequences of the received messages are taken from the
+// index also used by ssbSearch so recently received messages may not be
+// verified yet.
+//
+// Returns a JSON object with the following fields:
+//
+//	feed           - the feed ref
+//	messages       - number of stored messages
+//	latestSequence - highest sequence of a received message
+//	gaps           - array of objects with the fields from and to describing
+//	                 inclusive ranges of sequences of messages which aren't
+//	                 stored
+//	brokenLinks    - array of objects with the fields sequence, key, expected
+//	                 and previous describing messages which don't reference
+//	                 the preceding message, expected is empty for the first
+//	                 message of the feed
+//	badSignatures  - array of objects with the fields sequence, key and error
+//	                 describing messages which fail verification using the
+//	                 configured HMAC key
+//	forks          - array of objects with the fields sequence and keys
+//	                 describing sequences for which several different messages
+//	                 were received
+//
+// Arrays without any elements are null.
+//
+//export ssbVerifyFeed
+func ssbVerifyFeed(handle int64, feedRef string) *C.char {
+	defer logPanic(handle)
+
+	var err error
+	defer logError(handle, "ssbVerifyFeed", &err)
+
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the node")
+		return nil
+	}
+
+	feed, err := refs.NewFeed(feedRef)
+	if err != nil {
+		err = errors.Wrap(invalidArgument(err), "error creating a feed ref")
+		return nil
+	}
+
+	report, err := instance.node.VerifyFeed(feed)
+	if err != nil {
+		err = errors.Wrap(err, "verification failed")
+		return nil
+	}
+
+	b, err := json.Marshal(report)
+	if err != nil {
+		err = errors.Wrap(err, "json marshaling failed")
+		return nil
+	}
+
+	return C.CString(string(b))
+}
+
+// ssbVerifyRepo verifies every locally stored feed, see ssbVerifyFeed. This
+// may take a long time. The optional callback is called periodically from the
+// calling thread with the number of verified messages out of the total.
+//
+// Returns a JSON object with the fields feeds and messages which are the
+// number of verified feeds and messages and problems which is an array of
+// reports in the format returned by ssbVerifyFeed, one for each feed in which
+// problems were found.
+//
+//export ssbVerifyRepo
+func ssbVerifyRepo(handle int64, notifyProgressFn uintptr) *C.char {
+	defer logPanic(handle)
+
+	var err error
+	defer logError(handle, "ssbVerifyRepo", &err)
+
+	instance, err := nodes.Get(handle)
+	if err != nil {
+		err = errors.Wrap(err, "could not get the node")
+		return nil
+	}
+
+	var onProgressFn bindings.VerificationOnProgressFn
+	if notifyProgressFn != 0 {
+		onProgressFn = func(messagesVerified, messagesTotal int64) {
+			C.callNotifyVerificationOnProgress(unsafeExternPointer(notifyProgressFn), C.int64_t(messagesVerified), C.int64_t(messagesTotal))
+		}
+	}
+
+	report, err := instance.node.VerifyRepo(onProgressFn)
+	if err != nil {
+		err = errors.Wrap(err, "verification failed")
+		return nil
+	}
+
+	b, err := json.Marshal(report)
+	if err != nil {
+		err = errors.Wrap(err, "json marshaling failed")
+		return nil
+	}
+
+	return C.CString(string(b))
+}
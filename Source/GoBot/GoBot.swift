@@ -199,9 +199,7 @@ class GoBot: Bot, @unchecked Sendable {
             userInitiatedQueue.async {
                 do {
                     try self.database.delete(allFrom: identity)
-                    let receiveLogMsgs = try self.bot.getPublishedLog(after: -1)
-                    let publishedPosts = self.mapReceiveLogMessages(msgs: receiveLogMsgs)
-                    try self.database.fillMessages(msgs: publishedPosts)
+                    try self.fillPublishedLog(startSeq: 0)
                     continuation.resume()
                 } catch {
                     continuation.resume(throwing: error)
@@ -604,7 +602,7 @@ class GoBot: Bot, @unchecked Sendable {
                 }
                 
                 star.invite.withGoString { goStr in
-                    if ssbInviteAccept(goStr) {
+                    if ssbInviteAccept(self.bot.handle, goStr) {
                         do {
                             let feed = star.feed
                             let address = star.address
@@ -679,8 +677,7 @@ class GoBot: Bot, @unchecked Sendable {
                         return
                     }
                     let lastPostIndex = try self.database.largestSeqFromPublishedLog()
-                    let publishedPosts = self.mapReceiveLogMessages(msgs: try self.bot.getPublishedLog(after: lastPostIndex))
-                    try self.database.fillMessages(msgs: publishedPosts)
+                    try self.fillPublishedLog(startSeq: lastPostIndex + 1)
                     try self.updateNumberOfPublishedMessages(for: identity)
                     self.numberOfPublishedMessagesLock.unlock()
                     completionQueue.async { completion(key, nil) }
@@ -1742,7 +1739,7 @@ class GoBot: Bot, @unchecked Sendable {
                 return
             }
             identity.withGoString { feedRef in
-                guard let pointer = ssbGetRawMessage(feedRef, UInt64(sequence)) else {
+                guard let pointer = ssbGetRawMessage(self.bot.handle, feedRef, UInt64(sequence)) else {
                     completion(.failure(GoBotError.unexpectedFault("failed to get raw message")))
                     return
                 }
@@ -1773,6 +1770,20 @@ class GoBot: Bot, @unchecked Sendable {
         )
     }
     
+    /// Copies the posts published by the current user starting with the given receive log sequence number into the
+    /// ViewDatabase one page at a time.
+    private func fillPublishedLog(startSeq: Int64, pageSize: Int32 = 1000) throws {
+        var startSeq = startSeq
+        while true {
+            let receiveLogMsgs = try self.bot.getPublishedLog(startSeq: startSeq, limit: pageSize)
+            try self.database.fillMessages(msgs: self.mapReceiveLogMessages(msgs: receiveLogMsgs))
+            guard receiveLogMsgs.count == pageSize, let last = receiveLogMsgs.last else {
+                return
+            }
+            startSeq = Int64(last.receiveLogSequence) + 1
+        }
+    }
+
     private func mapReceiveLogMessages(msgs: [ReceiveLogMessage]) -> Messages {
         return msgs.map { msg in
             let digest = SHA256.hash(data: Data(msg.key.utf8))
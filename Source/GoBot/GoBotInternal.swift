@@ -61,6 +61,8 @@ struct ScuttlegobotBotStatus: Decodable {
 }
 
 private struct GoBotConfig: Encodable {
+    /// Must match the config schema version supported by the Go bridge.
+    let schemaVersion = 1
     let networkKey: String
     let hmacKey: String
     let keyBlob: String
@@ -93,12 +95,21 @@ class GoBotInternal {
 
     private let queue: DispatchQueue
 
+    /// Identifies the node owned by this bot in calls to the Go bridge. The node is destroyed on logout and
+    /// replaced with a new one so that the bridge doesn't keep a node for every session.
+    private(set) var handle: Int64
+
     init(_ queue: DispatchQueue) {
         self.queue = queue
+        self.handle = ssbNodeCreate()
+    }
+
+    deinit {
+        ssbNodeDestroy(self.handle)
     }
 
     var isRunning: Bool {
-        ssbBotIsRunning()
+        ssbBotIsRunning(self.handle)
     }
 
     private var currentNetwork: SSBNetwork?
@@ -156,11 +167,16 @@ class GoBotInternal {
                 var worked = false
                 configString.withGoString { configGoString in
                     worked = ssbBotInit(
+                        self.handle,
                         configGoString,
                         self.notifyBlobReceived,
                         migrationDelegate.onRunningCallback,
                         migrationDelegate.onErrorCallback,
-                        migrationDelegate.onDoneCallback
+                        migrationDelegate.onDoneCallback,
+                        nil,
+                        nil,
+                        nil,
+                        nil
                     )
                 }
                 
@@ -186,10 +202,15 @@ class GoBotInternal {
             return false
         }
             
-        if !ssbBotStop() {
+        if !ssbBotStop(self.handle) {
             Log.fatal(.botError, "stoping GoSbot failed.")
             return false
         }
+
+        if !ssbNodeDestroy(self.handle) {
+            Log.info("[GoBot] failed to destroy the node of the previous session")
+        }
+        self.handle = ssbNodeCreate()
         return true
     }
 
@@ -202,7 +223,7 @@ class GoBotInternal {
     // MARK: connections
 
     func openConnections() -> UInt {
-        UInt(ssbOpenConnections())
+        UInt(ssbOpenConnections(self.handle))
     }
     
     // extracts the current open connections from  bot status
@@ -217,7 +238,7 @@ class GoBotInternal {
     }
     
     func disconnectAll() {
-        if !ssbDisconnectAllPeers() {
+        if !ssbDisconnectAllPeers(self.handle) {
             let error = GoBotError.unexpectedFault("failed to disconnect all peers")
             Log.optional(error)
             CrashReporting.shared.reportIfNeeded(error: error)
@@ -258,7 +279,7 @@ class GoBotInternal {
         }
         
         // connect to two peers based on go-ssb's internal logic (reliability)
-        let disconnectSuccess = ssbDisconnectAllPeers()
+        let disconnectSuccess = ssbDisconnectAllPeers(self.handle)
         if !disconnectSuccess {
             Log.error("Failed to disconnect peers")
         }
@@ -276,7 +297,7 @@ class GoBotInternal {
         Log.debug("Dialing \(peer.string)")
         var worked = false
         peer.string.withGoString {
-            worked = ssbConnectPeer($0)
+            worked = ssbConnectPeer(self.handle, $0)
         }
         if !worked {
             Log.unexpected(.botError, "muxrpc connect to \(peer) failed")
@@ -298,7 +319,7 @@ class GoBotInternal {
     /// Fetches some metadata about the go-ssb log including how many messages it has.
     /// This should only be called on the `serialQueue`.
     func repoStats() throws -> ScuttlegobotRepoCounts {
-        guard let counts = ssbRepoStats() else {
+        guard let counts = ssbRepoStats(self.handle) else {
             throw GoBotError.unexpectedFault("failed to get repo counts")
         }
         let countData = String(cString: counts).data(using: .utf8)!
@@ -318,7 +339,7 @@ class GoBotInternal {
     }
     
     func status() throws -> ScuttlegobotBotStatus {
-        guard let status = ssbBotStatus() else {
+        guard let status = ssbBotStatus(self.handle) else {
             throw GoBotError.unexpectedFault("failed to get bot status")
         }
         let d = String(cString: status).data(using: .utf8)!
@@ -331,7 +352,7 @@ class GoBotInternal {
         let encodedHashes = try JSONEncoder().encode(banList)
         let hashesStr = String(data: encodedHashes, encoding: .utf8)!
         let succeeded = hashesStr.withGoString {
-            return ssbBanListSet($0)
+            return ssbBanListSet(self.handle, $0)
         }
         if !succeeded {
             throw GoBotError.unexpectedFault("failed to set the ban list")
@@ -341,7 +362,7 @@ class GoBotInternal {
     // TODO: call this to fetch a feed without following it
     func replicate(feed: FeedIdentifier) {
         feed.withGoString {
-            ssbFeedReplicate($0)
+            ssbFeedReplicate(self.handle, $0)
         }
     }
 
@@ -368,7 +389,7 @@ class GoBotInternal {
         
         // Give go-ssb the file handle to read
         let readFD = pipe.fileHandleForReading.fileDescriptor
-        guard let rawBytes = ssbBlobsAdd(readFD) else {
+        guard let rawBytes = ssbBlobsAdd(self.handle, readFD) else {
             completion("", GoBotError.unexpectedFault("blobsAdd failed"))
             return
         }
@@ -414,12 +435,21 @@ class GoBotInternal {
         }
     }
     
-    func blobsWant(ref: BlobIdentifier) throws {
-        var worked = false
+    /// Asks go-ssb to download the blob from peers. Returns true if the download was deferred because the app is
+    /// under memory pressure. Deferred downloads are dropped if the bot is stopped before the pressure returns to
+    /// normal so the blob has to be wanted again once the bot is running.
+    @discardableResult
+    func blobsWant(ref: BlobIdentifier) throws -> Bool {
+        var result: Int32 = 0
         ref.withGoString {
-            worked = ssbBlobsWant($0)
+            result = ssbBlobsWant(self.handle, $0)
         }
-        if !worked {
+        switch result {
+        case 1:
+            return false
+        case 2:
+            return true
+        default:
             throw GoBotError.unexpectedFault("BlobsWant failed")
         }
     }
@@ -429,7 +459,7 @@ class GoBotInternal {
     /// This fetches posts from go-ssb's RootLog - the log containing all posts from all users. The Go code will filter
     /// out some messages, such as those from blocked users and old messages.
     func getReceiveLog(startSeq: UInt64, limit: Int32) throws -> [ReceiveLogMessage] {
-        guard let rawBytes = ssbStreamRootLog(startSeq, limit) else {
+        guard let rawBytes = ssbStreamRootLog(self.handle, startSeq, limit) else {
             throw GoBotError.unexpectedFault("rxLog pre-processing error")
         }
         let data = String(cString: rawBytes).data(using: .utf8)!
@@ -442,9 +472,11 @@ class GoBotInternal {
         }
     }
     
-    /// Fetches all the posts that the current user has published after the post with sequence number `startSeq`.
-    func getPublishedLog(after index: Int64) throws -> [ReceiveLogMessage] {
-        guard let rawBytes = ssbStreamPublishedLog(index) else {
+    /// Fetches at most `limit` posts that the current user has published starting with the post with receive log
+    /// sequence number `startSeq`. The sequence numbers aren't consecutive, the next page starts with the sequence
+    /// number of the last returned post plus one.
+    func getPublishedLog(startSeq: Int64, limit: Int32) throws -> [ReceiveLogMessage] {
+        guard let rawBytes = ssbStreamPublishedLog(self.handle, startSeq, limit) else {
             throw GoBotError.unexpectedFault("publishedLog pre-processing error")
         }
         let data = String(cString: rawBytes).data(using: .utf8)!
@@ -457,9 +489,29 @@ class GoBotInternal {
         }
     }
     
+    /// Fetches at most `limit` messages of the given feed starting with the message with sequence number `startSeq`.
+    /// Passing 0 starts with the first message or with the latest one if `reverse` is true. `receiveLogSequence` is
+    /// -1 for messages which weren't indexed yet, for example right after they were received.
+    func getFeed(_ feed: FeedIdentifier, startSeq: Int64, limit: Int32, reverse: Bool) throws -> [ReceiveLogMessage] {
+        let rawBytes: UnsafeMutablePointer<CChar>? = feed.withGoString {
+            ssbStreamFeed(self.handle, $0, startSeq, limit, reverse)
+        }
+        guard let rawBytes = rawBytes else {
+            throw GoBotError.unexpectedFault("feed pre-processing error")
+        }
+        let data = String(cString: rawBytes).data(using: .utf8)!
+        free(rawBytes)
+        do {
+            let decoder = JSONDecoder()
+            return try decoder.decode([ReceiveLogMessage].self, from: data)
+        } catch {
+            throw GoBotError.duringProcessing("feed json decoding error:", error)
+        }
+    }
+    
     // aka private.read
     func getPrivateLog(startSeq: Int64, limit: Int) throws -> [ReceiveLogMessage] {
-        guard let rawBytes = ssbStreamPrivateLog(UInt64(startSeq), Int32(limit)) else {
+        guard let rawBytes = ssbStreamPrivateLog(self.handle, UInt64(startSeq), Int32(limit)) else {
             throw GoBotError.unexpectedFault("privateLog pre-processing error")
         }
         
@@ -488,7 +540,7 @@ class GoBotInternal {
         }
 
         contentStr.withGoString {
-            guard let cRef = ssbPublish($0) else {
+            guard let cRef = ssbPublish(self.handle, $0) else {
                 completion("", GoBotError.unexpectedFault("publish failed"))
                 return
             }
@@ -504,7 +556,7 @@ class GoBotInternal {
         Log.debug("Registering room alias: \(alias) at \(room.address.string)")
         let result: ssbRoomsAliasRegisterReturn_t = room.address.string.withGoString { roomAddress in
             alias.withGoString { alias in
-                ssbRoomsAliasRegister(roomAddress, alias)
+                ssbRoomsAliasRegister(self.handle, roomAddress, alias)
             }
         }
         
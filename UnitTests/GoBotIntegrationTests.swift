@@ -1048,7 +1048,7 @@ class GoBotIntegrationTests: XCTestCase {
         sut.testingPublish(as: "alice", content: Post(text: "Hello, World"))
         var source: String?
         alice.withGoString { gostr in
-            if let rawPointer = ssbGetRawMessage(gostr, 1) {
+            if let rawPointer = ssbGetRawMessage(sut.bot.handle, gostr, 1) {
                 source = String(cString: rawPointer)
                 free(rawPointer)
             }
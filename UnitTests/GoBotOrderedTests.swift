@@ -195,25 +195,35 @@ class GoBotOrderedTests: XCTestCase {
         self.wait(for: [ex], timeout: 10)
     }
     
-    /// Tests the getPublishedLog function with a -1 index, verifying that it fetches all the user's published messages.
-    func test052_getPublishLogGivenNegativeIndex() throws {
-        let publishedMessages = try GoBotOrderedTests.shared.bot.getPublishedLog(after: -1)
+    /// Tests the getPublishedLog function with a 0 index, verifying that it fetches all the user's published messages.
+    func test052_getPublishLogGivenZeroIndex() throws {
+        let publishedMessages = try GoBotOrderedTests.shared.bot.getPublishedLog(startSeq: 0, limit: 1000)
         XCTAssertEqual(publishedMessages.count, 27)
         XCTAssertEqual(publishedMessages.last?.value.content.type, .about)
     }
     
-    /// Tests that the getPublishedLog function gives only messages after the given index.
+    /// Tests that the getPublishedLog function gives only messages starting with the given index.
     func test053_getPublishLogGivenLastIndex() throws {
-        let publishedMessages = try GoBotOrderedTests.shared.bot.getPublishedLog(after: 25)
+        let publishedMessages = try GoBotOrderedTests.shared.bot.getPublishedLog(startSeq: 26, limit: 1000)
         XCTAssertEqual(publishedMessages.count, 1)
         XCTAssertEqual(publishedMessages.last?.value.content.type, .about)
     }
     
     /// Tests that the getPublishedLog returns an empty list when we pass an out-of-bounds index.
     func test054_getPublishLogGivenIndexOOB() throws {
-        let publishedMessages = try GoBotOrderedTests.shared.bot.getPublishedLog(after: 99_999_999)
+        let publishedMessages = try GoBotOrderedTests.shared.bot.getPublishedLog(startSeq: 99_999_999, limit: 1000)
         XCTAssertEqual(publishedMessages.count, 0)
     }
+    
+    /// Tests that the getPublishedLog function returns at most the given number of messages.
+    func test055_getPublishLogGivenLimit() throws {
+        let firstPage = try GoBotOrderedTests.shared.bot.getPublishedLog(startSeq: 0, limit: 10)
+        XCTAssertEqual(firstPage.count, 10)
+        
+        let lastSeq = try XCTUnwrap(firstPage.last?.receiveLogSequence)
+        let secondPage = try GoBotOrderedTests.shared.bot.getPublishedLog(startSeq: lastSeq + 1, limit: 1000)
+        XCTAssertEqual(secondPage.count, 17)
+    }
 
     func test101_ViewHasAboutSelf() async {
         let ex = self.expectation(description: "\(#function)")
@@ -32,7 +32,7 @@ extension GoBot {
     func testingCreateKeypair(nick: String) throws {
         var err: Error?
         nick.withGoString {
-            let ok = ssbTestingMakeNamedKey($0)
+            let ok = ssbTestingMakeNamedKey(self.bot.handle, $0)
             if ok != 0 {
                 err = GoBotError.unexpectedFault("failed to create test key")
             }
@@ -42,7 +42,7 @@ extension GoBot {
     }
 
     func testingGetNamedKeypairs() throws -> [String: Identity] {
-        guard let cstr = ssbTestingAllNamedKeypairs() else {
+        guard let cstr = ssbTestingAllNamedKeypairs(self.bot.handle) else {
             throw GoBotError.unexpectedFault("failed to load keypairs")
         }
         let data = String(cString: cstr).data(using: .utf8)!
@@ -72,7 +72,7 @@ extension GoBot {
         var identifier: MessageIdentifier?
         nick.withGoString { goStrMe in
             content.withGoString { goStrContent in
-                guard let refCstr = ssbTestingPublishAs(goStrMe, goStrContent) else {
+                guard let refCstr = ssbTestingPublishAs(self.bot.handle, goStrMe, goStrContent) else {
                     XCTFail("publish failed!")
                     return
                 }
@@ -97,7 +97,7 @@ extension GoBot {
         let c = try! content.encodeToData().string()!
         var identifier: MessageIdentifier?
         c.withGoString { goStrContent in
-            guard let refCstr = ssbPublish(goStrContent) else {
+            guard let refCstr = ssbPublish(self.bot.handle, goStrContent) else {
                 XCTFail("publish failed!")
                 return
             }
@@ -122,7 +122,7 @@ extension GoBot {
         let content = try XCTUnwrap(contact.encodeToData().string())
         var identifier: MessageIdentifier?
         content.withGoString { goStrContent in
-            guard let refCstr = ssbPublish(goStrContent) else {
+            guard let refCstr = ssbPublish(self.bot.handle, goStrContent) else {
                 XCTFail("publish failed!")
                 return
             }
@@ -148,7 +148,7 @@ extension GoBot {
                         return
                     }
                     recps.joined(separator: ";").withGoString { recpsJoined in
-                        guard let refCstr = ssbTestingPublishPrivateAs(goStrNick, goStrContent, recpsJoined) else {
+                        guard let refCstr = ssbTestingPublishPrivateAs(self.bot.handle, goStrNick, goStrContent, recpsJoined) else {
                             XCTFail("private publish failed")
                             return
                         }
@@ -158,7 +158,7 @@ extension GoBot {
                 }
 
                 // public mode
-                guard let refCstr = ssbTestingPublishAs(goStrNick, goStrContent) else {
+                guard let refCstr = ssbTestingPublishAs(self.bot.handle, goStrNick, goStrContent) else {
                     XCTFail("publish failed!")
                     return
                 }
@@ -179,7 +179,7 @@ extension GoBot {
         nick.withGoString { goStrNick in
             content.withGoString { goStrContent in
 
-                guard let refCstr = ssbTestingPublishAs(goStrNick, goStrContent) else {
+                guard let refCstr = ssbTestingPublishAs(self.bot.handle, goStrNick, goStrContent) else {
                     XCTFail("raw publish failed!")
                     return
                 }